@@ -6,12 +6,15 @@ import (
 	"os/signal"
 	"syscall"
 
+	"gosm/pkg/api"
 	"gosm/pkg/config"
+	"gosm/pkg/hook"
 	"gosm/pkg/live"
 	"gosm/pkg/log"
 	"gosm/pkg/protocol/hls"
 	"gosm/pkg/protocol/httpflv"
 	"gosm/pkg/protocol/rtmp"
+	"gosm/pkg/protocol/rtsp"
 	"gosm/pkg/protocol/rtsp/udp"
 )
 
@@ -29,6 +32,24 @@ func main() {
 
 	// living room managerment
 	roomMgmt := live.NewRoomMgmt()
+	if config.Global.Hooks.Enable {
+		roomMgmt.SetHooks(hook.New(&config.Global.Hooks))
+	}
+	if config.Global.Relay.Enable {
+		roomMgmt.SetRelay(&config.Global.Relay)
+	}
+	if config.Global.Forward.Enable {
+		roomMgmt.SetForward(&config.Global.Forward)
+	}
+
+	// rtmp authentication, webhooks consulted after configured auth
+	var rtmpAuth rtmp.Authenticator
+	if config.Global.RTMP.Auth.Enable {
+		rtmpAuth = rtmp.NewDefaultAuth(&config.Global.RTMP.Auth)
+	}
+	if config.Global.Hooks.Enable {
+		rtmpAuth = roomMgmt.RTMPAuthenticator(rtmpAuth)
+	}
 
 	// rtmp server
 	rtmpServer, rtmpCloseFunc, err := rtmp.NewServer("tcp", ":"+config.Global.RTMP.Port)
@@ -36,8 +57,23 @@ func main() {
 		log.Fatal("RTMP Server Starts Faild:%v", err)
 	}
 	rtmpServer.SetObserver(roomMgmt)
+	rtmpServer.SetAuthenticator(rtmpAuth)
 	rtmpServer.Serve()
 
+	// rtmps server
+	rtmpsCloseFunc := func() {}
+	if config.Global.RTMP.TLS.Enable {
+		var rtmpsServer *rtmp.Server
+		tlsCfg := config.Global.RTMP.TLS
+		rtmpsServer, rtmpsCloseFunc, err = rtmp.NewTLSServer("tcp", ":"+tlsCfg.Port, tlsCfg.CertFile, tlsCfg.KeyFile)
+		if err != nil {
+			log.Fatal("RTMPS Server Starts Faild:%v", err)
+		}
+		rtmpsServer.SetObserver(roomMgmt)
+		rtmpsServer.SetAuthenticator(rtmpAuth)
+		rtmpsServer.Serve()
+	}
+
 	// http-flv server
 	flvServer, flvCloseFunc, err := httpflv.NewServer("tcp", ":"+config.Global.HTTPFLV.Port)
 	if err != nil {
@@ -53,39 +89,41 @@ func main() {
 	}
 	hlsServer.Serve()
 
-	// udp server
-	session, err := udp.NewSession("50000")
-	if err != nil {
-		log.Fatal("UDP Server Starts Faild:%v", err)
+	// rtsp server
+	rtspCloseFunc := func() {}
+	if config.Global.RTSP.Enable {
+		var rtspServer *rtsp.Server
+		rtspServer, rtspCloseFunc, err = rtsp.NewServer("tcp", ":"+config.Global.RTSP.Port)
+		if err != nil {
+			log.Fatal("RTSP Server Starts Faild:%v", err)
+		}
+		rtspServer.SetObserver(roomMgmt)
+		rtspServer.Serve()
 	}
-	go session.Serve()
 
-	// udp to rtmp client
-	rtmpClient, err := rtmp.NewClient(config.Global.RTP.Remote)
-	if err != nil {
-		log.Fatal("RTMP Client Initials Faild:%v", err)
-	}
-	if err := rtmpClient.Handshake(); err != nil {
-		log.Fatal("%+v", err)
-	}
-	if err := rtmpClient.Connect(); err != nil {
-		log.Fatal("%+v", err)
-	}
-	if err := rtmpClient.Publish(); err != nil {
-		log.Fatal("%+v", err)
+	// udp server
+	udpCloseFunc := func() {}
+	if config.Global.RTP.Enable {
+		var udpServer *udp.Server
+		udpServer, udpCloseFunc, err = udp.NewServer("udp", config.Global.RTP.Ports...)
+		if err != nil {
+			log.Fatal("UDP Server Starts Faild:%v", err)
+		}
+		udpServer.SetObserver(roomMgmt)
+		udpServer.Serve()
 	}
 
-	go func() {
-		for {
-			avPacket, err := session.ReadAVPacket()
-			if err != nil {
-				return
-			}
-			if err := rtmpClient.WriteAVPacket(avPacket); err != nil {
-				return
-			}
+	// management api server
+	apiCloseFunc := func() {}
+	if config.Global.API.Enable {
+		var apiServer *api.Server
+		apiServer, apiCloseFunc, err = api.NewServer("tcp", ":"+config.Global.API.Port, config.Global.API.Token)
+		if err != nil {
+			log.Fatal("API Server Starts Faild:%v", err)
 		}
-	}()
+		apiServer.SetManager(roomMgmt)
+		apiServer.Serve()
+	}
 
 	// Wait for interrupt signal to gracefully shutdown the server.
 	quit := make(chan os.Signal, 1)
@@ -98,8 +136,12 @@ func main() {
 		switch signal {
 		case syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT:
 			rtmpCloseFunc()
+			rtmpsCloseFunc()
 			flvCloseFunc()
 			hlsCloseFunc()
+			rtspCloseFunc()
+			udpCloseFunc()
+			apiCloseFunc()
 			return
 		case syscall.SIGHUP:
 		default:
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"gosm/pkg/config"
+	"gosm/pkg/live"
+	"gosm/pkg/log"
+)
+
+// Manager living rooms managerment, implemented by live.RoomMgmt
+type Manager interface {
+	Rooms(vhost string) []*live.RoomInfo
+	Room(vhost string, app string, name string) (*live.RoomInfo, error)
+	Clients(vhost string) []*live.ClientInfo
+	DropRoom(vhost string, app string, name string) error
+	Kick(uid string) error
+}
+
+// Server http json management api, routes:
+//
+//	GET    /api/streams                 rooms, filtered by query 'vhost' if any
+//	GET    /api/streams/{app}/{stream}  room of query 'vhost', default vhost if absent
+//	DELETE /api/streams/{app}/{stream}  drop room with its publisher & subscribers
+//	GET    /api/clients                 publishers & subscribers, filtered by query 'vhost' if any
+//	DELETE /api/clients/{uid}           kick publisher or subscriber
+type Server struct {
+	ctx      context.Context
+	network  string
+	address  string
+	token    string // bearer token required if not empty
+	listener net.Listener
+	mgr      Manager
+}
+
+// NewServer .
+func NewServer(network string, address string, token string) (*Server, func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &Server{
+		ctx:      ctx,
+		network:  network,
+		address:  address,
+		token:    token,
+		listener: nil,
+		mgr:      nil,
+	}
+
+	closeFunc := func() {
+		defer cancel()
+		if err := server.listener.Close(); err != nil {
+			log.Error("%v", err)
+		}
+	}
+
+	return server, closeFunc, nil
+}
+
+// SetManager .
+func (server *Server) SetManager(mgr Manager) {
+	server.mgr = mgr
+}
+
+// Serve .
+func (server *Server) Serve() {
+	if server.mgr == nil {
+		log.Fatal("API: manager is empty")
+	}
+
+	// listener
+	var err error
+	server.listener, err = net.Listen(server.network, server.address)
+	if err != nil {
+		log.Fatal("API: server listen error, %v", err)
+	}
+	log.Info("API: server listen on %s", server.listener.Addr().String())
+
+	// muxer
+	muxer := http.NewServeMux()
+	muxer.HandleFunc("/api/streams", server.auth(server.handleStreams))
+	muxer.HandleFunc("/api/streams/", server.auth(server.handleStream))
+	muxer.HandleFunc("/api/clients", server.auth(server.handleClients))
+	muxer.HandleFunc("/api/clients/", server.auth(server.handleClient))
+
+	// http server
+	go func() {
+		if err := http.Serve(server.listener, muxer); err != nil {
+			log.Error("%v", err)
+		}
+	}()
+}
+
+// auth checks bearer token if configured
+func (server *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if server.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+server.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleStreams lists rooms
+func (server *Server) handleStreams(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, server.mgr.Rooms(r.URL.Query().Get("vhost")))
+}
+
+// handleStream gets or drops room
+func (server *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	urls := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/api/streams/"), "/", 2)
+	if len(urls) != 2 || urls[0] == "" || urls[1] == "" {
+		writeError(w, http.StatusBadRequest, "invalid path, /api/streams/{app}/{stream}")
+		return
+	}
+	vhost := r.URL.Query().Get("vhost")
+	if vhost == "" {
+		vhost = config.DefaultVhost
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		room, err := server.mgr.Room(vhost, urls[0], urls[1])
+		if err != nil {
+			writeError(w, statusOf(err), err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, room)
+	case http.MethodDelete:
+		if err := server.mgr.DropRoom(vhost, urls[0], urls[1]); err != nil {
+			writeError(w, statusOf(err), err.Error())
+			return
+		}
+		log.Info("API: room '%s/%s/%s' dropped by '%s'", vhost, urls[0], urls[1], r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleClients lists publishers & subscribers
+func (server *Server) handleClients(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, server.mgr.Clients(r.URL.Query().Get("vhost")))
+}
+
+// handleClient kicks publisher or subscriber
+func (server *Server) handleClient(w http.ResponseWriter, r *http.Request) {
+	uid := strings.TrimPrefix(r.URL.Path, "/api/clients/")
+	if uid == "" || strings.Contains(uid, "/") {
+		writeError(w, http.StatusBadRequest, "invalid path, /api/clients/{uid}")
+		return
+	}
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if err := server.mgr.Kick(uid); err != nil {
+		writeError(w, statusOf(err), err.Error())
+		return
+	}
+	log.Info("API: client '%s' kicked by '%s'", uid, r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// statusOf http status of manager error
+func statusOf(err error) int {
+	if errors.Is(err, live.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJSON .
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Server", config.API)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("API: write response error, %v", err)
+	}
+}
+
+// writeError responses error as {"error": message}
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
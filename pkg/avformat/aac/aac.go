@@ -48,6 +48,11 @@ func (parser *AACParser) ParseAudioSpecificConfig(p []byte) error {
 	return nil
 }
 
+// AudioSpecificConfig returns parsed config, nil if not parsed yet
+func (parser *AACParser) AudioSpecificConfig() *AudioSpecificConfig {
+	return parser.audioSpecificConfig
+}
+
 // see ISO_IEC_14496-3
 //   ----------------------------------------------------
 //   syncword                 [12b] 0xFFF
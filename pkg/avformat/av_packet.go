@@ -1,6 +1,7 @@
 package avformat
 
 import (
+	"bytes"
 	"fmt"
 	"gosm/pkg/avformat/flv"
 )
@@ -55,10 +56,16 @@ func (packet *AVPacket) IsAVC() bool {
 	return packet.TypeID == TypeVideo && body[0]&0x0F == flv.CodevIDAVC
 }
 
-// IsHEVC .
+// IsHEVC legacy codec id 12 or enhanced rtmp fourcc 'hvc1'
 func (packet *AVPacket) IsHEVC() bool {
 	body := packet.Body
-	return packet.TypeID == TypeVideo && body[0]&0x0F == flv.CodevIDHEVC
+	if packet.TypeID != TypeVideo {
+		return false
+	}
+	if body[0]&flv.VideoExHeader != 0 {
+		return len(body) >= 5 && bytes.Equal(body[1:5], flv.FourCCHEVC[:])
+	}
+	return body[0]&0x0F == flv.CodevIDHEVC
 }
 
 // IsAVCSeqHeader .
@@ -70,6 +77,9 @@ func (packet *AVPacket) IsAVCSeqHeader() bool {
 // IsHEVCSeqHeader .
 func (packet *AVPacket) IsHEVCSeqHeader() bool {
 	body := packet.Body
+	if packet.IsExHEVC() {
+		return body[0]&0x0F == flv.PacketTypeSequenceStart
+	}
 	return body[0] == flv.AVCKeyFrame<<4|flv.CodevIDHEVC && body[1] == flv.AVCSeqHeader
 }
 
@@ -88,15 +98,32 @@ func (packet *AVPacket) IsAVCInterframe() bool {
 // IsHEVCKeyframe .
 func (packet *AVPacket) IsHEVCKeyframe() bool {
 	body := packet.Body
+	if packet.IsExHEVC() {
+		return body[0]>>4&0x07 == flv.AVCKeyFrame && packet.isExCodedFrames()
+	}
 	return body[0] == flv.AVCKeyFrame<<4|flv.CodevIDHEVC && body[1] == flv.AVCNALU
 }
 
 // IsHEVCInterframe .
 func (packet *AVPacket) IsHEVCInterframe() bool {
 	body := packet.Body
+	if packet.IsExHEVC() {
+		return body[0]>>4&0x07 == flv.AVCInterFrame && packet.isExCodedFrames()
+	}
 	return body[0] == flv.AVCInterFrame<<4|flv.CodevIDHEVC && body[1] == flv.AVCNALU
 }
 
+// IsExHEVC hevc in enhanced rtmp format
+func (packet *AVPacket) IsExHEVC() bool {
+	return packet.IsHEVC() && packet.Body[0]&flv.VideoExHeader != 0
+}
+
+// isExCodedFrames enhanced rtmp coded frames, with or without composition time
+func (packet *AVPacket) isExCodedFrames() bool {
+	packetType := packet.Body[0] & 0x0F
+	return packetType == flv.PacketTypeCodedFrames || packetType == flv.PacketTypeCodedFramesX
+}
+
 // IsAAC .
 func (packet *AVPacket) IsAAC() bool {
 	body := packet.Body
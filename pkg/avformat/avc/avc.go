@@ -169,6 +169,24 @@ func (parser *AVCParser) ParseExtradata(p []byte) error {
 	return nil
 }
 
+// Extradata returns parsed AVCDecoderConfigurationRecord, nil if not parsed yet
+func (parser *AVCParser) Extradata() *AVCDecoderConfigurationRecord {
+	return parser.extradata
+}
+
+// IsKeyframe whether avcC format nalus contains IDR slice
+func IsKeyframe(avcC []byte) bool {
+	for pos := 0; pos+4 < len(avcC); {
+		lenOfNalu := int(binary.BigEndian.Uint32(avcC[pos:]))
+		pos += 4
+		if avcC[pos]&0x1F == NALUIDRPicture {
+			return true
+		}
+		pos += lenOfNalu
+	}
+	return false
+}
+
 // ----------------------------------------------------
 //	avcC:
 //	---------------
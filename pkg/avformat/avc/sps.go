@@ -0,0 +1,222 @@
+package avc
+
+import (
+	"fmt"
+
+	"gosm/pkg/avformat/bits"
+)
+
+// profile_idc
+const (
+	ProfileBaseline = uint8(66)
+	ProfileMain     = uint8(77)
+	ProfileExtended = uint8(88)
+	ProfileHigh     = uint8(100)
+)
+
+// SPS sequence parameter set, fields in need only, see ISO_IEC_14496-10 7.3.2.1.1
+type SPS struct {
+	ProfileIdc            uint8
+	ConstraintFlags       uint8
+	LevelIdc              uint8
+	ID                    uint32
+	ChromaFormatIdc       uint32
+	Log2MaxFrameNum       uint32
+	PicOrderCntType       uint32
+	Log2MaxPicOrderCntLsb uint32
+	MaxNumRefFrames       uint32
+	FrameMbsOnly          bool
+	Width                 uint32
+	Height                uint32
+	FrameRate             float64 // 0 if timing info absent
+	MaxNumReorderFrames   int     // -1 if bitstream restriction absent
+}
+
+// ParseSPS parse sps nalu with nalu header
+func ParseSPS(nalu []byte) (*SPS, error) {
+	if len(nalu) < 4 || nalu[0]&0x1F != NALUSPS {
+		return nil, fmt.Errorf("AVC: invalid sps nalu, len=%d", len(nalu))
+	}
+
+	r := bits.NewReader(bits.RBSP(nalu[1:]))
+	sps := &SPS{MaxNumReorderFrames: -1}
+	sps.ProfileIdc = uint8(r.ReadBits(8))
+	sps.ConstraintFlags = uint8(r.ReadBits(8))
+	sps.LevelIdc = uint8(r.ReadBits(8))
+	sps.ID = r.ReadUE()
+
+	// chroma format of high profiles, 4:2:0 by default
+	sps.ChromaFormatIdc = 1
+	separateColourPlane := false
+	switch sps.ProfileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		sps.ChromaFormatIdc = r.ReadUE()
+		if sps.ChromaFormatIdc == 3 {
+			separateColourPlane = r.ReadFlag()
+		}
+		r.ReadUE()        // bit_depth_luma_minus8
+		r.ReadUE()        // bit_depth_chroma_minus8
+		r.Skip(1)         // qpprime_y_zero_transform_bypass_flag
+		if r.ReadFlag() { // seq_scaling_matrix_present_flag
+			count := 8
+			if sps.ChromaFormatIdc == 3 {
+				count = 12
+			}
+			for idx := 0; idx < count; idx++ {
+				if !r.ReadFlag() { // seq_scaling_list_present_flag
+					continue
+				}
+				size := 16
+				if idx >= 6 {
+					size = 64
+				}
+				skipScalingList(r, size)
+			}
+		}
+	}
+
+	sps.Log2MaxFrameNum = r.ReadUE() + 4
+	sps.PicOrderCntType = r.ReadUE()
+	switch sps.PicOrderCntType {
+	case 0:
+		sps.Log2MaxPicOrderCntLsb = r.ReadUE() + 4
+	case 1:
+		r.Skip(1)  // delta_pic_order_always_zero_flag
+		r.ReadSE() // offset_for_non_ref_pic
+		r.ReadSE() // offset_for_top_to_bottom_field
+		cycle := r.ReadUE()
+		for idx := uint32(0); idx < cycle && r.Err() == nil; idx++ {
+			r.ReadSE() // offset_for_ref_frame
+		}
+	}
+	sps.MaxNumRefFrames = r.ReadUE()
+	r.Skip(1) // gaps_in_frame_num_value_allowed_flag
+
+	widthInMbs := r.ReadUE() + 1
+	heightInMapUnits := r.ReadUE() + 1
+	sps.FrameMbsOnly = r.ReadFlag()
+	if !sps.FrameMbsOnly {
+		r.Skip(1) // mb_adaptive_frame_field_flag
+	}
+	r.Skip(1) // direct_8x8_inference_flag
+
+	// frame cropping in units of chroma sample
+	var cropLeft, cropRight, cropTop, cropBottom uint32
+	if r.ReadFlag() {
+		cropLeft, cropRight, cropTop, cropBottom = r.ReadUE(), r.ReadUE(), r.ReadUE(), r.ReadUE()
+	}
+	frameHeightFactor := uint32(2)
+	if sps.FrameMbsOnly {
+		frameHeightFactor = 1
+	}
+	cropUnitX, cropUnitY := uint32(1), frameHeightFactor
+	if !separateColourPlane && sps.ChromaFormatIdc != 0 {
+		subWidthC, subHeightC := uint32(2), uint32(1)
+		if sps.ChromaFormatIdc == 1 {
+			subHeightC = 2
+		}
+		if sps.ChromaFormatIdc == 3 {
+			subWidthC = 1
+		}
+		cropUnitX, cropUnitY = subWidthC, subHeightC*frameHeightFactor
+	}
+	sps.Width = widthInMbs*16 - cropUnitX*(cropLeft+cropRight)
+	sps.Height = heightInMapUnits*16*frameHeightFactor - cropUnitY*(cropTop+cropBottom)
+
+	if r.ReadFlag() { // vui_parameters_present_flag
+		parseVUI(r, sps)
+	}
+	if err := r.Err(); err != nil {
+		return nil, fmt.Errorf("AVC: parse sps error, %v", err)
+	}
+	return sps, nil
+}
+
+// ReorderFrames max frames preceding any frame in decoding order and following it in output order,
+// returns false if unknown
+func (sps *SPS) ReorderFrames() (int, bool) {
+	switch {
+	case sps.MaxNumReorderFrames >= 0:
+		return sps.MaxNumReorderFrames, true
+	case sps.ProfileIdc == ProfileBaseline, sps.PicOrderCntType == 2:
+		// no b slices, or output order same as decoding order
+		return 0, true
+	}
+	return 0, false
+}
+
+// parse vui parameters for timing & bitstream restriction, see ISO_IEC_14496-10 E.1.1
+func parseVUI(r *bits.Reader, sps *SPS) {
+	if r.ReadFlag() { // aspect_ratio_info_present_flag
+		if r.ReadBits(8) == 255 { // aspect_ratio_idc: Extended_SAR
+			r.Skip(32) // sar_width & sar_height
+		}
+	}
+	if r.ReadFlag() { // overscan_info_present_flag
+		r.Skip(1) // overscan_appropriate_flag
+	}
+	if r.ReadFlag() { // video_signal_type_present_flag
+		r.Skip(4)         // video_format & video_full_range_flag
+		if r.ReadFlag() { // colour_description_present_flag
+			r.Skip(24) // colour_primaries & transfer_characteristics & matrix_coefficients
+		}
+	}
+	if r.ReadFlag() { // chroma_loc_info_present_flag
+		r.ReadUE() // chroma_sample_loc_type_top_field
+		r.ReadUE() // chroma_sample_loc_type_bottom_field
+	}
+	if r.ReadFlag() { // timing_info_present_flag
+		numUnitsInTick := r.ReadBits(32)
+		timeScale := r.ReadBits(32)
+		r.Skip(1) // fixed_frame_rate_flag
+		if numUnitsInTick != 0 {
+			sps.FrameRate = float64(timeScale) / float64(2*numUnitsInTick)
+		}
+	}
+	nalHRD := r.ReadFlag()
+	if nalHRD {
+		skipHRD(r)
+	}
+	vclHRD := r.ReadFlag()
+	if vclHRD {
+		skipHRD(r)
+	}
+	if nalHRD || vclHRD {
+		r.Skip(1) // low_delay_hrd_flag
+	}
+	r.Skip(1)         // pic_struct_present_flag
+	if r.ReadFlag() { // bitstream_restriction_flag
+		r.Skip(1)  // motion_vectors_over_pic_boundaries_flag
+		r.ReadUE() // max_bytes_per_pic_denom
+		r.ReadUE() // max_bits_per_mb_denom
+		r.ReadUE() // log2_max_mv_length_horizontal
+		r.ReadUE() // log2_max_mv_length_vertical
+		sps.MaxNumReorderFrames = int(r.ReadUE())
+		r.ReadUE() // max_dec_frame_buffering
+	}
+}
+
+// skip hrd parameters, see ISO_IEC_14496-10 E.1.2
+func skipHRD(r *bits.Reader) {
+	cpbCnt := r.ReadUE() + 1
+	r.Skip(8) // bit_rate_scale & cpb_size_scale
+	for idx := uint32(0); idx < cpbCnt && r.Err() == nil; idx++ {
+		r.ReadUE() // bit_rate_value_minus1
+		r.ReadUE() // cpb_size_value_minus1
+		r.Skip(1)  // cbr_flag
+	}
+	r.Skip(20) // delay & offset lengths
+}
+
+// skip scaling list, see ISO_IEC_14496-10 7.3.2.1.1.1
+func skipScalingList(r *bits.Reader, size int) {
+	lastScale, nextScale := int32(8), int32(8)
+	for idx := 0; idx < size && r.Err() == nil; idx++ {
+		if nextScale != 0 {
+			nextScale = (lastScale + r.ReadSE() + 256) % 256
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+}
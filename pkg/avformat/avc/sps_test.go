@@ -0,0 +1,240 @@
+package avc
+
+import (
+	"bytes"
+	"testing"
+)
+
+// bitWriter msb-first writer building sps of test
+type bitWriter struct {
+	p   []byte
+	pos int
+}
+
+func (w *bitWriter) bits(v uint32, n int) {
+	for idx := n - 1; idx >= 0; idx-- {
+		if w.pos%8 == 0 {
+			w.p = append(w.p, 0)
+		}
+		w.p[len(w.p)-1] |= byte(v>>uint(idx)&0x01) << (7 - uint(w.pos%8))
+		w.pos++
+	}
+}
+
+func (w *bitWriter) flag(b bool) {
+	if b {
+		w.bits(1, 1)
+	} else {
+		w.bits(0, 1)
+	}
+}
+
+func (w *bitWriter) ue(v uint32) {
+	v++
+	n := 0
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+	w.bits(0, n)
+	w.bits(v, n+1)
+}
+
+// nalu with rbsp trailing bits and emulation prevention
+func (w *bitWriter) nalu(header byte) []byte {
+	w.bits(1, 1)
+	nalu := []byte{header}
+	zeros := 0
+	for _, b := range w.p {
+		if zeros >= 2 && b <= 0x03 {
+			nalu = append(nalu, 0x03)
+			zeros = 0
+		}
+		if b == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		nalu = append(nalu, b)
+	}
+	return nalu
+}
+
+type spsParams struct {
+	profile    uint8
+	constraint uint8
+	level      uint8
+	id         uint32
+	pocType    uint32
+	widthMbs   uint32
+	heightMbs  uint32
+	cropBottom uint32
+	vui        bool
+	timeScale  uint32 // num_units_in_tick 1
+	reorder    int    // -1 if bitstream restriction absent
+}
+
+func buildSPS(params spsParams) []byte {
+	w := &bitWriter{}
+	w.bits(uint32(params.profile), 8)
+	w.bits(uint32(params.constraint), 8)
+	w.bits(uint32(params.level), 8)
+	w.ue(params.id)
+	if params.profile == ProfileHigh {
+		w.ue(1)       // chroma_format_idc
+		w.ue(0)       // bit_depth_luma_minus8
+		w.ue(0)       // bit_depth_chroma_minus8
+		w.flag(false) // qpprime_y_zero_transform_bypass_flag
+		w.flag(false) // seq_scaling_matrix_present_flag
+	}
+	w.ue(0) // log2_max_frame_num_minus4
+	w.ue(params.pocType)
+	if params.pocType == 0 {
+		w.ue(2) // log2_max_pic_order_cnt_lsb_minus4
+	}
+	w.ue(4)       // max_num_ref_frames
+	w.flag(false) // gaps_in_frame_num_value_allowed_flag
+	w.ue(params.widthMbs - 1)
+	w.ue(params.heightMbs - 1)
+	w.flag(true) // frame_mbs_only_flag
+	w.flag(true) // direct_8x8_inference_flag
+	w.flag(params.cropBottom > 0)
+	if params.cropBottom > 0 {
+		w.ue(0)
+		w.ue(0)
+		w.ue(0)
+		w.ue(params.cropBottom)
+	}
+	w.flag(params.vui)
+	if params.vui {
+		w.flag(true) // aspect_ratio_info_present_flag
+		w.bits(1, 8) // aspect_ratio_idc: 1:1
+		w.flag(false)
+		w.flag(false)
+		w.flag(false)
+		w.flag(params.timeScale > 0)
+		if params.timeScale > 0 {
+			w.bits(1, 32)
+			w.bits(params.timeScale, 32)
+			w.flag(true) // fixed_frame_rate_flag
+		}
+		w.flag(false) // nal_hrd_parameters_present_flag
+		w.flag(false) // vcl_hrd_parameters_present_flag
+		w.flag(false) // pic_struct_present_flag
+		w.flag(params.reorder >= 0)
+		if params.reorder >= 0 {
+			w.flag(true)
+			w.ue(2)
+			w.ue(1)
+			w.ue(16)
+			w.ue(16)
+			w.ue(uint32(params.reorder))
+			w.ue(4) // max_dec_frame_buffering
+		}
+	}
+	return w.nalu(0x67)
+}
+
+func TestParseSPS(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     spsParams
+		width      uint32
+		height     uint32
+		frameRate  float64
+		reorder    int
+		reorderSet bool
+	}{
+		{
+			name:       "baseline without vui",
+			params:     spsParams{profile: ProfileBaseline, level: 30, widthMbs: 40, heightMbs: 30, reorder: -1},
+			width:      640,
+			height:     480,
+			reorder:    0,
+			reorderSet: true,
+		},
+		{
+			name: "high with bitstream restriction",
+			params: spsParams{profile: ProfileHigh, level: 40, widthMbs: 120, heightMbs: 68, cropBottom: 4,
+				vui: true, timeScale: 50, reorder: 2},
+			width:      1920,
+			height:     1080,
+			frameRate:  25,
+			reorder:    2,
+			reorderSet: true,
+		},
+		{
+			name:       "main without bitstream restriction",
+			params:     spsParams{profile: ProfileMain, level: 31, widthMbs: 80, heightMbs: 45, vui: true, timeScale: 60, reorder: -1},
+			width:      1280,
+			height:     720,
+			frameRate:  30,
+			reorder:    0,
+			reorderSet: false,
+		},
+		{
+			name:       "main of poc type 2",
+			params:     spsParams{profile: ProfileMain, level: 31, pocType: 2, widthMbs: 80, heightMbs: 45, reorder: -1},
+			width:      1280,
+			height:     720,
+			reorder:    0,
+			reorderSet: true,
+		},
+		{
+			name:       "high without reordering",
+			params:     spsParams{profile: ProfileHigh, level: 31, widthMbs: 80, heightMbs: 45, vui: true, reorder: 0},
+			width:      1280,
+			height:     720,
+			reorder:    0,
+			reorderSet: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sps, err := ParseSPS(buildSPS(test.params))
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if sps.ProfileIdc != test.params.profile || sps.Width != test.width || sps.Height != test.height ||
+				sps.FrameRate != test.frameRate {
+				t.Fatalf("profile %d, %dx%d, %v fps, expected %d, %dx%d, %v fps", sps.ProfileIdc, sps.Width, sps.Height,
+					sps.FrameRate, test.params.profile, test.width, test.height, test.frameRate)
+			}
+			if reorder, ok := sps.ReorderFrames(); reorder != test.reorder || ok != test.reorderSet {
+				t.Fatalf("reorder frames %d %v, expected %d %v", reorder, ok, test.reorder, test.reorderSet)
+			}
+		})
+	}
+}
+
+func TestParseSPSEmulationPrevention(t *testing.T) {
+	// zero constraint flags & level, leading zeros of exp-golomb id emulate a start code
+	nalu := buildSPS(spsParams{profile: ProfileMain, id: 255, widthMbs: 80, heightMbs: 45, vui: true, reorder: 1})
+	if !bytes.Contains(nalu, []byte{0x00, 0x00, 0x03}) {
+		t.Fatalf("sps %x, expected emulation prevention", nalu)
+	}
+	sps, err := ParseSPS(nalu)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if reorder, ok := sps.ReorderFrames(); sps.ID != 255 || sps.Width != 1280 || reorder != 1 || !ok {
+		t.Fatalf("id %d, width %d, reorder frames %d %v", sps.ID, sps.Width, reorder, ok)
+	}
+}
+
+func TestParseSPSInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		nalu []byte
+	}{
+		{name: "too short", nalu: []byte{0x67, 0x42, 0x00}},
+		{name: "pps", nalu: []byte{0x68, 0xce, 0x3c, 0x80}},
+		{name: "truncated", nalu: buildSPS(spsParams{profile: ProfileHigh, level: 40, widthMbs: 120, heightMbs: 68})[:5]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if sps, err := ParseSPS(test.nalu); err == nil {
+				t.Fatalf("sps %+v, expected error", sps)
+			}
+		})
+	}
+}
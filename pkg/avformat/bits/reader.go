@@ -0,0 +1,107 @@
+package bits
+
+import (
+	"fmt"
+)
+
+// Reader msb-first bit reader with exp-golomb codes of h.264/h.265 syntax,
+// reading beyond the end returns zero and the error is kept for Err()
+type Reader struct {
+	p   []byte
+	pos int // bit position
+	err error
+}
+
+// NewReader .
+func NewReader(p []byte) *Reader {
+	return &Reader{p: p, pos: 0, err: nil}
+}
+
+// RBSP remove emulation prevention bytes, 0x000003 -> 0x0000
+func RBSP(p []byte) []byte {
+	rbsp := make([]byte, 0, len(p))
+	zeros := 0
+	for _, b := range p {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		if b == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, b)
+	}
+	return rbsp
+}
+
+// Err returns the first error occurred
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// ReadBit u(1)
+func (r *Reader) ReadBit() uint8 {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.p)*8 {
+		r.err = fmt.Errorf("Bits: read out of range, len=%d", len(r.p))
+		return 0
+	}
+	bit := r.p[r.pos/8] >> (7 - r.pos%8) & 0x01
+	r.pos++
+	return bit
+}
+
+// ReadFlag u(1) as bool
+func (r *Reader) ReadFlag() bool {
+	return r.ReadBit() == 1
+}
+
+// ReadBits u(n), n <= 32
+func (r *Reader) ReadBits(n int) uint32 {
+	v := uint32(0)
+	for idx := 0; idx < n; idx++ {
+		v = v<<1 | uint32(r.ReadBit())
+	}
+	return v
+}
+
+// Skip n bits
+func (r *Reader) Skip(n int) {
+	if r.err != nil {
+		return
+	}
+	if r.pos+n > len(r.p)*8 {
+		r.err = fmt.Errorf("Bits: skip out of range, len=%d", len(r.p))
+		return
+	}
+	r.pos += n
+}
+
+// ReadUE unsigned exp-golomb code, ue(v)
+func (r *Reader) ReadUE() uint32 {
+	zeros := 0
+	for r.ReadBit() == 0 {
+		if r.err != nil {
+			return 0
+		}
+		zeros++
+		if zeros > 31 {
+			r.err = fmt.Errorf("Bits: invalid exp-golomb code")
+			return 0
+		}
+	}
+	return uint32(1)<<zeros - 1 + r.ReadBits(zeros)
+}
+
+// ReadSE signed exp-golomb code, se(v)
+func (r *Reader) ReadSE() int32 {
+	v := r.ReadUE()
+	if v%2 == 1 {
+		return int32(v/2 + 1)
+	}
+	return -int32(v / 2)
+}
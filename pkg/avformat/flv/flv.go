@@ -98,6 +98,34 @@ const (
 	AVCEndOfSeq  = uint8(2)
 )
 
+// enhanced rtmp video, see https://github.com/veovera/enhanced-rtmp
+//
+// IsExHeader [1b] | FrameType [3b] | PacketType [4b] | FourCC [32b] | ...
+const (
+	// IsExHeader flag of the first byte, FourCC follows instead of CodecID
+	VideoExHeader = uint8(0x80)
+
+	// 0: sequence start, decoder configuration record
+	// 1: coded frames, SI24 composition time + data
+	// 2: sequence end
+	// 3: coded frames X, composition time implicitly zero
+	// 4: metadata
+	// 5: mpeg2-ts sequence start
+	PacketTypeSequenceStart        = uint8(0)
+	PacketTypeCodedFrames          = uint8(1)
+	PacketTypeSequenceEnd          = uint8(2)
+	PacketTypeCodedFramesX         = uint8(3)
+	PacketTypeMetadata             = uint8(4)
+	PacketTypeMPEG2TSSequenceStart = uint8(5)
+)
+
+// video fourcc of enhanced rtmp
+var (
+	FourCCAV1  = [4]byte{'a', 'v', '0', '1'}
+	FourCCVP9  = [4]byte{'v', 'p', '0', '9'}
+	FourCCHEVC = [4]byte{'h', 'v', 'c', '1'}
+)
+
 //
 var (
 	SoundFormat = map[byte]string{
@@ -203,9 +231,32 @@ func (tag *VideoTagData) Bytes() []byte {
 	buf := new(bytes.Buffer)
 	buf.WriteByte(tag.FrameType<<4 | tag.CodecID)
 	buf.WriteByte(tag.AVCPacketType)
-	buf.WriteByte(byte(tag.CompositionTime))
+	buf.WriteByte(byte(tag.CompositionTime >> 16)) // SI24, big-endian
 	buf.WriteByte(byte(tag.CompositionTime >> 8))
-	buf.WriteByte(byte(tag.CompositionTime >> 16))
+	buf.WriteByte(byte(tag.CompositionTime))
+	buf.Write(tag.Data)
+	return buf.Bytes()
+}
+
+// ExVideoTagData enhanced rtmp video tag data
+type ExVideoTagData struct {
+	FrameType       uint8
+	PacketType      uint8
+	FourCC          [4]byte
+	CompositionTime int32 // PacketTypeCodedFrames only
+	Data            []byte
+}
+
+// Bytes .
+func (tag *ExVideoTagData) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(VideoExHeader | tag.FrameType<<4 | tag.PacketType)
+	buf.Write(tag.FourCC[:])
+	if tag.PacketType == PacketTypeCodedFrames {
+		buf.WriteByte(byte(tag.CompositionTime >> 16)) // SI24, big-endian
+		buf.WriteByte(byte(tag.CompositionTime >> 8))
+		buf.WriteByte(byte(tag.CompositionTime))
+	}
 	buf.Write(tag.Data)
 	return buf.Bytes()
 }
@@ -283,6 +334,7 @@ func ParseAVCVideoPackage(p []byte) (*VideoTagData, error) {
 	for idx := 0; idx < 3; idx++ {
 		tagData.CompositionTime = tagData.CompositionTime<<8 + int32(p[2+idx])
 	}
+	tagData.CompositionTime = tagData.CompositionTime << 8 >> 8 // SI24, sign extended
 	tagData.Data = p[5:]
 
 	return tagData, nil
@@ -0,0 +1,274 @@
+package hevc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"gosm/pkg/avformat/bits"
+)
+
+// H.265/HEVC
+//
+// nalu header:
+//   +---------------+---------------+
+//   |0|1|2|3|4|5|6|7|0|1|2|3|4|5|6|7|
+//   +-+-------------+-+-+-+-+-+-+-+-+
+//   |F|   Type    |  LayerId  | TID |
+//   +-------------+-----------------+
+//   F:       1bit, forbidden_zero_bit
+//   Type:    6bit, nal unit type
+//   LayerId: 6bit, nuh_layer_id
+//   TID:     3bit, nuh_temporal_id_plus1
+
+// nal unit type, see ISO_IEC_23008-2 table 7-1
+const (
+	NALUTrailN     = uint8(0)
+	NALUTrailR     = uint8(1)
+	NALUBLAWLP     = uint8(16) // 16 - 23 IRAP, random access point
+	NALUBLAWRADL   = uint8(17)
+	NALUBLANLP     = uint8(18)
+	NALUIDRWRADL   = uint8(19)
+	NALUIDRNLP     = uint8(20)
+	NALUCRA        = uint8(21)
+	NALUIRAPRsv23  = uint8(23)
+	NALUVPS        = uint8(32)
+	NALUSPS        = uint8(33)
+	NALUPPS        = uint8(34)
+	NALUAUD        = uint8(35)
+	NALUEOS        = uint8(36)
+	NALUEOB        = uint8(37)
+	NALUFD         = uint8(38)
+	NALUSEIPrefix  = uint8(39)
+	NALUSEISuffix  = uint8(40)
+	NALUReserved47 = uint8(47)
+)
+
+// NALUType nal unit type from the first byte of nalu header
+func NALUType(b byte) uint8 {
+	return b >> 1 & 0x3F
+}
+
+// IsIRAP intra random access point picture, keyframe
+func IsIRAP(naluType uint8) bool {
+	return naluType >= NALUBLAWLP && naluType <= NALUIRAPRsv23
+}
+
+// IsKeyframe whether hvcC format nalus contains IRAP slice
+func IsKeyframe(hvcC []byte) bool {
+	for pos := 0; pos+4 < len(hvcC); {
+		lenOfNalu := int(binary.BigEndian.Uint32(hvcC[pos:]))
+		pos += 4
+		if IsIRAP(NALUType(hvcC[pos])) {
+			return true
+		}
+		pos += lenOfNalu
+	}
+	return false
+}
+
+// SPS sequence parameter set, fields in need only, see ISO_IEC_23008-2 7.3.2.2
+type SPS struct {
+	MaxSubLayersMinus1      uint8
+	TemporalIDNesting       bool
+	GeneralProfileTierLevel [12]byte // general profile space ... general level idc, 96 bits
+	ChromaFormatIdc         uint32
+	BitDepthLumaMinus8      uint32
+	BitDepthChromaMinus8    uint32
+	Width                   uint32
+	Height                  uint32
+	MaxNumReorderPics       int // of the highest sub layer
+}
+
+// ParseSPS parse sps nalu with nalu header
+func ParseSPS(nalu []byte) (*SPS, error) {
+	if len(nalu) < 16 || NALUType(nalu[0]) != NALUSPS {
+		return nil, fmt.Errorf("HEVC: invalid sps nalu, len=%d", len(nalu))
+	}
+
+	r := bits.NewReader(bits.RBSP(nalu[2:]))
+	sps := &SPS{}
+	r.Skip(4) // sps_video_parameter_set_id
+	sps.MaxSubLayersMinus1 = uint8(r.ReadBits(3))
+	sps.TemporalIDNesting = r.ReadFlag()
+
+	// profile_tier_level, general part
+	for idx := range sps.GeneralProfileTierLevel {
+		sps.GeneralProfileTierLevel[idx] = byte(r.ReadBits(8))
+	}
+	subLayers := int(sps.MaxSubLayersMinus1)
+	profilePresent := make([]bool, subLayers)
+	levelPresent := make([]bool, subLayers)
+	for idx := 0; idx < subLayers; idx++ {
+		profilePresent[idx] = r.ReadFlag()
+		levelPresent[idx] = r.ReadFlag()
+	}
+	if subLayers > 0 {
+		r.Skip(2 * (8 - subLayers)) // reserved_zero_2bits
+	}
+	for idx := 0; idx < subLayers; idx++ {
+		if profilePresent[idx] {
+			r.Skip(88)
+		}
+		if levelPresent[idx] {
+			r.Skip(8)
+		}
+	}
+
+	r.ReadUE() // sps_seq_parameter_set_id
+	sps.ChromaFormatIdc = r.ReadUE()
+	if sps.ChromaFormatIdc == 3 {
+		r.Skip(1) // separate_colour_plane_flag
+	}
+	sps.Width = r.ReadUE()
+	sps.Height = r.ReadUE()
+	if r.ReadFlag() { // conformance_window_flag
+		left, right, top, bottom := r.ReadUE(), r.ReadUE(), r.ReadUE(), r.ReadUE()
+		subWidthC, subHeightC := uint32(1), uint32(1)
+		switch sps.ChromaFormatIdc {
+		case 1:
+			subWidthC, subHeightC = 2, 2
+		case 2:
+			subWidthC = 2
+		}
+		sps.Width -= subWidthC * (left + right)
+		sps.Height -= subHeightC * (top + bottom)
+	}
+	sps.BitDepthLumaMinus8 = r.ReadUE()
+	sps.BitDepthChromaMinus8 = r.ReadUE()
+	r.ReadUE() // log2_max_pic_order_cnt_lsb_minus4
+
+	// sub layer ordering info, all layers or the highest only
+	first := subLayers
+	if r.ReadFlag() { // sps_sub_layer_ordering_info_present_flag
+		first = 0
+	}
+	for idx := first; idx <= subLayers; idx++ {
+		r.ReadUE() // sps_max_dec_pic_buffering_minus1
+		sps.MaxNumReorderPics = int(r.ReadUE())
+		r.ReadUE() // sps_max_latency_increase_plus1
+	}
+
+	if err := r.Err(); err != nil {
+		return nil, fmt.Errorf("HEVC: parse sps error, %v", err)
+	}
+	return sps, nil
+}
+
+// ----------------------------------------------------
+// configurationVersion								[ 8b]
+// general_profile_space							[ 2b]
+// general_tier_flag									[ 1b]
+// general_profile_idc								[ 5b]
+// general_profile_compatibility_flags	[32b]
+// general_constraint_indicator_flags	[48b]
+// general_level_idc									[ 8b]
+// reserved														[ 4b] '1111'
+// min_spatial_segmentation_idc				[12b]
+// reserved														[ 6b] '111111'
+// parallelismType										[ 2b]
+// reserved														[ 6b] '111111'
+// chromaFormat												[ 2b]
+// reserved														[ 5b] '11111'
+// bitDepthLumaMinus8									[ 3b]
+// reserved														[ 5b] '11111'
+// bitDepthChromaMinus8								[ 3b]
+// avgFrameRate												[16b]
+// constantFrameRate									[ 2b]
+// numTemporalLayers									[ 3b]
+// temporalIdNested										[ 1b]
+// lengthSizeMinusOne									[ 2b]
+// numOfArrays												[ 8b]
+// -----loop----
+// array_completeness									[ 1b]
+// reserved														[ 1b] 0
+// NAL_unit_type											[ 6b]
+// numNalus														[16b]
+// nalUnitLength											[16b]
+// nalUnit														[n*8b]
+// -----end-----
+// ----------------------------------------------------
+
+// HEVCDecoderConfigurationRecord, see ISO_IEC_14496-15 8.3.3.1 section
+type HEVCDecoderConfigurationRecord struct {
+	Vps []byte
+	Sps []byte
+	Pps []byte
+}
+
+// Bytes build record with general profile & format of sps
+func (cfg *HEVCDecoderConfigurationRecord) Bytes() ([]byte, error) {
+	if len(cfg.Vps) < 2 || len(cfg.Pps) < 2 {
+		return nil, fmt.Errorf("HEVC: VPS or PPS is empty")
+	}
+	sps, err := ParseSPS(cfg.Sps)
+	if err != nil {
+		return nil, err
+	}
+
+	bw := bytes.NewBuffer([]byte{})
+	bw.WriteByte(0x01) // configurationVersion
+	bw.Write(sps.GeneralProfileTierLevel[:])
+	binary.Write(bw, binary.BigEndian, uint16(0xF000)) // min_spatial_segmentation_idc: 0
+	bw.WriteByte(0xFC)                                 // parallelismType: unknown
+	bw.WriteByte(0xFC | byte(sps.ChromaFormatIdc&0x03))
+	bw.WriteByte(0xF8 | byte(sps.BitDepthLumaMinus8&0x07))
+	bw.WriteByte(0xF8 | byte(sps.BitDepthChromaMinus8&0x07))
+	binary.Write(bw, binary.BigEndian, uint16(0)) // avgFrameRate: unspecified
+
+	// constantFrameRate: 0, numTemporalLayers, temporalIdNested, lengthSizeMinusOne: 3
+	temporalIDNested := byte(0)
+	if sps.TemporalIDNesting {
+		temporalIDNested = 1
+	}
+	bw.WriteByte((sps.MaxSubLayersMinus1+1)&0x07<<3 | temporalIDNested<<2 | 0x03)
+
+	bw.WriteByte(0x03) // numOfArrays
+	for _, nalu := range [][]byte{cfg.Vps, cfg.Sps, cfg.Pps} {
+		bw.WriteByte(0x80 | NALUType(nalu[0])) // array_completeness: 1
+		binary.Write(bw, binary.BigEndian, uint16(1))
+		binary.Write(bw, binary.BigEndian, uint16(len(nalu)))
+		bw.Write(nalu)
+	}
+	return bw.Bytes(), nil
+}
+
+// ParseExtradata parse the first VPS, SPS & PPS of HEVCDecoderConfigurationRecord
+func ParseExtradata(p []byte) (*HEVCDecoderConfigurationRecord, error) {
+	if len(p) < 23 {
+		return nil, fmt.Errorf("HEVC: invalid length to parse extradata, len=%d", len(p))
+	}
+
+	cfg := &HEVCDecoderConfigurationRecord{}
+	numOfArrays := int(p[22])
+	pos := 23
+	for idx := 0; idx < numOfArrays; idx++ {
+		if pos+3 > len(p) {
+			return nil, fmt.Errorf("HEVC: extradata truncated, len=%d", len(p))
+		}
+		naluType := p[pos] & 0x3F
+		numNalus := int(binary.BigEndian.Uint16(p[pos+1:]))
+		pos += 3
+		for n := 0; n < numNalus; n++ {
+			if pos+2 > len(p) {
+				return nil, fmt.Errorf("HEVC: extradata truncated, len=%d", len(p))
+			}
+			lenOfNalu := int(binary.BigEndian.Uint16(p[pos:]))
+			pos += 2
+			if pos+lenOfNalu > len(p) {
+				return nil, fmt.Errorf("HEVC: extradata truncated, len=%d", len(p))
+			}
+			nalu := p[pos : pos+lenOfNalu]
+			pos += lenOfNalu
+			switch {
+			case naluType == NALUVPS && cfg.Vps == nil:
+				cfg.Vps = nalu
+			case naluType == NALUSPS && cfg.Sps == nil:
+				cfg.Sps = nalu
+			case naluType == NALUPPS && cfg.Pps == nil:
+				cfg.Pps = nalu
+			}
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,99 @@
+package avformat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+
+	"gosm/pkg/avformat/aac"
+	"gosm/pkg/avformat/avc"
+	"gosm/pkg/avformat/flv"
+	"gosm/pkg/avformat/hevc"
+	"gosm/pkg/protocol/amf"
+)
+
+// Marshal encodes metadata as 'onMetaData' data message by amf0,
+// prefixed by '@setDataFrame' if publishing
+func (md *MetaData) Marshal(setDataFrame bool) ([]byte, error) {
+	amf := &amf.AMF0{}
+	buf := new(bytes.Buffer)
+
+	// convert metadata from struct to map
+	metadata, err := json.Marshal(md)
+	if err != nil {
+		return nil, err
+	}
+	mapMetadata := make(map[string]interface{})
+	json.Unmarshal(metadata, &mapMetadata)
+
+	// convert from map to amf0
+	if setDataFrame {
+		if _, err := amf.WriteString(buf, "@setDataFrame"); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := amf.WriteString(buf, "onMetaData"); err != nil {
+		return nil, err
+	}
+	if _, err := amf.WriteTo(buf, &mapMetadata); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Update fills metadata by sequence header, video size & codec from SPS,
+// audio sample rate & channels from AudioSpecificConfig, ignored if others
+func (md *MetaData) Update(packet *AVPacket) error {
+	if len(packet.Body) < 4 || (packet.IsVideo() && len(packet.Body) < 11) {
+		return nil
+	}
+
+	switch {
+	case packet.IsAVC() && packet.IsAVCSeqHeader():
+		parser := avc.NewAVCParser(nil)
+		if err := parser.ParseExtradata(packet.Body[5:]); err != nil {
+			return err
+		}
+		sps, err := avc.ParseSPS(parser.Extradata().Sps)
+		if err != nil {
+			return err
+		}
+		md.VideoCodecID = float64(flv.CodevIDAVC)
+		md.Width = int(sps.Width)
+		md.Height = int(sps.Height)
+		if sps.FrameRate > 0 {
+			md.FrameRate = int(sps.FrameRate + 0.5)
+		}
+	case packet.IsHEVC() && packet.IsHEVCSeqHeader():
+		// enhanced rtmp: videocodecid as fourcc number
+		codecID := float64(flv.CodevIDHEVC)
+		if packet.IsExHEVC() {
+			codecID = float64(binary.BigEndian.Uint32(flv.FourCCHEVC[:]))
+		}
+		cfg, err := hevc.ParseExtradata(packet.Body[5:])
+		if err != nil {
+			return err
+		}
+		sps, err := hevc.ParseSPS(cfg.Sps)
+		if err != nil {
+			return err
+		}
+		md.VideoCodecID = codecID
+		md.Width = int(sps.Width)
+		md.Height = int(sps.Height)
+	case packet.IsAudio() && packet.IsAACSeqHeader():
+		parser := aac.NewAACParser(nil)
+		if err := parser.ParseAudioSpecificConfig(packet.Body[2:]); err != nil {
+			return err
+		}
+		asc := parser.AudioSpecificConfig()
+		md.AudioCodecID = float64(flv.SoundFormatAAC)
+		if int(asc.SamplingFrequencyIndex) < len(aac.AACSampleRate) {
+			md.AudioSampleRate = aac.AACSampleRate[asc.SamplingFrequencyIndex]
+		}
+		md.AudioSampleSize = 16
+		md.AudioChannels = int(asc.ChannelConfiguration)
+		md.Stereo = asc.ChannelConfiguration >= 2
+	}
+	return nil
+}
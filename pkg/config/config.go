@@ -3,19 +3,37 @@ package config
 import (
 	"encoding/json"
 	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 const (
 	Version = "0.0.1"
 	HTTPFLV = "GOSM/flv_0.0.1"
 	HLS     = "GOSM/hls_0.0.1"
+	RTSP    = "GOSM/rtsp_0.0.1"
+	API     = "GOSM/api_0.0.1"
 )
 
+// DefaultVhost vhost of hosts not configured by any app
+const DefaultVhost = "__defaultVhost__"
+
 type Config struct {
-	RTMP    RTMPCfg    `json:"rtmp"`
-	HTTPFLV HTTPFlvCfg `json:"http_flv"`
-	HLS     HLSCfg     `json:"hls"`
-	RTP     RTP        `json:"rtp"`
+	RTMP       RTMPCfg       `json:"rtmp"`
+	HTTPFLV    HTTPFlvCfg    `json:"http_flv"`
+	HLS        HLSCfg        `json:"hls"`
+	RTSP       RTSPCfg       `json:"rtsp"`
+	RTP        RTP           `json:"rtp"`
+	Hooks      HookCfg       `json:"hooks"`
+	API        APICfg        `json:"api"`
+	Relay      RelayCfg      `json:"relay"`
+	Forward    ForwardCfg    `json:"forward"`
+	Record     RecordCfg     `json:"record"`
+	Subscriber SubscriberCfg `json:"subscriber"`
+	Room       RoomCfg       `json:"room"`
+	Apps       []AppCfg      `json:"apps"` // per-app settings, the global ones for apps not configured
 
 	LogLevel     uint8 `json:"log_level"`
 	MachineID    int64 `json:"machine_id"`
@@ -23,9 +41,31 @@ type Config struct {
 }
 
 type RTMPCfg struct {
-	Port          string `json:"port"`
-	GopSize       uint8  `json:"gop_size"`
-	AVReadTimeout int64  `json:"read_timeout"`
+	Port          string   `json:"port"`
+	GopSize       uint8    `json:"gop_size"`
+	GopStrategy   string   `json:"gop_strategy"`     // join strategy of apps not configured, see AppCfg
+	GopMaxDur     int64    `json:"gop_max_duration"` // milliseconds of av packets cached at most, 0 unlimited
+	GopMaxBytes   int      `json:"gop_max_bytes"`    // bytes of av packets cached at most, 0 unlimited
+	AVReadTimeout int64    `json:"read_timeout"`
+	PingInterval  int64    `json:"ping_interval"` // seconds between ping requests & acknowledgement checks, 0 to disable both
+	AckTimeout    int64    `json:"ack_timeout"`   // seconds before closing peer stopped acknowledging, 0 to disable
+	TLS           RTMPSCfg `json:"tls"`
+	Auth          AuthCfg  `json:"auth"`
+}
+
+type RTMPSCfg struct {
+	Enable   bool   `json:"enable"`
+	Port     string `json:"port"`
+	CertFile string `json:"cert_file"` // certificate chain in PEM
+	KeyFile  string `json:"key_file"`  // private key in PEM
+}
+
+type AuthCfg struct {
+	Enable      bool              `json:"enable"`
+	PublishKeys map[string]string `json:"publish_keys"` // 'app/stream' <=> key, query 'key'
+	Tokens      []string          `json:"tokens"`       // static tokens, query 'token'
+	Secret      string            `json:"secret"`       // hmac secret of signed url, query 'expire' & 'sign'
+	Play        bool              `json:"play"`         // authenticate playing as well
 }
 
 type HTTPFlvCfg struct {
@@ -42,11 +82,38 @@ type HLSCfg struct {
 	TsWindow   int    `json:"ts_window"`
 }
 
+type RTSPCfg struct {
+	Enable     bool   `json:"enable"`
+	Port       string `json:"port"`
+	RTPPortMin int    `json:"rtp_port_min"`
+	RTPPortMax int    `json:"rtp_port_max"`
+}
+
 type RTP struct {
-	Enable      bool     `json:"enable"`
-	Remote      string   `json:"remote"`
-	Ports       []string `json:"ports"`
-	ReadTimeout int64    `json:"read_timeout"`
+	Enable        bool              `json:"enable"`
+	App           string            `json:"app"` // app name of published rooms
+	Ports         []string          `json:"ports"`
+	StreamName    string            `json:"stream_name"` // naming rule, placeholders: {ip}, {port}, {ssrc}
+	SSRCMap       map[string]string `json:"ssrc_map"`    // ssrc <=> stream name, prior to naming rule
+	ReadTimeout   int64             `json:"read_timeout"`
+	JitterLatency int64             `json:"jitter_latency"` // milliseconds to wait for reordered packets
+}
+
+type HookCfg struct {
+	Enable       bool     `json:"enable"`
+	Timeout      int64    `json:"timeout"` // milliseconds of one callback
+	OnConnect    []string `json:"on_connect"`
+	OnPublish    []string `json:"on_publish"`
+	OnUnpublish  []string `json:"on_unpublish"`
+	OnPlay       []string `json:"on_play"`
+	OnStop       []string `json:"on_stop"`
+	OnRecordDone []string `json:"on_record_done"`
+}
+
+type APICfg struct {
+	Enable bool   `json:"enable"`
+	Port   string `json:"port"`
+	Token  string `json:"token"` // required as 'Authorization: Bearer {token}' if not empty
 }
 
 var Global = &Config{}
@@ -54,6 +121,9 @@ var Global = &Config{}
 func init() {
 	data, err := ioutil.ReadFile("../configs/config.json")
 	if err != nil {
+		if isTesting() {
+			return // package tests build their own settings
+		}
 		panic(err)
 	}
 
@@ -61,3 +131,101 @@ func init() {
 		panic(err)
 	}
 }
+
+// isTesting whether running as test binary built by 'go test'
+func isTesting() bool {
+	return strings.HasSuffix(strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe"), ".test")
+}
+
+// Vhost resolves host of request to vhost, default vhost if not configured by any app
+func (cfg *Config) Vhost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, app := range cfg.Apps {
+		if app.Vhost != "" && strings.EqualFold(app.Vhost, host) {
+			return app.Vhost
+		}
+	}
+	return DefaultVhost
+}
+
+// App settings of app, built from the global ones if not configured
+func (cfg *Config) App(vhost string, app string) *AppCfg {
+	for idx := range cfg.Apps {
+		appCfg := &cfg.Apps[idx]
+		appVhost := appCfg.Vhost
+		if appVhost == "" {
+			appVhost = DefaultVhost
+		}
+		if appVhost == vhost && appCfg.App == app {
+			return appCfg
+		}
+	}
+	return &AppCfg{
+		Vhost:       vhost,
+		App:         app,
+		GopSize:     cfg.RTMP.GopSize,
+		GopStrategy: cfg.RTMP.GopStrategy,
+		GopMaxDur:   cfg.RTMP.GopMaxDur,
+		GopMaxBytes: cfg.RTMP.GopMaxBytes,
+		HLS:         cfg.HLS.Enable,
+		Record:      cfg.Record.Enable,
+	}
+}
+
+type AppCfg struct {
+	Vhost       string `json:"vhost"` // default vhost if empty
+	App         string `json:"app"`
+	GopSize     uint8  `json:"gop_size"`
+	GopStrategy string `json:"gop_strategy"`     // joining: 'full' gop_size GOPs, 'last' GOP, 'keyframe' with audio lead-in, or 'none'
+	GopMaxDur   int64  `json:"gop_max_duration"` // milliseconds of av packets cached at most, 0 unlimited
+	GopMaxBytes int    `json:"gop_max_bytes"`    // bytes of av packets cached at most, 0 unlimited
+	HLS         bool   `json:"hls"`
+	Record      bool   `json:"record"`
+}
+
+type RecordCfg struct {
+	Enable bool   `json:"enable"` // record apps not configured
+	Path   string `json:"path"`   // flv files saved as {path}/{vhost}/{app}/{stream}-{unix}.flv
+}
+
+type SubscriberCfg struct {
+	QueueSize int    `json:"queue_size"` // av packets queued for each subscriber
+	Overflow  string `json:"overflow"`   // once queue full, 'drop' non-key frames until next IDR, or 'disconnect'
+}
+
+type RoomCfg struct {
+	IdleTimeout    int64 `json:"idle_timeout"`    // seconds to remove room without publisher & subscribers, 0 to keep
+	WaitTimeout    int64 `json:"wait_timeout"`    // seconds subscribers wait for publisher, 0 to wait forever
+	ReconnectGrace int64 `json:"reconnect_grace"` // seconds subscribers kept for publisher reconnecting, 0 to close at once
+}
+
+type RelayCfg struct {
+	Enable        bool      `json:"enable"`
+	Pulls         []PullCfg `json:"pulls"`          // remote streams pulled since started
+	OnDemand      string    `json:"on_demand"`      // url of rooms pulled on play if not published, placeholders: {app}, {stream}
+	RetryInterval int64     `json:"retry_interval"` // seconds to pull again after configured pull stopped
+	IdleTimeout   int64     `json:"idle_timeout"`   // seconds to stop on-demand pull without subscribers
+}
+
+type PullCfg struct {
+	Vhost  string `json:"vhost"` // default vhost if empty
+	App    string `json:"app"`
+	Stream string `json:"stream"`
+	URL    string `json:"url"` // ex. rtmp://origin/live/stream
+}
+
+type ForwardCfg struct {
+	Enable     bool          `json:"enable"`
+	Rules      []ForwardRule `json:"rules"`
+	BackoffMin int64         `json:"backoff_min"` // seconds to reconnect after first failure, doubled after each one
+	BackoffMax int64         `json:"backoff_max"` // seconds of max reconnecting interval
+}
+
+type ForwardRule struct {
+	Vhost  string   `json:"vhost"`  // any vhost if empty
+	App    string   `json:"app"`    // any app if empty
+	Stream string   `json:"stream"` // any stream of app if empty
+	URLs   []string `json:"urls"`   // upstream destinations, placeholders: {app}, {stream}
+}
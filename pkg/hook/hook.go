@@ -0,0 +1,116 @@
+package hook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gosm/pkg/config"
+	"gosm/pkg/log"
+)
+
+// Event stream lifecycle event
+type Event string
+
+// events, on_connect & on_publish & on_play can be vetoed by response status
+const (
+	OnConnect    = Event("on_connect")
+	OnPublish    = Event("on_publish")
+	OnUnpublish  = Event("on_unpublish")
+	OnPlay       = Event("on_play")
+	OnStop       = Event("on_stop")
+	OnRecordDone = Event("on_record_done")
+)
+
+// DefaultTimeout of one callback if not configured
+const DefaultTimeout = 3 * time.Second
+
+// ErrRejected vetoed by webhook
+var ErrRejected = errors.New("Hook: rejected")
+
+// Payload json body posted to webhook
+type Payload struct {
+	Action   Event  `json:"action"`
+	Vhost    string `json:"vhost"`
+	App      string `json:"app"`
+	Stream   string `json:"stream"`
+	Protocol string `json:"protocol,omitempty"`  // rtmp, http-flv, rtsp, rtp, hls
+	ClientID string `json:"client_id,omitempty"` // subscriber uid
+	Client   string `json:"client,omitempty"`    // remote address
+	TcURL    string `json:"tc_url,omitempty"`
+	Param    string `json:"param,omitempty"` // query string of url
+	File     string `json:"file,omitempty"`  // on_record_done only
+	Time     int64  `json:"time"`            // unix seconds
+}
+
+// Hooks posts payloads to urls configured per event
+type Hooks struct {
+	client *http.Client
+	urls   map[Event][]string
+}
+
+// New .
+func New(cfg *config.HookCfg) *Hooks {
+	timeout := time.Duration(cfg.Timeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Hooks{
+		client: &http.Client{Timeout: timeout},
+		urls: map[Event][]string{
+			OnConnect:    cfg.OnConnect,
+			OnPublish:    cfg.OnPublish,
+			OnUnpublish:  cfg.OnUnpublish,
+			OnPlay:       cfg.OnPlay,
+			OnStop:       cfg.OnStop,
+			OnRecordDone: cfg.OnRecordDone,
+		},
+	}
+}
+
+// Call post payload to every url of event in order, blocking,
+// non 2xx response or unreachable url vetoes with ErrRejected
+func (hooks *Hooks) Call(event Event, payload *Payload) error {
+	if hooks == nil {
+		return nil
+	}
+	payload.Action = event
+	payload.Time = time.Now().Unix()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	for _, url := range hooks.urls[event] {
+		if err := hooks.post(url, body); err != nil {
+			return fmt.Errorf("%w, %s '%s/%s', %v", ErrRejected, event, payload.App, payload.Stream, err)
+		}
+	}
+	return nil
+}
+
+// Notify post payload in background, errors logged only
+func (hooks *Hooks) Notify(event Event, payload *Payload) {
+	if hooks == nil || len(hooks.urls[event]) == 0 {
+		return
+	}
+	go func() {
+		if err := hooks.Call(event, payload); err != nil {
+			log.Warn("%v", err)
+		}
+	}()
+}
+
+func (hooks *Hooks) post(url string, body []byte) error {
+	res, err := hooks.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("url '%s' responds %s", url, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package hook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gosm/pkg/config"
+)
+
+// newServer webhook responding status, payloads received sent to channel if any
+func newServer(status int, payloads chan<- *Payload) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := &Payload{}
+		if err := json.NewDecoder(r.Body).Decode(payload); err == nil && payloads != nil {
+			payloads <- payload
+		}
+		w.WriteHeader(status)
+	}))
+}
+
+func TestCall(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		rejected bool
+	}{
+		{name: "ok", status: http.StatusOK, rejected: false},
+		{name: "no content", status: http.StatusNoContent, rejected: false},
+		{name: "forbidden", status: http.StatusForbidden, rejected: true},
+		{name: "server error", status: http.StatusInternalServerError, rejected: true},
+		{name: "not modified", status: http.StatusNotModified, rejected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payloads := make(chan *Payload, 1)
+			server := newServer(test.status, payloads)
+			defer server.Close()
+
+			hooks := New(&config.HookCfg{OnPublish: []string{server.URL}})
+			err := hooks.Call(OnPublish, &Payload{Vhost: "v", App: "live", Stream: "s"})
+			if rejected := errors.Is(err, ErrRejected); rejected != test.rejected {
+				t.Fatalf("error: %v, rejected expected %v", err, test.rejected)
+			}
+			payload := <-payloads
+			if payload.Action != OnPublish || payload.App != "live" || payload.Stream != "s" || payload.Time == 0 {
+				t.Fatalf("payload: %+v", payload)
+			}
+		})
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	hooks := New(&config.HookCfg{Timeout: 50, OnConnect: []string{server.URL}})
+	start := time.Now()
+	err := hooks.Call(OnConnect, &Payload{App: "live"})
+	if !errors.Is(err, ErrRejected) {
+		t.Fatalf("error: %v, expected rejected by timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("returned after %v, expected within timeout", elapsed)
+	}
+}
+
+func TestCallFirstRejectionWins(t *testing.T) {
+	var hits [3]int32
+	statuses := []int{http.StatusOK, http.StatusForbidden, http.StatusInternalServerError}
+	urls := make([]string, 0, len(statuses))
+	for idx, status := range statuses {
+		idx, status := idx, status
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits[idx], 1)
+			w.WriteHeader(status)
+		}))
+		defer server.Close()
+		urls = append(urls, server.URL)
+	}
+
+	hooks := New(&config.HookCfg{OnPlay: urls})
+	err := hooks.Call(OnPlay, &Payload{App: "live", Stream: "s"})
+	if !errors.Is(err, ErrRejected) || !strings.Contains(err.Error(), urls[1]) {
+		t.Fatalf("error: %v, expected rejected by '%s'", err, urls[1])
+	}
+	if hits[0] != 1 || hits[1] != 1 || hits[2] != 0 {
+		t.Fatalf("hits: %v, expected urls after the first rejection skipped", hits)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	release := make(chan struct{})
+	payloads := make(chan *Payload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		payload := &Payload{}
+		json.NewDecoder(r.Body).Decode(payload)
+		payloads <- payload
+	}))
+	defer server.Close()
+
+	hooks := New(&config.HookCfg{OnStop: []string{server.URL}})
+	start := time.Now()
+	hooks.Notify(OnStop, &Payload{App: "live", Stream: "s"})
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("notify blocked for %v", elapsed)
+	}
+	close(release)
+
+	select {
+	case payload := <-payloads:
+		if payload.Action != OnStop {
+			t.Fatalf("payload: %+v", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("notification not posted")
+	}
+}
+
+func TestNilHooks(t *testing.T) {
+	var hooks *Hooks
+	if err := hooks.Call(OnPublish, &Payload{}); err != nil {
+		t.Fatalf("error: %v, expected nil hooks allow all", err)
+	}
+	hooks.Notify(OnUnpublish, &Payload{})
+}
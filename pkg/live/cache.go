@@ -1,12 +1,20 @@
 package live
 
 import (
-	"fmt"
+	"sync"
 
 	"gosm/pkg/avformat"
+	"gosm/pkg/config"
+	"gosm/pkg/log"
 )
 
-const GopMax = 128
+// GOP cache strategies, how new subscribers start playing
+const (
+	GopFull     = "full"     // gop_size GOPs cached
+	GopLast     = "last"     // the last GOP only
+	GopKeyframe = "keyframe" // the latest keyframe with audio after it, video resumed from next IDR
+	GopNone     = "none"     // no cache, video started from next IDR
+)
 
 /************************************/
 /********** AV Packet Cache *********/
@@ -16,59 +24,107 @@ const GopMax = 128
 type AVCache struct {
 	audioConfig *avformat.AVPacket // audio parameter sets
 	videoConfig *avformat.AVPacket // video parameter sets
+	mu          sync.Mutex         // parameter sets replaced by serving loop while read by rtsp describing
+	strategy    string
 	gopGroup    *GopGroup
 }
 
-// NewAVCache .
-func NewAVCache(gopSize uint8) *AVCache {
+// NewAVCache cache by strategy & limits of app, full gop_size GOPs if strategy unknown
+func NewAVCache(settings *config.AppCfg) *AVCache {
+	strategy := settings.GopStrategy
+	capacity := settings.GopSize
+	switch strategy {
+	case GopLast, GopKeyframe:
+		capacity = 1
+	case GopNone:
+		capacity = 0
+	default:
+		strategy = GopFull
+	}
 	return &AVCache{
 		audioConfig: nil,
 		videoConfig: nil,
-		gopGroup:    NewGopGroup(gopSize),
+		strategy:    strategy,
+		gopGroup:    NewGopGroup(capacity, uint32(settings.GopMaxDur), settings.GopMaxBytes),
 	}
 }
 
 // Write
 func (cache *AVCache) Write(packet *avformat.AVPacket) error {
 	if packet.IsAACSeqHeader() {
+		cache.mu.Lock()
 		cache.audioConfig = packet
+		cache.mu.Unlock()
 		return nil
 	}
 	if packet.IsAVCSeqHeader() || packet.IsHEVCSeqHeader() {
+		cache.mu.Lock()
 		cache.videoConfig = packet
+		cache.mu.Unlock()
 		return nil
 	}
 	return cache.gopGroup.Write(packet)
 }
 
-// WriteTo flush data to subscriber
-func (cache *AVCache) WriteTo(wc AVWriteCloser) error {
+// Configs video & audio sequence headers cached, nil if not received yet
+func (cache *AVCache) Configs() (*avformat.AVPacket, *avformat.AVPacket) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.videoConfig, cache.audioConfig
+}
+
+// WriteTo flush data to subscriber by strategy,
+// returns false if no GOP flushed, that video should be resumed from next IDR
+func (cache *AVCache) WriteTo(wc AVWriteCloser) (bool, error) {
+	videoConfig, audioConfig := cache.Configs()
 	// audio config
-	if cache.audioConfig != nil {
-		if err := wc.WriteAVPacket(cache.audioConfig); err != nil {
-			return err
+	if audioConfig != nil {
+		if err := wc.WriteAVPacket(audioConfig); err != nil {
+			return false, err
 		}
 	}
 	// video config
-	if cache.videoConfig != nil {
-		if err := wc.WriteAVPacket(cache.videoConfig); err != nil {
-			return err
+	if videoConfig != nil {
+		if err := wc.WriteAVPacket(videoConfig); err != nil {
+			return false, err
 		}
 	}
-	// gop group
-	if err := cache.gopGroup.WriteTo(wc); err != nil {
-		return err
+
+	switch cache.strategy {
+	case GopNone:
+		return false, nil
+	case GopKeyframe:
+		// latest keyframe & audio after it, video frames referring skipped ones dropped until next IDR
+		gop := cache.gopGroup.last()
+		if gop == nil {
+			return false, nil
+		}
+		for idx, packet := range gop.packets {
+			if idx == 0 || packet.IsAudio() {
+				if err := wc.WriteAVPacket(packet); err != nil {
+					return false, err
+				}
+			}
+		}
+		return false, nil
+	default:
+		// gop group
+		if err := cache.gopGroup.WriteTo(wc); err != nil {
+			return false, err
+		}
+		return cache.gopGroup.last() != nil, nil
 	}
-	return nil
 }
 
 /************************************/
 /**************** GOP ***************/
 /************************************/
 
-// GOP .
+// GOP av packets started by IDR frame
 type gop struct {
 	packets []*avformat.AVPacket
+	bytes   int
+	latest  uint32 // the largest timestamp, audio may be timestamped before the IDR
 }
 
 // NewGOP .
@@ -79,18 +135,13 @@ func newGop() *gop {
 	return gop
 }
 
-// reset gop
-func (gop *gop) reset() {
-	gop.packets = gop.packets[:0]
-}
-
 // cache av packet
-func (gop *gop) write(packet *avformat.AVPacket) error {
-	if len(gop.packets) >= GopMax {
-		return fmt.Errorf("GOP: large than maxinum capacity %d", GopMax)
+func (gop *gop) write(packet *avformat.AVPacket) {
+	if len(gop.packets) == 0 || packet.Timestamp > gop.latest {
+		gop.latest = packet.Timestamp
 	}
 	gop.packets = append(gop.packets, packet)
-	return nil
+	gop.bytes += len(packet.Body)
 }
 
 // write gop cache av packets to subscriber
@@ -103,18 +154,23 @@ func (gop *gop) writeTo(wc AVWriteCloser) error {
 	return nil
 }
 
-// GopCache group of GOP
+// GopGroup group of GOP, the oldest ones evicted once capacity or limits exceeded
 type GopGroup struct {
-	capacity uint8
-	current  uint8
-	gops     []*gop
+	capacity    uint8
+	maxDuration uint32 // milliseconds, 0 unlimited
+	maxBytes    int    // 0 unlimited
+	bytes       int    // bytes of all gops
+	gops        []*gop // the oldest first
+	skipping    bool   // the current gop exceeded limits, not cached until next IDR
 }
 
-func NewGopGroup(capacity uint8) *GopGroup {
+// NewGopGroup .
+func NewGopGroup(capacity uint8, maxDuration uint32, maxBytes int) *GopGroup {
 	group := &GopGroup{
-		capacity: capacity,
-		current:  0,
-		gops:     make([]*gop, capacity),
+		capacity:    capacity,
+		maxDuration: maxDuration,
+		maxBytes:    maxBytes,
+		gops:        make([]*gop, 0, capacity),
 	}
 	return group
 }
@@ -129,33 +185,79 @@ func (group *GopGroup) Write(packet *avformat.AVPacket) error {
 		return nil
 	}
 
-	// IDR frame, use next gop create if not exist, else reset
+	// IDR frame, start next gop and evict the oldest one if full
 	if packet.IsAVCKeyframe() || packet.IsHEVCKeyframe() {
-		group.current = (group.current + 1) % group.capacity
-		if gop := group.gops[group.current]; gop != nil {
-			gop.reset()
-		} else {
-			group.gops[group.current] = newGop()
+		if len(group.gops) == int(group.capacity) {
+			group.evict()
 		}
+		group.gops = append(group.gops, newGop())
+		group.skipping = false
+	}
+
+	// cache IDR or B or P frame, audio before the first IDR skipped
+	if len(group.gops) == 0 || group.skipping {
+		return nil
 	}
+	group.gops[len(group.gops)-1].write(packet)
+	group.bytes += len(packet.Body)
 
-	// cache IDR or B or P frame
-	gop := group.gops[group.current]
-	if gop != nil {
-		gop.write(packet)
+	// evict the oldest gops, even the current one if it alone exceeded limits
+	for group.exceeded() {
+		if len(group.gops) == 1 {
+			log.Debug("GOP: current gop exceeds cache limits, %d packets, skip caching until next IDR", len(group.gops[0].packets))
+			group.skipping = true
+		}
+		group.evict()
 	}
 	return nil
 }
 
 // WriteTo write gops cache av packets to subscriber
 func (group *GopGroup) WriteTo(wc AVWriteCloser) error {
-	for idx := uint8(0); idx < group.capacity; idx++ {
-		pos := (group.current + 1 + idx) % group.capacity
-		if gop := group.gops[pos]; gop != nil {
-			if err := gop.writeTo(wc); err != nil {
-				return err
-			}
+	for _, gop := range group.gops {
+		if err := gop.writeTo(wc); err != nil {
+			return err
 		}
 	}
 	return nil
 }
+
+// last the current gop, nil if none
+func (group *GopGroup) last() *gop {
+	if len(group.gops) == 0 {
+		return nil
+	}
+	return group.gops[len(group.gops)-1]
+}
+
+// evict the oldest gop
+func (group *GopGroup) evict() {
+	group.bytes -= group.gops[0].bytes
+	group.gops[0] = nil
+	group.gops = group.gops[1:]
+}
+
+// exceeded whether cached gops exceed duration or bytes limit
+func (group *GopGroup) exceeded() bool {
+	if len(group.gops) == 0 {
+		return false
+	}
+	if group.maxBytes > 0 && group.bytes > group.maxBytes {
+		return true
+	}
+	if group.maxDuration > 0 {
+		return group.duration() > int64(group.maxDuration)
+	}
+	return false
+}
+
+// duration milliseconds from the oldest IDR to the largest timestamp cached, signed as audio may precede it
+func (group *GopGroup) duration() int64 {
+	latest := group.gops[0].latest
+	for _, gop := range group.gops[1:] {
+		if gop.latest > latest {
+			latest = gop.latest
+		}
+	}
+	return int64(latest) - int64(group.gops[0].packets[0].Timestamp)
+}
@@ -0,0 +1,148 @@
+package live
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gosm/pkg/avformat"
+	"gosm/pkg/config"
+	"gosm/pkg/log"
+	"gosm/pkg/protocol/rtmp"
+	"gosm/pkg/utils"
+)
+
+// default reconnecting backoff of forwarding if not configured
+const (
+	DefaultBackoffMin = time.Second
+	DefaultBackoffMax = time.Minute
+)
+
+// SetForward sets rtmp forwarding rules, rooms matched are pushed to upstream destinations once published
+func (mgmt *RoomMgmt) SetForward(cfg *config.ForwardCfg) {
+	mgmt.fwd = cfg
+}
+
+// pusher upstream rtmp stream subscribes room
+type pusher struct {
+	client *rtmp.Client
+	once   sync.Once
+	done   chan struct{} // closed once the subscriber closed
+}
+
+// WriteAVPacket .
+func (p *pusher) WriteAVPacket(packet *avformat.AVPacket) error {
+	return p.client.WriteAVPacket(packet)
+}
+
+// Close .
+func (p *pusher) Close() error {
+	p.once.Do(func() {
+		p.client.Close()
+		close(p.done)
+	})
+	return nil
+}
+
+// forward starts pushing room to upstream destinations matched
+func (mgmt *RoomMgmt) forward(room *Room) {
+	if mgmt.fwd == nil {
+		return
+	}
+	replacer := strings.NewReplacer("{app}", room.App, "{stream}", room.Name)
+	for _, rule := range mgmt.fwd.Rules {
+		if (rule.Vhost != "" && rule.Vhost != room.Vhost) ||
+			(rule.App != "" && rule.App != room.App) ||
+			(rule.Stream != "" && rule.Stream != room.Name) {
+			continue
+		}
+		for _, url := range rule.URLs {
+			go mgmt.forwarding(room, room.Publisher, replacer.Replace(url))
+		}
+	}
+}
+
+// forwarding pushes room to upstream until publisher closed, reconnect with exponential backoff
+func (mgmt *RoomMgmt) forwarding(room *Room, publisher *Publisher, url string) {
+	backoffMin := time.Duration(mgmt.fwd.BackoffMin) * time.Second
+	if backoffMin <= 0 {
+		backoffMin = DefaultBackoffMin
+	}
+	backoffMax := time.Duration(mgmt.fwd.BackoffMax) * time.Second
+	if backoffMax <= 0 {
+		backoffMax = DefaultBackoffMax
+	}
+	if backoffMax < backoffMin {
+		backoffMax = backoffMin
+	}
+	backoff := backoffMin
+
+	for {
+		start := time.Now()
+		if err := mgmt.push(room, publisher, url); err != nil {
+			log.Error("%v", err)
+		}
+
+		// retry after backoffMin again if pushed long enough, the next wait doubled
+		if time.Since(start) > backoffMax {
+			backoff = backoffMin
+		}
+		wait := backoff
+		if backoff = wait * 2; backoff > backoffMax {
+			backoff = backoffMax
+		}
+		select {
+		case <-publisher.done:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// push subscribes room as upstream publisher, return until upstream broken or publisher closed
+func (mgmt *RoomMgmt) push(room *Room, publisher *Publisher, url string) error {
+	client, err := rtmp.NewClient(url)
+	if err != nil {
+		return err
+	}
+	p := &pusher{client: client, done: make(chan struct{})}
+	defer p.Close()
+
+	if err := client.Handshake(); err != nil {
+		return fmt.Errorf("Forward: push '%s' handshake error, %v", url, err)
+	}
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("Forward: push '%s' connect error, %v", url, err)
+	}
+	// metadata if parsed, otherwise derived from sequence headers flushed by room
+	client.SetMetaData(publisher.metaData())
+	if err := client.Publish(); err != nil {
+		return fmt.Errorf("Forward: push '%s' publish error, %v", url, err)
+	}
+
+	uuid := utils.Snowflake.NextID()
+	subscriber := newSubscriber(New, p, &SubscriberInfo{
+		UID:           strconv.FormatInt(uuid, 10),
+		Protocol:      RTMP,
+		Type:          TypeLive,
+		RemoteAddr:    url,
+		SubscribeTime: time.Now(),
+	})
+	defer subscriber.Close()
+	if !room.store(room.ForwardSubscribers, uuid, subscriber) {
+		return fmt.Errorf("Forward: live room '%s' removed", roomKey(room.Vhost, room.App, room.Name))
+	}
+	defer room.ForwardSubscribers.Delete(uuid)
+	log.Info("Forward: push room '%s' to '%s'", roomKey(room.Vhost, room.App, room.Name), url)
+
+	select {
+	case <-client.Done():
+		return fmt.Errorf("Forward: push '%s' connection broken", url)
+	case <-p.done:
+		return nil
+	case <-publisher.done:
+		return nil
+	}
+}
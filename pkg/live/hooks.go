@@ -0,0 +1,95 @@
+package live
+
+import (
+	"gosm/pkg/hook"
+	"gosm/pkg/protocol/hls"
+	"gosm/pkg/protocol/rtmp"
+)
+
+// SetHooks sets webhooks of stream lifecycle events
+func (mgmt *RoomMgmt) SetHooks(hooks *hook.Hooks) {
+	mgmt.hooks = hooks
+}
+
+// RTMPAuthenticator consults webhooks on rtmp connect, publish & play after the given authenticator,
+// so that rtmp clients are rejected with proper status
+func (mgmt *RoomMgmt) RTMPAuthenticator(next rtmp.Authenticator) rtmp.Authenticator {
+	return &rtmpHookAuth{mgmt: mgmt, next: next}
+}
+
+// rtmpHookAuth .
+type rtmpHookAuth struct {
+	mgmt *RoomMgmt
+	next rtmp.Authenticator
+}
+
+// OnConnect .
+func (auth *rtmpHookAuth) OnConnect(conn *rtmp.ConnInfo) error {
+	if auth.next != nil {
+		if err := auth.next.OnConnect(conn); err != nil {
+			return err
+		}
+	}
+	return auth.mgmt.hooks.Call(hook.OnConnect, &hook.Payload{
+		Vhost:    conn.Vhost,
+		App:      conn.App,
+		Protocol: RTMP,
+		Client:   conn.RemoteAddr,
+		TcURL:    conn.TcURL,
+		Param:    conn.Query.Encode(),
+	})
+}
+
+// OnPublish .
+func (auth *rtmpHookAuth) OnPublish(conn *rtmp.ConnInfo, stream *rtmp.StreamInfo) error {
+	if auth.next != nil {
+		if err := auth.next.OnPublish(conn, stream); err != nil {
+			return err
+		}
+	}
+	return auth.mgmt.hooks.Call(hook.OnPublish, &hook.Payload{
+		Vhost:    conn.Vhost,
+		App:      conn.App,
+		Stream:   stream.Name,
+		Protocol: RTMP,
+		Client:   conn.RemoteAddr,
+		TcURL:    conn.TcURL,
+		Param:    stream.Query.Encode(),
+	})
+}
+
+// OnPlay .
+func (auth *rtmpHookAuth) OnPlay(conn *rtmp.ConnInfo, stream *rtmp.StreamInfo) error {
+	if auth.next != nil {
+		if err := auth.next.OnPlay(conn, stream); err != nil {
+			return err
+		}
+	}
+	return auth.mgmt.hooks.Call(hook.OnPlay, &hook.Payload{
+		Vhost:    conn.Vhost,
+		App:      conn.App,
+		Stream:   stream.StreamName,
+		Protocol: RTMP,
+		Client:   conn.RemoteAddr,
+		TcURL:    conn.TcURL,
+		Param:    stream.Query.Encode(),
+	})
+}
+
+// publishHLS subscribe room as hls stream, fragments completed notified as on_record_done
+func (mgmt *RoomMgmt) publishHLS(room *Room) error {
+	hlsStream, err := hls.NewNetStream(room.Vhost, room.App, room.Name)
+	if err != nil {
+		return err
+	}
+	hlsStream.SetSegmentHandler(func(fn string) {
+		mgmt.hooks.Notify(hook.OnRecordDone, &hook.Payload{
+			Vhost:    room.Vhost,
+			App:      room.App,
+			Stream:   room.Name,
+			Protocol: HLS,
+			File:     fn,
+		})
+	})
+	return mgmt.OnHLSSubscribe(hlsStream)
+}
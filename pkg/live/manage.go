@@ -0,0 +1,151 @@
+package live
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// ErrNotFound room or client not found
+var ErrNotFound = errors.New("not found")
+
+// ClientInfo publisher or subscriber of room
+type ClientInfo struct {
+	UID        string `json:"uid"`
+	Role       string `json:"role"` // publisher or subscriber
+	Vhost      string `json:"vhost"`
+	App        string `json:"app"`
+	Stream     string `json:"stream"`
+	Protocol   string `json:"protocol"`
+	RemoteAddr string `json:"remote_addr"`
+	Bytes      uint64 `json:"bytes"`  // received from publisher, or sent to subscriber
+	Uptime     int64  `json:"uptime"` // seconds
+}
+
+// Rooms snapshot of rooms, all vhosts if vhost empty
+func (mgmt *RoomMgmt) Rooms(vhost string) []*RoomInfo {
+	rooms := make([]*RoomInfo, 0)
+	mgmt.rooms.Range(func(key, value interface{}) bool {
+		if room := value.(*Room); vhost == "" || room.Vhost == vhost {
+			rooms = append(rooms, room.snapshot())
+		}
+		return true
+	})
+	return rooms
+}
+
+// Room snapshot of room
+func (mgmt *RoomMgmt) Room(vhost string, app string, name string) (*RoomInfo, error) {
+	room := mgmt.load(vhost, app, name)
+	if room == nil {
+		return nil, ErrNotFound
+	}
+	return room.snapshot(), nil
+}
+
+// Clients publishers & subscribers of rooms, all vhosts if vhost empty
+func (mgmt *RoomMgmt) Clients(vhost string) []*ClientInfo {
+	clients := make([]*ClientInfo, 0)
+	for _, room := range mgmt.Rooms(vhost) {
+		if p := room.PublisherInfo; p != nil {
+			clients = append(clients, &ClientInfo{
+				UID:        p.UID,
+				Role:       "publisher",
+				Vhost:      room.Vhost,
+				App:        room.App,
+				Stream:     room.Name,
+				Protocol:   p.Protocol,
+				RemoteAddr: p.RemoteAddr,
+				Bytes:      p.BytesReceived,
+				Uptime:     p.Uptime,
+			})
+		}
+		for _, s := range room.SubscribersInfo {
+			clients = append(clients, &ClientInfo{
+				UID:        s.UID,
+				Role:       "subscriber",
+				Vhost:      room.Vhost,
+				App:        room.App,
+				Stream:     room.Name,
+				Protocol:   s.Protocol,
+				RemoteAddr: s.RemoteAddr,
+				Bytes:      s.BytesSent,
+				Uptime:     s.Uptime,
+			})
+		}
+	}
+	return clients
+}
+
+// DropRoom closes room with its publisher & subscribers
+func (mgmt *RoomMgmt) DropRoom(vhost string, app string, name string) error {
+	room := mgmt.load(vhost, app, name)
+	if room == nil {
+		return ErrNotFound
+	}
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if room.reaped {
+		return ErrNotFound
+	}
+	mgmt.remove(room)
+	return nil
+}
+
+// Kick closes publisher or subscriber by uid, viewers of publisher kept for its reconnecting,
+// kicked rtp sender blocked for a while by udp server rather than republished by its next packet
+func (mgmt *RoomMgmt) Kick(uid string) error {
+	id, _ := strconv.ParseInt(uid, 10, 64)
+	err := ErrNotFound
+	mgmt.rooms.Range(func(key, value interface{}) bool {
+		room := value.(*Room)
+		room.mu.Lock()
+		defer room.mu.Unlock()
+		if publisher := room.Publisher; publisher != nil && publisher.info.UID == uid {
+			publisher.Close()
+			err = nil
+			return false
+		}
+		if hls := room.HLSSubscriber; hls != nil && hls.info.UID == uid {
+			hls.Close()
+			err = nil
+			return false
+		}
+		for _, m := range []*sync.Map{room.RTMPSubscribers, room.HTTPFlvSubscribers, room.RTSPSubscribers, room.RecordSubscribers, room.ForwardSubscribers} {
+			if subscriber, ok := m.Load(id); ok {
+				subscriber.(*Subscriber).Close()
+				m.Delete(id)
+				err = nil
+				return false
+			}
+		}
+		return true
+	})
+	return err
+}
+
+// snapshot of room, publisher & subscribers with statistics
+func (room *Room) snapshot() *RoomInfo {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	info := &RoomInfo{
+		Vhost:           room.Vhost,
+		App:             room.App,
+		Name:            room.Name,
+		SubscribersInfo: make([]*SubscriberInfo, 0),
+	}
+	if publisher := room.Publisher; publisher != nil {
+		info.Type = publisher.info.StreamType
+		info.PublisherInfo = publisher.snapshot()
+	}
+	for _, m := range []*sync.Map{room.RTMPSubscribers, room.HTTPFlvSubscribers, room.RTSPSubscribers, room.RecordSubscribers, room.ForwardSubscribers} {
+		m.Range(func(key, value interface{}) bool {
+			info.SubscribersInfo = append(info.SubscribersInfo, value.(*Subscriber).snapshot())
+			return true
+		})
+	}
+	if hls := room.HLSSubscriber; hls != nil {
+		info.SubscribersInfo = append(info.SubscribersInfo, hls.snapshot())
+	}
+	return info
+}
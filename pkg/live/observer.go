@@ -3,112 +3,166 @@ package live
 import (
 	"fmt"
 	"strconv"
+	"sync/atomic"
 	"time"
 
+	"gosm/pkg/avformat"
 	"gosm/pkg/config"
+	"gosm/pkg/hook"
 	"gosm/pkg/log"
 	"gosm/pkg/protocol/hls"
 	"gosm/pkg/protocol/httpflv"
 	"gosm/pkg/protocol/rtmp"
+	"gosm/pkg/protocol/rtsp"
+	"gosm/pkg/protocol/rtsp/udp"
 	"gosm/pkg/utils"
 )
 
 /***********************************
- ********** RTMP Observer **********
+ ******** Generic Observer *********
  ***********************************/
 
-// OnRTMPPublish .
-func (mgmt *RoomMgmt) OnRTMPPublish(stream *rtmp.NetStream) error {
-	// release the old one if exist
-	info := stream.Info()
-	room, exist := mgmt.loadOrStore(info.Name)
-	if exist {
-		log.Debug("Publisher: live room '%s' exists, try to republish", info.Name)
-		if err := mgmt.OnRTMPUnPublish(stream); err != nil {
-			return err
-		}
+// OnPublish publish in-process av source into room, replace the old publisher if exist
+func (mgmt *RoomMgmt) OnPublish(vhost string, app string, name string, rc AVReadCloser) error {
+	return mgmt.publish(vhost, app, name, TypeLive, rc)
+}
+
+// OnUnPublish stop publishing room, ignore if republished by others
+func (mgmt *RoomMgmt) OnUnPublish(vhost string, app string, name string, rc AVReadCloser) error {
+	room := mgmt.load(vhost, app, name)
+	if room == nil {
+		return nil
+	}
+	if publisher := room.loadPublisher(); publisher != nil && publisher.rc == rc {
+		log.Debug("Publisher: live room '%s' unpublish", roomKey(vhost, app, name))
+		mgmt.hooks.Notify(hook.OnUnpublish, &hook.Payload{
+			Vhost:  vhost,
+			App:    app,
+			Stream: name,
+		})
+		// room released by its serving loop, subscribers kept for reconnecting
+		publisher.Close()
+	}
+	return nil
+}
+
+// publish replaces publisher of room, hls & recording & forwarding started by settings of app,
+// subscribers kept if publisher reconnected within grace
+func (mgmt *RoomMgmt) publish(vhost string, app string, name string, streamType string, rc AVReadCloser) error {
+	room := mgmt.lockRoom(vhost, app, name)
+	defer room.mu.Unlock()
+	if room.Publisher != nil {
+		log.Debug("Publisher: live room '%s' exists, try to republish", roomKey(vhost, app, name))
+		room.Publisher.Close()
+		room.closePublishing()
 	}
 
-	// publish rtmp
-	room.Publisher = &Publisher{
+	protocol, remoteAddr, conn := source(rc)
+	publisher := &Publisher{
 		info: &PublisherInfo{
-			AppName:     stream.ConnInfo().App,
-			StreamName:  info.Name,
-			StreamType:  info.Type,
+			UID:         strconv.FormatInt(utils.Snowflake.NextID(), 10),
+			Vhost:       vhost,
+			AppName:     app,
+			StreamName:  name,
+			StreamType:  streamType,
+			Protocol:    protocol,
+			RemoteAddr:  remoteAddr,
+			Conn:        conn,
 			PublishTime: time.Now(),
 			MetaData:    nil,
 		},
-		cache: NewAVCache(config.Global.RTMP.GopSize),
-		rc:    stream,
+		cache: NewAVCache(room.settings),
+		rc:    rc,
+		done:  make(chan struct{}),
 	}
+	room.Publisher = publisher
 
 	// publish hls
-	if config.Global.HLS.Enable {
-		hlsStrem, err := hls.NewNetStream(stream.ConnInfo().App, info.Name)
-		if err != nil {
+	if room.settings.HLS {
+		if err := mgmt.publishHLS(room); err != nil {
 			return err
 		}
-		if err = mgmt.OnHLSSubscribe(hlsStrem); err != nil {
+	}
+
+	// record flv
+	if room.settings.Record {
+		if err := mgmt.record(room); err != nil {
 			return err
 		}
 	}
 
-	go room.serve()
+	go room.serve(publisher, room.HLSSubscriber, room.recorders(), atomic.LoadUint32(&room.last))
+	mgmt.forward(room)
 	return nil
 }
 
+/***********************************
+ ********** RTMP Observer **********
+ ***********************************/
+
+// OnRTMPPublish .
+func (mgmt *RoomMgmt) OnRTMPPublish(stream *rtmp.NetStream) error {
+	info := stream.Info()
+	return mgmt.publish(stream.ConnInfo().Vhost, stream.ConnInfo().App, info.Name, info.Type, stream)
+}
+
 // OnRTMPUnPublish .
 func (mgmt *RoomMgmt) OnRTMPUnPublish(stream *rtmp.NetStream) error {
-	info := stream.Info()
-	room := mgmt.load(info.Name)
-	if room != nil && room.Publisher != nil {
-		log.Debug("Publisher: live room '%s' unpublish", info.Name)
-		room.Publisher.Close()
-		room.Publisher = nil
-	}
-	return nil
+	return mgmt.OnUnPublish(stream.ConnInfo().Vhost, stream.ConnInfo().App, stream.Info().Name, stream)
 }
 
 // OnRTMPSubscribe .
 func (mgmt *RoomMgmt) OnRTMPSubscribe(stream *rtmp.NetStream) error {
 	info := stream.Info()
+	conn := stream.ConnInfo()
 	// check room if exist
-	room, exist := mgmt.loadOrStore(info.StreamName)
+	room, exist := mgmt.loadOrStore(conn.Vhost, conn.App, info.StreamName)
 	if !exist {
-		log.Debug("Subscriber: live room '%s' not exist, creating...", info.StreamName)
+		log.Debug("Subscriber: live room '%s' not exist, creating...", roomKey(conn.Vhost, conn.App, info.StreamName))
+	}
+	publisher := room.loadPublisher()
+	if publisher == nil {
+		mgmt.pullOnDemand(conn.Vhost, conn.App, info.StreamName)
 	}
 
 	// TODO: should check subscriber if exist ???
 
-	// create subscriber
-	uuid := utils.Snowflake.NextID()
-	subscriber := &Subscriber{
-		status: New,
-		wc:     stream,
-		info: &SubscriberInfo{
-			UID:           strconv.FormatInt(uuid, 10),
-			Protocol:      RTMP,
-			Type:          TypeLive,
-			SubscribeTime: time.Now(),
-		},
-	}
-
-	// fetch av metadata if publisher exist
-	if room.Publisher != nil {
-		metadataPacket, err := room.Publisher.metadata()
+	// fetch av metadata if publisher exist, before subscriber writing
+	if publisher != nil {
+		metadataPacket, err := publisher.metadata()
 		if err != nil {
 			return err
 		}
-		if err := subscriber.wc.WriteAVPacket(metadataPacket); err != nil {
+		if err := stream.WriteAVPacket(metadataPacket); err != nil {
 			return err
 		}
 	}
-	room.RTMPSubscribers.Store(uuid, subscriber)
+
+	// create subscriber
+	uuid := utils.Snowflake.NextID()
+	subscriber := newSubscriber(New, stream, &SubscriberInfo{
+		UID:           strconv.FormatInt(uuid, 10),
+		Protocol:      RTMP,
+		Type:          TypeLive,
+		RemoteAddr:    conn.RemoteAddr,
+		SubscribeTime: time.Now(),
+	})
+	if !room.store(room.RTMPSubscribers, uuid, subscriber) {
+		subscriber.Close()
+		return fmt.Errorf("Subscriber: live room '%s' removed, try again", roomKey(conn.Vhost, conn.App, info.StreamName))
+	}
 	return nil
 }
 
 // OnRTMPUnSubsribe .
 func (mgmt *RoomMgmt) OnRTMPUnSubsribe(stream *rtmp.NetStream) error {
+	mgmt.hooks.Notify(hook.OnStop, &hook.Payload{
+		Vhost:    stream.ConnInfo().Vhost,
+		App:      stream.ConnInfo().App,
+		Stream:   stream.Info().StreamName,
+		Protocol: RTMP,
+		Client:   stream.ConnInfo().RemoteAddr,
+	})
 	return stream.Close()
 }
 
@@ -118,46 +172,182 @@ func (mgmt *RoomMgmt) OnRTMPUnSubsribe(stream *rtmp.NetStream) error {
 
 // OnHTTPFlvSubscribe .
 func (mgmt *RoomMgmt) OnHTTPFlvSubscribe(stream *httpflv.NetStream) error {
+	// authorize by webhook
+	uuid := utils.Snowflake.NextID()
+	info := stream.Info()
+	if err := mgmt.hooks.Call(hook.OnPlay, &hook.Payload{
+		Vhost:    info.Vhost,
+		App:      info.App,
+		Stream:   info.Stream,
+		Protocol: HTTPFLV,
+		ClientID: strconv.FormatInt(uuid, 10),
+		Client:   info.RemoteAddr,
+		Param:    info.Query,
+	}); err != nil {
+		return err
+	}
+
 	// check room if exist
-	room, exist := mgmt.loadOrStore(stream.Info().Stream)
+	room, exist := mgmt.loadOrStore(info.Vhost, info.App, info.Stream)
 	if !exist {
-		log.Debug("Subscriber: live room '%s' not published yet, waiting for av packets", stream.Info().Stream)
+		log.Debug("Subscriber: live room '%s' not published yet, waiting for av packets", roomKey(info.Vhost, info.App, info.Stream))
+	}
+	publisher := room.loadPublisher()
+	if publisher == nil {
+		mgmt.pullOnDemand(info.Vhost, info.App, info.Stream)
 	}
 
 	// TODO: should check subscriber if exist ???
 
-	// create subscriber
-	uuid := utils.Snowflake.NextID()
-	subscriber := &Subscriber{
-		status: New,
-		wc:     stream,
-		info: &SubscriberInfo{
-			UID:           strconv.FormatInt(uuid, 10),
-			Protocol:      HTTPFLV,
-			Type:          TypeLive,
-			SubscribeTime: time.Now(),
-		},
-	}
-
-	// fetch av metadata if publisher exist
-	if room.Publisher != nil {
-		metadata, err := room.Publisher.metadata()
+	// fetch av metadata if publisher exist, before subscriber writing
+	if publisher != nil {
+		metadata, err := publisher.metadata()
 		if err != nil {
 			return err
 		}
-		if err := subscriber.wc.WriteAVPacket(metadata); err != nil {
+		if err := stream.WriteAVPacket(metadata); err != nil {
 			return err
 		}
 	}
-	room.HTTPFlvSubscribers.Store(uuid, subscriber)
+
+	// create subscriber
+	subscriber := newSubscriber(New, stream, &SubscriberInfo{
+		UID:           strconv.FormatInt(uuid, 10),
+		Protocol:      HTTPFLV,
+		Type:          TypeLive,
+		RemoteAddr:    info.RemoteAddr,
+		SubscribeTime: time.Now(),
+	})
+	if !room.store(room.HTTPFlvSubscribers, uuid, subscriber) {
+		subscriber.Close()
+		return fmt.Errorf("Subscriber: live room '%s' removed, try again", roomKey(info.Vhost, info.App, info.Stream))
+	}
 	return nil
 }
 
 // OnHTTPFlvUnSubscribe .
 func (mgmt *RoomMgmt) OnHTTPFlvUnSubscribe(stream *httpflv.NetStream) error {
+	mgmt.hooks.Notify(hook.OnStop, &hook.Payload{
+		Vhost:    stream.Info().Vhost,
+		App:      stream.Info().App,
+		Stream:   stream.Info().Stream,
+		Protocol: HTTPFLV,
+		Client:   stream.Info().RemoteAddr,
+	})
+	return stream.Close()
+}
+
+/***********************************
+ ********** RTSP Observer **********
+ ***********************************/
+
+// OnRTSPDescribe returns video/audio sequence header of the publishing room
+func (mgmt *RoomMgmt) OnRTSPDescribe(stream *rtsp.NetStream) (*avformat.AVPacket, *avformat.AVPacket, error) {
+	// authorize by webhook
+	info := stream.Info()
+	if err := mgmt.hooks.Call(hook.OnPlay, &hook.Payload{
+		Vhost:    info.Vhost,
+		App:      info.App,
+		Stream:   info.Stream,
+		Protocol: RTSP,
+		Client:   info.RemoteAddr,
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	var publisher *Publisher
+	if room := mgmt.load(info.Vhost, info.App, info.Stream); room != nil {
+		publisher = room.loadPublisher()
+	}
+	if publisher == nil {
+		return nil, nil, fmt.Errorf("Subscriber: live room '%s' not published yet", roomKey(info.Vhost, info.App, info.Stream))
+	}
+	videoConfig, audioConfig := publisher.cache.Configs()
+	return videoConfig, audioConfig, nil
+}
+
+// OnRTSPPublish .
+func (mgmt *RoomMgmt) OnRTSPPublish(stream *rtsp.NetStream) error {
+	// authorize by webhook
+	info := stream.Info()
+	if err := mgmt.hooks.Call(hook.OnPublish, &hook.Payload{
+		Vhost:    info.Vhost,
+		App:      info.App,
+		Stream:   info.Stream,
+		Protocol: RTSP,
+		Client:   info.RemoteAddr,
+	}); err != nil {
+		return err
+	}
+	return mgmt.OnPublish(info.Vhost, info.App, info.Stream, stream)
+}
+
+// OnRTSPUnPublish .
+func (mgmt *RoomMgmt) OnRTSPUnPublish(stream *rtsp.NetStream) error {
+	info := stream.Info()
+	return mgmt.OnUnPublish(info.Vhost, info.App, info.Stream, stream)
+}
+
+// OnRTSPSubscribe .
+func (mgmt *RoomMgmt) OnRTSPSubscribe(stream *rtsp.NetStream) error {
+	// check room if exist, described already
+	info := stream.Info()
+	room := mgmt.load(info.Vhost, info.App, info.Stream)
+	if room == nil {
+		return fmt.Errorf("Subscriber: live room '%s' not exist", roomKey(info.Vhost, info.App, info.Stream))
+	}
+
+	// create subscriber
+	uuid := utils.Snowflake.NextID()
+	subscriber := newSubscriber(New, stream, &SubscriberInfo{
+		UID:           strconv.FormatInt(uuid, 10),
+		Protocol:      RTSP,
+		Type:          TypeLive,
+		RemoteAddr:    info.RemoteAddr,
+		SubscribeTime: time.Now(),
+	})
+	if !room.store(room.RTSPSubscribers, uuid, subscriber) {
+		subscriber.Close()
+		return fmt.Errorf("Subscriber: live room '%s' removed, try again", roomKey(info.Vhost, info.App, info.Stream))
+	}
+	return nil
+}
+
+// OnRTSPUnSubscribe .
+func (mgmt *RoomMgmt) OnRTSPUnSubscribe(stream *rtsp.NetStream) error {
+	mgmt.hooks.Notify(hook.OnStop, &hook.Payload{
+		Vhost:    stream.Info().Vhost,
+		App:      stream.Info().App,
+		Stream:   stream.Info().Stream,
+		Protocol: RTSP,
+		Client:   stream.Info().RemoteAddr,
+	})
 	return stream.Close()
 }
 
+/***********************************
+ *********** UDP Observer **********
+ ***********************************/
+
+// OnUDPPublish .
+func (mgmt *RoomMgmt) OnUDPPublish(name string, session *udp.Session) error {
+	// authorize by webhook, sender rejected blocked for a while by udp server
+	if err := mgmt.hooks.Call(hook.OnPublish, &hook.Payload{
+		Vhost:    config.DefaultVhost,
+		App:      config.Global.RTP.App,
+		Stream:   name,
+		Protocol: RTP,
+	}); err != nil {
+		return err
+	}
+	return mgmt.OnPublish(config.DefaultVhost, config.Global.RTP.App, name, session)
+}
+
+// OnUDPUnPublish .
+func (mgmt *RoomMgmt) OnUDPUnPublish(name string, session *udp.Session) error {
+	return mgmt.OnUnPublish(config.DefaultVhost, config.Global.RTP.App, name, session)
+}
+
 /***********************************
  *********** HLS Observer **********
  ***********************************/
@@ -165,23 +355,20 @@ func (mgmt *RoomMgmt) OnHTTPFlvUnSubscribe(stream *httpflv.NetStream) error {
 // OnHLSSubscribe .
 func (mgmt *RoomMgmt) OnHLSSubscribe(stream *hls.NetStream) error {
 	// check room if exist
-	room, exist := mgmt.loadOrStore(stream.Info().Stream)
+	info := stream.Info()
+	room, exist := mgmt.loadOrStore(info.Vhost, info.App, info.Stream)
 	if !exist {
-		return fmt.Errorf("Subscriber: live room '%s' not published yet, ingore HLS", stream.Info().Stream)
+		return fmt.Errorf("Subscriber: live room '%s' not published yet, ingore HLS", roomKey(info.Vhost, info.App, info.Stream))
 	}
 
 	// create subscriber
 	uuid := utils.Snowflake.NextID()
-	subscriber := &Subscriber{
-		status: Running,
-		wc:     stream,
-		info: &SubscriberInfo{
-			UID:           strconv.FormatInt(uuid, 10),
-			Protocol:      HLS,
-			Type:          TypeLive,
-			SubscribeTime: time.Now(),
-		},
-	}
+	subscriber := newSubscriber(Running, stream, &SubscriberInfo{
+		UID:           strconv.FormatInt(uuid, 10),
+		Protocol:      HLS,
+		Type:          TypeLive,
+		SubscribeTime: time.Now(),
+	})
 	room.HLSSubscriber = subscriber
 
 	return nil
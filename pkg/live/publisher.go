@@ -2,12 +2,16 @@ package live
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"gosm/pkg/avformat"
 	"gosm/pkg/protocol/amf"
+	"gosm/pkg/protocol/rtmp"
+	"gosm/pkg/protocol/rtsp"
+	"gosm/pkg/protocol/rtsp/udp"
 )
 
 // AVReadCloser .
@@ -18,39 +22,71 @@ type AVReadCloser interface {
 
 // Publisher .
 type Publisher struct {
-	info  *PublisherInfo
-	cache *AVCache
-	rc    AVReadCloser
+	received uint64 // bytes of av packets received, first for 64-bit atomic alignment
+	info     *PublisherInfo
+	cache    *AVCache
+	rc       AVReadCloser
+	mu       sync.Mutex // metadata replaced by serving loop while read by others
+	once     sync.Once
+	done     chan struct{} // closed once publisher closed
 }
 
 // PublisherInfo .
 type PublisherInfo struct {
-	AppName     string
-	StreamName  string
-	StreamType  string
-	PublishTime time.Time
-	MetaData    *avformat.MetaData
+	UID           string             `json:"uid"`
+	Vhost         string             `json:"vhost"`
+	AppName       string             `json:"app"`
+	StreamName    string             `json:"stream"`
+	StreamType    string             `json:"type"`
+	Protocol      string             `json:"protocol"`
+	RemoteAddr    string             `json:"remote_addr"`
+	Conn          *rtmp.ConnInfo     `json:"conn,omitempty"` // rtmp publisher only
+	PublishTime   time.Time          `json:"publish_time"`
+	MetaData      *avformat.MetaData `json:"metadata"`
+	BytesReceived uint64             `json:"bytes_received"` // filled by snapshot
+	Uptime        int64              `json:"uptime"`         // seconds, filled by snapshot
 }
 
-// return onMetaData av packet encoded by amf0
-func (p *Publisher) metadata() (*avformat.AVPacket, error) {
-	amf := &amf.AMF0{}
-	buf := new(bytes.Buffer)
-
-	// convert metadata from struct to map
-	metadata, err := json.Marshal(p.info.MetaData)
-	if err != nil {
-		return nil, err
+// source protocol & remote address of av source, with connection info of rtmp one
+func source(rc AVReadCloser) (string, string, *rtmp.ConnInfo) {
+	switch rc := rc.(type) {
+	case *rtmp.NetStream:
+		return RTMP, rc.ConnInfo().RemoteAddr, rc.ConnInfo()
+	case *rtsp.NetStream:
+		return RTSP, rc.Info().RemoteAddr, nil
+	case *puller:
+		return RTMP, rc.url, nil
+	case *udp.Session:
+		return RTP, "", nil
+	default:
+		return "", "", nil
 	}
-	mapMetadata := make(map[string]interface{})
-	json.Unmarshal(metadata, &mapMetadata)
+}
 
-	// convert from map to amf0
-	_, err = amf.WriteString(buf, "onMetaData")
-	if err != nil {
-		return nil, err
+// snapshot copy of publisher info with statistics
+func (p *Publisher) snapshot() *PublisherInfo {
+	p.mu.Lock()
+	info := *p.info
+	p.mu.Unlock()
+	if info.MetaData != nil {
+		metadata := *info.MetaData
+		info.MetaData = &metadata
 	}
-	_, err = amf.WriteTo(buf, &mapMetadata)
+	info.BytesReceived = atomic.LoadUint64(&p.received)
+	info.Uptime = int64(time.Since(info.PublishTime) / time.Second)
+	return &info
+}
+
+// metaData metadata parsed, nil if none
+func (p *Publisher) metaData() *avformat.MetaData {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.info.MetaData
+}
+
+// return onMetaData av packet encoded by amf0
+func (p *Publisher) metadata() (*avformat.AVPacket, error) {
+	body, err := p.metaData().Marshal(false)
 	if err != nil {
 		return nil, err
 	}
@@ -58,10 +94,10 @@ func (p *Publisher) metadata() (*avformat.AVPacket, error) {
 	// pack metadata packet
 	packet := &avformat.AVPacket{
 		TypeID:    avformat.TypeMetadataAMF0,
-		Length:    uint32(buf.Len()),
+		Length:    uint32(len(body)),
 		Timestamp: 0,
 		StreamID:  1,
-		Body:      buf.Bytes(),
+		Body:      body,
 	}
 	return packet, nil
 }
@@ -147,10 +183,17 @@ func (p *Publisher) parseMetadata(packet *avformat.AVPacket) error {
 			metadata.Stereo = stereo.(bool)
 		}
 	}
+	p.mu.Lock()
 	p.info.MetaData = metadata
+	p.mu.Unlock()
 	return nil
 }
 
 func (p *Publisher) Close() error {
-	return p.rc.Close()
+	var err error
+	p.once.Do(func() {
+		close(p.done)
+		err = p.rc.Close()
+	})
+	return err
 }
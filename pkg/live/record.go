@@ -0,0 +1,107 @@
+package live
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"gosm/pkg/avformat"
+	"gosm/pkg/avformat/flv"
+	"gosm/pkg/config"
+	"gosm/pkg/hook"
+	"gosm/pkg/log"
+	"gosm/pkg/utils"
+)
+
+// recorder records room into flv file as subscriber
+type recorder struct {
+	fp     *os.File
+	fw     *flv.Writer
+	mu     sync.Mutex // closed by room while written by subscriber goroutine
+	closed bool
+	once   sync.Once
+	onDone func(fn string) // callback of flv file completed
+}
+
+// newRecorder creates flv file as {path}/{vhost}/{app}/{stream}-{unix}.flv
+func newRecorder(vhost string, app string, name string) (*recorder, error) {
+	dir := filepath.Join(config.Global.Record.Path, vhost, app)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	fn := filepath.Join(dir, fmt.Sprintf("%s-%d.flv", name, time.Now().Unix()))
+	fp, err := os.Create(fn)
+	if err != nil {
+		return nil, err
+	}
+	fw, err := flv.NewWriter(fp, app, name)
+	if err != nil {
+		fp.Close()
+		return nil, err
+	}
+	return &recorder{fp: fp, fw: fw}, nil
+}
+
+// WriteAVPacket .
+func (r *recorder) WriteAVPacket(packet *avformat.AVPacket) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	return r.fw.WriteTag(&flv.Tag{
+		TagHeader: &flv.TagHeader{
+			TagType:   packet.TypeID,
+			DataSize:  packet.Length,
+			Timestamp: packet.Timestamp,
+			StreamID:  0,
+		},
+		TagData: packet.Body,
+	})
+}
+
+// Close .
+func (r *recorder) Close() error {
+	var err error
+	r.once.Do(func() {
+		r.mu.Lock()
+		r.closed = true
+		err = r.fp.Close()
+		r.mu.Unlock()
+		if r.onDone != nil {
+			r.onDone(r.fp.Name())
+		}
+	})
+	return err
+}
+
+// record subscribes room as flv recorder, file completed notified as on_record_done
+func (mgmt *RoomMgmt) record(room *Room) error {
+	r, err := newRecorder(room.Vhost, room.App, room.Name)
+	if err != nil {
+		return fmt.Errorf("Record: create flv file of room '%s' error, %v", roomKey(room.Vhost, room.App, room.Name), err)
+	}
+	r.onDone = func(fn string) {
+		log.Info("Record: room '%s' recorded as '%s'", roomKey(room.Vhost, room.App, room.Name), fn)
+		mgmt.hooks.Notify(hook.OnRecordDone, &hook.Payload{
+			Vhost:  room.Vhost,
+			App:    room.App,
+			Stream: room.Name,
+			File:   fn,
+		})
+	}
+
+	// running since publishing, so that metadata recorded
+	uuid := utils.Snowflake.NextID()
+	room.RecordSubscribers.Store(uuid, newSubscriber(Running, r, &SubscriberInfo{
+		UID:           strconv.FormatInt(uuid, 10),
+		Protocol:      FLV,
+		Type:          TypeRecord,
+		RemoteAddr:    r.fp.Name(),
+		SubscribeTime: time.Now(),
+	}))
+	return nil
+}
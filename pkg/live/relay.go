@@ -0,0 +1,147 @@
+package live
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gosm/pkg/avformat"
+	"gosm/pkg/config"
+	"gosm/pkg/log"
+	"gosm/pkg/protocol/rtmp"
+)
+
+// default intervals of relay if not configured
+const (
+	DefaultRetryInterval   = 5 * time.Second  // to pull again after configured pull stopped
+	DefaultPullIdleTimeout = 30 * time.Second // to stop on-demand pull without subscribers
+)
+
+// SetRelay sets rtmp relay, configured remote streams start pulling into rooms
+func (mgmt *RoomMgmt) SetRelay(cfg *config.RelayCfg) {
+	mgmt.relay = cfg
+	for _, pull := range cfg.Pulls {
+		vhost := pull.Vhost
+		if vhost == "" {
+			vhost = config.DefaultVhost
+		}
+		go mgmt.keepPulling(vhost, pull.App, pull.Stream, pull.URL)
+	}
+}
+
+// puller remote rtmp stream played as publisher of room
+type puller struct {
+	client *rtmp.Client
+	url    string
+	once   sync.Once
+	done   chan struct{} // closed once the publisher closed
+}
+
+// ReadAVPacket .
+func (p *puller) ReadAVPacket() (*avformat.AVPacket, error) {
+	return p.client.ReadAVPacket()
+}
+
+// Close .
+func (p *puller) Close() error {
+	p.once.Do(func() {
+		p.client.Close()
+		close(p.done)
+	})
+	return nil
+}
+
+// Pull plays remote rtmp stream and publishes it into room
+func (mgmt *RoomMgmt) Pull(vhost string, app string, name string, url string) error {
+	_, err := mgmt.pull(vhost, app, name, url)
+	return err
+}
+
+func (mgmt *RoomMgmt) pull(vhost string, app string, name string, url string) (*puller, error) {
+	client, err := rtmp.NewClient(url)
+	if err != nil {
+		return nil, err
+	}
+	p := &puller{client: client, url: url, done: make(chan struct{})}
+	if err := client.Handshake(); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("Relay: pull '%s' handshake error, %v", url, err)
+	}
+	if err := client.Connect(); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("Relay: pull '%s' connect error, %v", url, err)
+	}
+	if err := client.Play(); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("Relay: pull '%s' play error, %v", url, err)
+	}
+	if err := mgmt.OnPublish(vhost, app, name, p); err != nil {
+		p.Close()
+		return nil, err
+	}
+	log.Info("Relay: pull '%s' into room '%s'", url, roomKey(vhost, app, name))
+	return p, nil
+}
+
+// keepPulling pulls configured remote stream, again after stopped unless room published by others
+func (mgmt *RoomMgmt) keepPulling(vhost string, app string, name string, url string) {
+	interval := time.Duration(mgmt.relay.RetryInterval) * time.Second
+	if interval <= 0 {
+		interval = DefaultRetryInterval
+	}
+	for {
+		if room := mgmt.load(vhost, app, name); room == nil || room.loadPublisher() == nil {
+			if p, err := mgmt.pull(vhost, app, name, url); err != nil {
+				log.Error("%v", err)
+			} else {
+				<-p.done
+				mgmt.OnUnPublish(vhost, app, name, p)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// pullOnDemand pulls room not published yet from on-demand url,
+// stopped once no subscriber within idle timeout
+func (mgmt *RoomMgmt) pullOnDemand(vhost string, app string, name string) {
+	if mgmt.relay == nil || mgmt.relay.OnDemand == "" {
+		return
+	}
+	key := roomKey(vhost, app, name)
+	if _, exist := mgmt.pulls.LoadOrStore(key, nil); exist {
+		return
+	}
+	url := strings.NewReplacer("{app}", app, "{stream}", name).Replace(mgmt.relay.OnDemand)
+	idleTimeout := time.Duration(mgmt.relay.IdleTimeout) * time.Second
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultPullIdleTimeout
+	}
+
+	go func() {
+		defer mgmt.pulls.Delete(key)
+
+		p, err := mgmt.pull(vhost, app, name, url)
+		if err != nil {
+			log.Error("%v", err)
+			return
+		}
+		ticker := time.NewTicker(idleTimeout)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				mgmt.OnUnPublish(vhost, app, name, p)
+				return
+			case <-ticker.C:
+				if room := mgmt.load(vhost, app, name); room == nil || !room.hasSubscribers() {
+					log.Info("Relay: room '%s' has no subscriber, stop pulling '%s'", key, url)
+					mgmt.OnUnPublish(vhost, app, name, p)
+					p.Close()
+					return
+				}
+			}
+		}
+	}()
+}
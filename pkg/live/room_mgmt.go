@@ -2,57 +2,161 @@ package live
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"gosm/pkg/avformat"
+	"gosm/pkg/config"
+	"gosm/pkg/hook"
 	"gosm/pkg/log"
 )
 
 // RoomMgmt living room managerment, defined followed:
-//    room name <=> publish stream name
-//		-> map[room's name]*room
+//    room key <=> vhost/app/publish stream name
+//		-> map[room's key]*room
 //		-> map[publisher's name]map[subscriber's name]*subscriber
 type RoomMgmt struct {
 	rooms *sync.Map
+	hooks *hook.Hooks        // webhooks, nil if disabled
+	relay *config.RelayCfg   // rtmp relay, nil if disabled
+	pulls *sync.Map          // room's keys being pulled on demand
+	fwd   *config.ForwardCfg // rtmp forwarding, nil if disabled
 }
 
-// NewRoomMgmt .
+// IdleTimeout duration to remove room without publisher & subscribers, 0 to keep
+var IdleTimeout = time.Duration(config.Global.Room.IdleTimeout) * time.Second
+
+// WaitTimeout duration subscribers wait for publisher, 0 to wait forever
+var WaitTimeout = time.Duration(config.Global.Room.WaitTimeout) * time.Second
+
+// ReconnectGrace duration subscribers kept once publisher gone, for it to reconnect, 0 to close at once
+var ReconnectGrace = time.Duration(config.Global.Room.ReconnectGrace) * time.Second
+
+// NewRoomMgmt starts reaping idle rooms
 func NewRoomMgmt() *RoomMgmt {
-	return &RoomMgmt{rooms: &sync.Map{}}
+	mgmt := &RoomMgmt{rooms: &sync.Map{}, pulls: &sync.Map{}}
+	go mgmt.reaping()
+	return mgmt
+}
+
+// roomKey rooms namespaced by vhost & app
+func roomKey(vhost string, app string, name string) string {
+	return vhost + "/" + app + "/" + name
 }
 
 // find room and get
-func (mgmt *RoomMgmt) load(name string) *Room {
-	if room, exist := mgmt.rooms.Load(name); exist {
+func (mgmt *RoomMgmt) load(vhost string, app string, name string) *Room {
+	if room, exist := mgmt.rooms.Load(roomKey(vhost, app, name)); exist {
 		return room.(*Room)
 	}
 	return nil
 }
 
 // find room and get, create new if not exist
-func (mgmt *RoomMgmt) loadOrStore(name string) (*Room, bool) {
-	room, exist := mgmt.rooms.LoadOrStore(name, &Room{
+func (mgmt *RoomMgmt) loadOrStore(vhost string, app string, name string) (*Room, bool) {
+	room, exist := mgmt.rooms.LoadOrStore(roomKey(vhost, app, name), &Room{
+		Vhost:              vhost,
+		App:                app,
+		Name:               name,
+		settings:           config.Global.App(vhost, app),
 		Publisher:          nil, // lazy created
 		RTMPSubscribers:    &sync.Map{},
 		HTTPFlvSubscribers: &sync.Map{},
+		RTSPSubscribers:    &sync.Map{},
 		HLSSubscriber:      nil, // lazy created
+		RecordSubscribers:  &sync.Map{},
+		ForwardSubscribers: &sync.Map{},
+		idleSince:          time.Now(),
 	})
 	return room.(*Room), exist
 }
 
+// find room and lock, create new if not exist or reaped
+func (mgmt *RoomMgmt) lockRoom(vhost string, app string, name string) *Room {
+	for {
+		room, _ := mgmt.loadOrStore(vhost, app, name)
+		room.mu.Lock()
+		if !room.reaped {
+			return room
+		}
+		room.mu.Unlock()
+	}
+}
+
+// reaping removes idle rooms, and closes subscribers waiting for publisher too long
+func (mgmt *RoomMgmt) reaping() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		mgmt.rooms.Range(func(key, value interface{}) bool {
+			room := value.(*Room)
+			room.mu.Lock()
+			defer room.mu.Unlock()
+			if room.Publisher != nil {
+				return true
+			}
+			room.closeWaiting(now)
+			if IdleTimeout > 0 && now.Sub(room.idleSince) > IdleTimeout && !room.hasSubscribers() {
+				log.Info("Room: vhost '%s', app '%s', stream '%s' idle for %v, removed", room.Vhost, room.App, room.Name, IdleTimeout)
+				mgmt.remove(room)
+			}
+			return true
+		})
+	}
+}
+
 // RoomInfo .
 type RoomInfo struct {
-	Name            string
-	Type            string
-	PublisherInfo   *PublisherInfo
-	SubscribersInfo []*SubscriberInfo
+	Vhost           string            `json:"vhost"`
+	App             string            `json:"app"`
+	Name            string            `json:"name"`
+	Type            string            `json:"type"`      // stream type of publisher, empty if not published
+	PublisherInfo   *PublisherInfo    `json:"publisher"` // nil if not published
+	SubscribersInfo []*SubscriberInfo `json:"subscribers"`
 }
 
 // Room living room
 type Room struct {
+	Vhost              string
+	App                string
+	Name               string
+	settings           *config.AppCfg // settings of app
 	Publisher          *Publisher
 	RTMPSubscribers    *sync.Map   // <=> map[subscriber's name]*subscriber
 	HTTPFlvSubscribers *sync.Map   // <=> map[subscriber's name]*subscriber
+	RTSPSubscribers    *sync.Map   // <=> map[subscriber's name]*subscriber
 	HLSSubscriber      *Subscriber // hls subscriber
+	RecordSubscribers  *sync.Map   // <=> map[subscriber's name]*subscriber, flv recorder
+	ForwardSubscribers *sync.Map   // <=> map[subscriber's name]*subscriber, upstream pusher
+	mu                 sync.Mutex  // publishing, unpublishing & reaping
+	idleSince          time.Time   // since created or publisher gone
+	reaped             bool        // removed from room managerment, neither published nor subscribed
+	last               uint32      // timestamp of the last av packet, base of the next publisher
+}
+
+// remove room locked, closed with its publisher & subscribers
+func (mgmt *RoomMgmt) remove(room *Room) {
+	room.reaped = true
+	mgmt.rooms.Delete(roomKey(room.Vhost, room.App, room.Name))
+	room.Close()
+}
+
+// store subscriber into room, false if room reaped already
+func (room *Room) store(m *sync.Map, key interface{}, subscriber *Subscriber) bool {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if room.reaped {
+		return false
+	}
+	m.Store(key, subscriber)
+	return true
+}
+
+// find publisher, nil if not published
+func (room *Room) loadPublisher() *Publisher {
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	return room.Publisher
 }
 
 // find subscriber
@@ -63,32 +167,40 @@ func (room *Room) loadSubscriber(name string) (*Subscriber, bool) {
 	if subscriber, exist := room.HTTPFlvSubscribers.Load(name); exist {
 		return subscriber.(*Subscriber), true
 	}
+	if subscriber, exist := room.RTSPSubscribers.Load(name); exist {
+		return subscriber.(*Subscriber), true
+	}
 	return nil, false
 }
 
-// room start to publish, loop to broadcast av packets
-func (room *Room) serve() {
-	publisher := room.Publisher
+// room start to publish, loop to broadcast av packets,
+// timestamps based on the last one of room so that subscribers kept see them increasing,
+// hls & recorders bound to publisher given by copy, never re-read from room while serving
+func (room *Room) serve(publisher *Publisher, hls *Subscriber, recorders *sync.Map, base uint32) {
 	defer func() {
-		log.Info("Room: app '%s', stream '%s' stop publishing", publisher.info.AppName, publisher.info.StreamName)
-		room.Close()
+		log.Info("Room: vhost '%s', app '%s', stream '%s' stop publishing", room.Vhost, room.App, room.Name)
+		room.unpublish(publisher)
 	}()
-	log.Info("Room: app '%s', stream '%s' start publishing", publisher.info.AppName, publisher.info.StreamName)
+	log.Info("Room: vhost '%s', app '%s', stream '%s' start publishing", room.Vhost, room.App, room.Name)
 
 	for {
 		packet, err := publisher.rc.ReadAVPacket()
 		if err != nil {
 			return
 		}
+		packet.Timestamp += base
+		atomic.StoreUint32(&room.last, packet.Timestamp)
+		atomic.AddUint64(&publisher.received, uint64(len(packet.Body)))
 
 		// HLS
-		if room.HLSSubscriber != nil {
-			if err := room.HLSSubscriber.wc.WriteAVPacket(packet); err != nil {
-				room.HLSSubscriber.Close()
+		if hls != nil {
+			if err := hls.WriteAVPacket(packet); err != nil {
+				hls.Close()
+				hls = nil
 			}
 		}
 
-		// RTMP & HTTL-FLV
+		// RTMP & HTTL-FLV & RTSP
 		switch packet.TypeID {
 		case avformat.TypeMetadataAMF0: // metadata
 			if err := publisher.parseMetadata(packet); err != nil {
@@ -96,36 +208,47 @@ func (room *Room) serve() {
 				return
 			}
 			metaPacket, _ := publisher.metadata()
-			room.RTMPSubscribers.Range(room.broadcast(room.RTMPSubscribers, metaPacket))
-			room.HTTPFlvSubscribers.Range(room.broadcast(room.HTTPFlvSubscribers, metaPacket))
+			room.RTMPSubscribers.Range(room.broadcast(publisher, room.RTMPSubscribers, metaPacket))
+			room.HTTPFlvSubscribers.Range(room.broadcast(publisher, room.HTTPFlvSubscribers, metaPacket))
+			recorders.Range(room.broadcast(publisher, recorders, metaPacket))
+			room.ForwardSubscribers.Range(room.broadcast(publisher, room.ForwardSubscribers, metaPacket))
 		case avformat.TypeAudio: // audio
 			fallthrough
 		case avformat.TypeVideo: // video
 			publisher.cache.Write(packet)
-			room.RTMPSubscribers.Range(room.broadcast(room.RTMPSubscribers, packet))
-			room.HTTPFlvSubscribers.Range(room.broadcast(room.HTTPFlvSubscribers, packet))
+			room.RTMPSubscribers.Range(room.broadcast(publisher, room.RTMPSubscribers, packet))
+			room.HTTPFlvSubscribers.Range(room.broadcast(publisher, room.HTTPFlvSubscribers, packet))
+			room.RTSPSubscribers.Range(room.broadcast(publisher, room.RTSPSubscribers, packet))
+			recorders.Range(room.broadcast(publisher, recorders, packet))
+			room.ForwardSubscribers.Range(room.broadcast(publisher, room.ForwardSubscribers, packet))
 		}
 	}
 }
 
-// broadcast av packet to all subscribers
-func (room *Room) broadcast(m *sync.Map, packet *avformat.AVPacket) func(key, value interface{}) bool {
+// broadcast av packet of publisher serving to all subscribers, overflow handled by policy of subscriber
+func (room *Room) broadcast(publisher *Publisher, m *sync.Map, packet *avformat.AVPacket) func(key, value interface{}) bool {
 	return func(key, value interface{}) bool {
 		subscriber := value.(*Subscriber)
 
+		// queued only, written by subscriber's own goroutine
 		var err error
-		switch subscriber.status {
-		case New: // flush gop cache
-			err = room.Publisher.cache.WriteTo(subscriber.wc)
-			subscriber.status = Running
+		switch subscriber.Status() {
+		case New: // flush gop cache ahead of send queue, video started from next IDR if no gop flushed
+			atomic.StoreUint32(&subscriber.status, Running)
+			gop := &gopBuffer{}
+			var continued bool
+			if continued, err = publisher.cache.WriteTo(gop); !continued {
+				subscriber.waitIDR = true
+			}
+			subscriber.flushGop(*gop)
 		case Running: // flush av packet
-			err = subscriber.wc.WriteAVPacket(packet)
+			err = subscriber.WriteAVPacket(packet)
 		case Closed:
 			m.Delete(key)
 		}
 
 		if err != nil {
-			log.Error("Room: subscriber '%s' writes av packet error, %v, remove it", subscriber.info.UID, err)
+			log.Error("%v, remove it", err)
 			subscriber.Close()
 			m.Delete(key)
 		}
@@ -133,6 +256,71 @@ func (room *Room) broadcast(m *sync.Map, packet *avformat.AVPacket) func(key, va
 	}
 }
 
+// unpublish publisher gone, hls & recorders closed, others kept for reconnecting within grace,
+// ignored if replaced by the new one
+func (room *Room) unpublish(publisher *Publisher) {
+	publisher.Close()
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if room.Publisher != publisher {
+		return
+	}
+	room.Publisher = nil
+	room.idleSince = time.Now()
+	room.closePublishing()
+	if ReconnectGrace <= 0 {
+		room.closeWaiting(room.idleSince)
+	}
+}
+
+// recorders copy of flv recorders bound to the current publisher, locked
+func (room *Room) recorders() *sync.Map {
+	recorders := &sync.Map{}
+	room.RecordSubscribers.Range(func(key, value interface{}) bool {
+		recorders.Store(key, value)
+		return true
+	})
+	return recorders
+}
+
+// closePublishing closes hls & recorders bound to publisher
+func (room *Room) closePublishing() {
+	if room.HLSSubscriber != nil {
+		room.HLSSubscriber.Close()
+		room.HLSSubscriber = nil
+	}
+	room.RecordSubscribers.Range(func(key, value interface{}) bool {
+		value.(*Subscriber).Close()
+		room.RecordSubscribers.Delete(key)
+		return true
+	})
+}
+
+// closeWaiting closes subscribers waiting for publisher too long, those joined since publisher gone
+// wait for WaitTimeout, and those watching before wait for ReconnectGrace
+func (room *Room) closeWaiting(now time.Time) {
+	for _, m := range []*sync.Map{room.RTMPSubscribers, room.HTTPFlvSubscribers, room.RTSPSubscribers} {
+		m.Range(func(key, value interface{}) bool {
+			subscriber := value.(*Subscriber)
+			since, expired := room.idleSince, false
+			if subscriber.info.SubscribeTime.After(room.idleSince) {
+				since = subscriber.info.SubscribeTime
+				expired = WaitTimeout > 0 && now.Sub(since) >= WaitTimeout
+			} else {
+				expired = now.Sub(since) >= ReconnectGrace
+			}
+			if !expired {
+				return true
+			}
+			log.Info("Room: subscriber '%s' of room '%s' waited for publisher %v, closed",
+				subscriber.info.UID, roomKey(room.Vhost, room.App, room.Name), now.Sub(since).Truncate(time.Second))
+			subscriber.Close()
+			m.Delete(key)
+			return true
+		})
+	}
+}
+
 // Close
 func (room *Room) Close() error {
 	// close publisher
@@ -152,6 +340,24 @@ func (room *Room) Close() error {
 		return true
 	})
 
+	// close rtsp subscribers
+	room.RTSPSubscribers.Range(func(key, value interface{}) bool {
+		value.(*Subscriber).Close()
+		return true
+	})
+
+	// close flv recorders
+	room.RecordSubscribers.Range(func(key, value interface{}) bool {
+		value.(*Subscriber).Close()
+		return true
+	})
+
+	// close upstream pushers
+	room.ForwardSubscribers.Range(func(key, value interface{}) bool {
+		value.(*Subscriber).Close()
+		return true
+	})
+
 	// close hls subscriber
 	if room.HLSSubscriber != nil {
 		room.HLSSubscriber.Close()
@@ -159,3 +365,15 @@ func (room *Room) Close() error {
 
 	return nil
 }
+
+// hasSubscribers whether any viewer, except hls & recorders & upstream pushers bound to publisher
+func (room *Room) hasSubscribers() bool {
+	has := false
+	for _, m := range []*sync.Map{room.RTMPSubscribers, room.HTTPFlvSubscribers, room.RTSPSubscribers} {
+		m.Range(func(key, value interface{}) bool {
+			has = true
+			return false
+		})
+	}
+	return has
+}
@@ -1,9 +1,14 @@
 package live
 
 import (
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"gosm/pkg/avformat"
+	"gosm/pkg/config"
+	"gosm/pkg/log"
 )
 
 // Status
@@ -18,7 +23,10 @@ const (
 	RTMP    = "rtmp"
 	HTTPFLV = "http-flv"
 	HLS     = "hls"
+	RTSP    = "rtsp"
+	RTP     = "rtp"
 	DASH    = "dash"
+	FLV     = "flv" // flv file recorder
 )
 
 // Type
@@ -27,6 +35,15 @@ const (
 	TypeRecord = "RECOED"
 )
 
+// Overflow policy once send queue of subscriber is full
+const (
+	OverflowDrop       = "drop"       // drop non-key frames until next IDR
+	OverflowDisconnect = "disconnect" // close subscriber
+)
+
+// DefaultQueueSize av packets queued for each subscriber if not configured
+const DefaultQueueSize = 512
+
 // AVWriteCloser .
 type AVWriteCloser interface {
 	WriteAVPacket(packet *avformat.AVPacket) error
@@ -35,20 +52,188 @@ type AVWriteCloser interface {
 
 // SubscriberInfo .
 type SubscriberInfo struct {
-	UID           string
-	Protocol      string
-	Type          string
-	SubscribeTime time.Time
+	UID           string    `json:"uid"`
+	Protocol      string    `json:"protocol"`
+	Type          string    `json:"type"`
+	RemoteAddr    string    `json:"remote_addr"` // upstream url of forwarding, file of recording
+	SubscribeTime time.Time `json:"subscribe_time"`
+	BytesSent     uint64    `json:"bytes_sent"` // filled by snapshot
+	Dropped       uint64    `json:"dropped"`    // filled by snapshot
+	Uptime        int64     `json:"uptime"`     // seconds, filled by snapshot
 }
 
-// Subscriber .
+// Subscriber av packets queued by room, and written by its own goroutine,
+// so that a slow one never stalls the publisher and other subscribers
 type Subscriber struct {
-	status uint8
-	wc     AVWriteCloser
-	info   *SubscriberInfo
+	dropped  uint64 // av packets dropped by overflow, first for 64-bit atomic alignment
+	sent     uint64 // bytes of av packets written
+	status   uint32
+	wc       AVWriteCloser
+	info     *SubscriberInfo
+	queue    chan *avformat.AVPacket
+	gop      chan []*avformat.AVPacket // gop cache flushed once by room, written ahead of queue, New subscriber only
+	overflow string
+	waitIDR  bool // dropping non-key frames until next IDR, accessed by room only
+	lagging  bool // dropping caused by overflow, counted as dropped
+	once     sync.Once
+	done     chan struct{} // closed once subscriber closed
+}
+
+// newSubscriber starts writing goroutine, status New for gop cache flushed by room first
+func newSubscriber(status uint32, wc AVWriteCloser, info *SubscriberInfo) *Subscriber {
+	size := config.Global.Subscriber.QueueSize
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	s := &Subscriber{
+		status:   status,
+		wc:       wc,
+		info:     info,
+		queue:    make(chan *avformat.AVPacket, size),
+		overflow: config.Global.Subscriber.Overflow,
+		done:     make(chan struct{}),
+	}
+	if status == New {
+		s.gop = make(chan []*avformat.AVPacket, 1)
+	}
+	go s.writing()
+	return s
+}
+
+// writing writes gop cache if New, then queued av packets until closed
+func (s *Subscriber) writing() {
+	if s.gop != nil {
+		select {
+		case <-s.done:
+			return
+		case packets := <-s.gop:
+			for _, packet := range packets {
+				if !s.write(packet) {
+					return
+				}
+			}
+		}
+	}
+	for {
+		select {
+		case <-s.done:
+			return
+		case packet := <-s.queue:
+			if !s.write(packet) {
+				return
+			}
+		}
+	}
+}
+
+// write av packet to writer, false if failed and subscriber closed
+func (s *Subscriber) write(packet *avformat.AVPacket) bool {
+	if err := s.wc.WriteAVPacket(packet); err != nil {
+		if s.Status() == Closed {
+			return false // interrupted by closing
+		}
+		log.Error("Room: subscriber '%s' writes av packet error, %v, remove it", s.info.UID, err)
+		s.Close()
+		return false
+	}
+	atomic.AddUint64(&s.sent, uint64(len(packet.Body)))
+	return true
+}
+
+// Status .
+func (s *Subscriber) Status() uint32 {
+	return atomic.LoadUint32(&s.status)
+}
+
+// Dropped av packets dropped by overflow of send queue
+func (s *Subscriber) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// snapshot copy of subscriber info with statistics
+func (s *Subscriber) snapshot() *SubscriberInfo {
+	info := *s.info
+	info.BytesSent = atomic.LoadUint64(&s.sent)
+	info.Dropped = s.Dropped()
+	info.Uptime = int64(time.Since(info.SubscribeTime) / time.Second)
+	return &info
 }
 
+// flushGop hands gop cache over to writing goroutine at once, never counted as overflow of send queue,
+// called by room once for New subscriber
+func (s *Subscriber) flushGop(packets []*avformat.AVPacket) {
+	select {
+	case s.gop <- packets:
+	default:
+	}
+}
+
+// WriteAVPacket queues av packet without blocking, error if closed by overflow policy
+func (s *Subscriber) WriteAVPacket(packet *avformat.AVPacket) error {
+	if s.Status() == Closed {
+		return fmt.Errorf("Room: subscriber '%s' is closed", s.info.UID)
+	}
+	if s.waitIDR && isInterframe(packet) {
+		if s.lagging {
+			atomic.AddUint64(&s.dropped, 1)
+		}
+		return nil
+	}
+
+	select {
+	case s.queue <- packet:
+		if isKeyframe(packet) {
+			s.waitIDR, s.lagging = false, false
+		}
+		return nil
+	default:
+	}
+
+	if s.overflow == OverflowDisconnect {
+		return fmt.Errorf("Room: subscriber '%s' send queue overflow, %d av packets queued", s.info.UID, cap(s.queue))
+	}
+	if !s.lagging {
+		log.Debug("Room: subscriber '%s' send queue overflow, drop until next IDR", s.info.UID)
+	}
+	atomic.AddUint64(&s.dropped, 1)
+	s.waitIDR, s.lagging = true, true
+	return nil
+}
+
+// Close .
 func (s *Subscriber) Close() error {
-	s.status = Closed
-	return s.wc.Close()
+	var err error
+	s.once.Do(func() {
+		atomic.StoreUint32(&s.status, Closed)
+		close(s.done)
+		err = s.wc.Close()
+		if dropped := s.Dropped(); dropped > 0 {
+			log.Info("Room: subscriber '%s' closed, %d av packets dropped", s.info.UID, dropped)
+		}
+	})
+	return err
+}
+
+// gopBuffer collects av packets of gop cache flushed for New subscriber
+type gopBuffer []*avformat.AVPacket
+
+// WriteAVPacket .
+func (buf *gopBuffer) WriteAVPacket(packet *avformat.AVPacket) error {
+	*buf = append(*buf, packet)
+	return nil
+}
+
+// Close .
+func (buf *gopBuffer) Close() error {
+	return nil
+}
+
+// isKeyframe .
+func isKeyframe(packet *avformat.AVPacket) bool {
+	return packet.IsVideo() && (packet.IsAVCKeyframe() || packet.IsHEVCKeyframe())
+}
+
+// isInterframe .
+func isInterframe(packet *avformat.AVPacket) bool {
+	return packet.IsVideo() && (packet.IsAVCInterframe() || packet.IsHEVCInterframe())
 }
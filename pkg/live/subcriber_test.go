@@ -0,0 +1,106 @@
+package live
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"gosm/pkg/avformat"
+	"gosm/pkg/avformat/flv"
+	"gosm/pkg/config"
+)
+
+// writer records av packets written, blocked until released
+type writer struct {
+	mu      sync.Mutex
+	packets []*avformat.AVPacket
+	release chan struct{}
+}
+
+func (w *writer) WriteAVPacket(packet *avformat.AVPacket) error {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.packets = append(w.packets, packet)
+	return nil
+}
+
+func (w *writer) Close() error {
+	return nil
+}
+
+// timestamps of av packets written
+func (w *writer) timestamps() []uint32 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	timestamps := make([]uint32, 0, len(w.packets))
+	for _, packet := range w.packets {
+		timestamps = append(timestamps, packet.Timestamp)
+	}
+	return timestamps
+}
+
+// avc video frame
+func video(timestamp uint32, keyframe bool) *avformat.AVPacket {
+	frameType := flv.AVCInterFrame
+	if keyframe {
+		frameType = flv.AVCKeyFrame
+	}
+	return &avformat.AVPacket{
+		TypeID:    avformat.TypeVideo,
+		Timestamp: timestamp,
+		Body:      []byte{frameType<<4 | flv.CodevIDAVC, flv.AVCNALU, 0x00, 0x00, 0x00},
+	}
+}
+
+func TestSubscriberJoinsGopLargerThanQueue(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow string
+	}{
+		{name: "drop", overflow: OverflowDrop},
+		{name: "disconnect", overflow: OverflowDisconnect},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config.Global.Subscriber = config.SubscriberCfg{QueueSize: 4, Overflow: test.overflow}
+			publisher := &Publisher{cache: NewAVCache(&config.AppCfg{GopSize: 1, GopStrategy: GopFull})}
+			room := &Room{}
+
+			// viewer joined a gop of 20 frames, writing nothing until released
+			w := &writer{release: make(chan struct{})}
+			subscriber := newSubscriber(New, w, &SubscriberInfo{UID: "1"})
+			defer subscriber.Close()
+			subscribers := &sync.Map{}
+			subscribers.Store(1, subscriber)
+
+			expected := make([]uint32, 0)
+			for idx := 0; idx < 22; idx++ {
+				packet := video(uint32(idx*40), idx == 0)
+				publisher.cache.Write(packet)
+				if idx >= 19 {
+					subscribers.Range(room.broadcast(publisher, subscribers, packet))
+				}
+				expected = append(expected, packet.Timestamp)
+			}
+			close(w.release)
+
+			deadline := time.Now().Add(2 * time.Second)
+			for len(w.timestamps()) < len(expected) && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			timestamps := w.timestamps()
+			if len(timestamps) != len(expected) {
+				t.Fatalf("written %v, expected %v", timestamps, expected)
+			}
+			for idx := range expected {
+				if timestamps[idx] != expected[idx] {
+					t.Fatalf("written %v, expected %v", timestamps, expected)
+				}
+			}
+			if subscriber.Status() == Closed || subscriber.Dropped() > 0 {
+				t.Fatalf("status %d, dropped %d, expected running without dropping", subscriber.Status(), subscriber.Dropped())
+			}
+		})
+	}
+}
@@ -53,11 +53,39 @@ func (amf *AMF0) ReadFrom(r Reader) (interface{}, error) {
 	case AMF0TypedObject:
 		return nil, fmt.Errorf("amf0: unsupported type type object")
 	case AMF0AvmplusObject:
-		return nil, fmt.Errorf("amf0: unsupported type avm plus object")
+		return amf.ReadAvmplusObject(r)
 	}
 	return nil, fmt.Errorf("amf0: unsupported type %d", marker)
 }
 
+// ReadAvmplusObject switch to amf3 for the following value,
+// integers converted to float64 as amf0 number
+//  - avmplus-object-marker value-type(amf3)
+func (amf *AMF0) ReadAvmplusObject(r Reader) (data interface{}, err error) {
+	amf3 := &AMF3{}
+	if data, err = amf3.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return asNumber(data), nil
+}
+
+// asNumber converts amf3 integers to float64 recursively
+func asNumber(val interface{}) interface{} {
+	switch v := val.(type) {
+	case int32:
+		return float64(v)
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = asNumber(value)
+		}
+	case []interface{}:
+		for idx, value := range v {
+			v[idx] = asNumber(value)
+		}
+	}
+	return val
+}
+
 // ReadNumber .
 //  - number-marker DOUBLE
 func (amf *AMF0) ReadNumber(r Reader) (data float64, err error) {
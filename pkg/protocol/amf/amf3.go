@@ -35,6 +35,8 @@ func (amf *AMF3) ReadFrom(r Reader) (data interface{}, err error) {
 		return amf.ReadString(r)
 	case AMF3Xmldoc:
 		return nil, fmt.Errorf("amf3: not support to read xml doc")
+	case AMF3Date:
+		return amf.ReadDate(r)
 	case AMF3Array:
 		return amf.ReadArray(r)
 	case AMF3Object:
@@ -66,15 +68,15 @@ func (amf *AMF3) ReadU29(r Reader) (data uint32, err error) {
 		}
 		data = (data << 7) + uint32(b&0x7F)
 		if (b & 0x80) == 0 {
-			return data, fmt.Errorf("error to read first 3 bytes of U29, %s", err)
+			return data, nil
 		}
 	}
 
-	// 4th byte
+	// 4th byte, all 8 bits
 	if b, err = r.ReadByte(); err != nil {
 		return data, fmt.Errorf("error to read 4th byte of U29, %s", err)
 	}
-	return (data << 7) + uint32(b), nil
+	return (data << 8) + uint32(b), nil
 }
 
 // ReadUTF8 .
@@ -326,13 +328,13 @@ func (amf *AMF3) WriteTo(w Writer, val interface{}) (n int, err error) {
 		return amf.WriteFalse(w)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		number := v.Int()
-		if number >= 0 && n <= 0x1FFFFFFF {
+		if number >= 0 && number <= 0x0FFFFFFF {
 			return amf.WriteInteger(w, uint32(number))
 		}
 		return amf.WriteDouble(w, float64(number))
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		number := v.Float()
-		if number <= 0x1FFFFFFF {
+		number := v.Uint()
+		if number <= 0x0FFFFFFF {
 			return amf.WriteInteger(w, uint32(number))
 		}
 		return amf.WriteDouble(w, float64(number))
@@ -366,12 +368,12 @@ func (amf *AMF3) WriteU29(w Writer, val uint32) (n int, err error) {
 		} else {
 			return 1, nil
 		}
-	} else if n <= 0x00003FFF {
-		return w.Write([]byte{byte(n>>7 | 0x80), byte(n & 0x7F)})
-	} else if n <= 0x001FFFFF {
-		return w.Write([]byte{byte(n>>14 | 0x80), byte(n>>7&0x7F | 0x80), byte(n & 0x7F)})
-	} else if n <= 0x1FFFFFFF {
-		return w.Write([]byte{byte(n>>22 | 0x80), byte(n>>15&0x7F | 0x80), byte(n>>8&0x7F | 0x80), byte(n)})
+	} else if val <= 0x00003FFF {
+		return w.Write([]byte{byte(val>>7 | 0x80), byte(val & 0x7F)})
+	} else if val <= 0x001FFFFF {
+		return w.Write([]byte{byte(val>>14 | 0x80), byte(val>>7&0x7F | 0x80), byte(val & 0x7F)})
+	} else if val <= 0x1FFFFFFF {
+		return w.Write([]byte{byte(val>>22 | 0x80), byte(val>>15&0x7F | 0x80), byte(val>>8&0x7F | 0x80), byte(val)})
 	}
 	return 0, fmt.Errorf("amf3: write U29 with value %d (out of range)", val)
 }
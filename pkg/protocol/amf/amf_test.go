@@ -0,0 +1,146 @@
+package amf
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestU29(t *testing.T) {
+	tests := []struct {
+		name  string
+		value uint32
+		data  []byte
+	}{
+		{name: "zero", value: 0x00, data: []byte{0x00}},
+		{name: "1 byte max", value: 0x7F, data: []byte{0x7F}},
+		{name: "2 bytes min", value: 0x80, data: []byte{0x81, 0x00}},
+		{name: "2 bytes max", value: 0x3FFF, data: []byte{0xFF, 0x7F}},
+		{name: "3 bytes min", value: 0x4000, data: []byte{0x81, 0x80, 0x00}},
+		{name: "3 bytes max", value: 0x1FFFFF, data: []byte{0xFF, 0xFF, 0x7F}},
+		{name: "4 bytes min", value: 0x200000, data: []byte{0x80, 0xC0, 0x80, 0x00}},
+		{name: "4 bytes max", value: 0x1FFFFFFF, data: []byte{0xFF, 0xFF, 0xFF, 0xFF}},
+	}
+	amf := &AMF3{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := amf.ReadU29(bytes.NewReader(test.data))
+			if err != nil || value != test.value {
+				t.Fatalf("read %#x %v, expected %#x", value, err, test.value)
+			}
+			buf := &bytes.Buffer{}
+			if n, err := amf.WriteU29(buf, test.value); err != nil || n != len(test.data) {
+				t.Fatalf("written %d bytes %v, expected %d", n, err, len(test.data))
+			}
+			if !bytes.Equal(buf.Bytes(), test.data) {
+				t.Fatalf("written %x, expected %x", buf.Bytes(), test.data)
+			}
+		})
+	}
+}
+
+func TestU29Invalid(t *testing.T) {
+	amf := &AMF3{}
+	if value, err := amf.ReadU29(bytes.NewReader([]byte{0xFF, 0xFF, 0xFF})); err == nil {
+		t.Fatalf("read %#x, expected error of truncated u29", value)
+	}
+	if n, err := amf.WriteU29(&bytes.Buffer{}, 0x20000000); err == nil {
+		t.Fatalf("written %d bytes, expected error of u29 out of range", n)
+	}
+}
+
+func TestInteger(t *testing.T) {
+	tests := []struct {
+		name  string
+		value int32
+		data  []byte
+	}{
+		{name: "positive max", value: 0x0FFFFFFF, data: []byte{AMF3Integer, 0xBF, 0xFF, 0xFF, 0xFF}},
+		{name: "minus one", value: -1, data: []byte{AMF3Integer, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{name: "negative min", value: -0x10000000, data: []byte{AMF3Integer, 0xC0, 0x80, 0x80, 0x00}},
+	}
+	amf := &AMF3{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := amf.ReadFrom(bytes.NewReader(test.data))
+			if err != nil || value != test.value {
+				t.Fatalf("read %v %v, expected %d", value, err, test.value)
+			}
+		})
+	}
+}
+
+func TestAvmplusObject(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected interface{}
+	}{
+		{
+			name: "object",
+			data: []byte{AMF0AvmplusObject, AMF3Object, 0x0B, 0x01,
+				0x03, 'n', AMF3Integer, 0x05,
+				0x03, 's', AMF3String, 0x05, 'h', 'i',
+				0x01},
+			expected: map[string]interface{}{"n": float64(5), "s": "hi"},
+		},
+		{
+			name: "array",
+			data: []byte{AMF0AvmplusObject, AMF3Array, 0x07, 0x01,
+				AMF3Integer, 0x01,
+				AMF3Double, 0x3F, 0xF8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				AMF3String, 0x03, 'a'},
+			expected: []interface{}{float64(1), 1.5, "a"},
+		},
+		{
+			name: "nested",
+			data: []byte{AMF0AvmplusObject, AMF3Object, 0x0B, 0x01,
+				0x03, 'a', AMF3Array, 0x05, 0x01, AMF3Integer, 0xFF, 0xFF, 0xFF, 0xFF, AMF3True,
+				0x03, 'o', AMF3Object, 0x0B, 0x01, 0x03, 'n', AMF3Integer, 0x81, 0x00, 0x01,
+				0x01},
+			expected: map[string]interface{}{
+				"a": []interface{}{float64(-1), true},
+				"o": map[string]interface{}{"n": float64(0x80)},
+			},
+		},
+		{
+			name: "within amf0 object",
+			data: []byte{AMF0Object,
+				0x00, 0x03, 'a', 'm', 'f', AMF0AvmplusObject, AMF3Integer, 0x03,
+				0x00, 0x00, AMF0ObjectEnd},
+			expected: map[string]interface{}{"amf": float64(3)},
+		},
+	}
+	amf := &AMF0{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := amf.ReadFrom(bytes.NewReader(test.data))
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if !reflect.DeepEqual(value, test.expected) {
+				t.Fatalf("read %#v, expected %#v", value, test.expected)
+			}
+		})
+	}
+}
+
+func TestAvmplusObjectInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "missing value", data: []byte{AMF0AvmplusObject}},
+		{name: "unterminated object", data: []byte{AMF0AvmplusObject, AMF3Object, 0x0B, 0x01, 0x03, 'n', AMF3Integer, 0x05}},
+		{name: "short array", data: []byte{AMF0AvmplusObject, AMF3Array, 0x07, 0x01, AMF3Integer, 0x01}},
+		{name: "sealed object", data: []byte{AMF0AvmplusObject, AMF3Object, 0x03, 0x01}},
+	}
+	amf := &AMF0{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if value, err := amf.ReadFrom(bytes.NewReader(test.data)); err == nil {
+				t.Fatalf("read %#v, expected error", value)
+			}
+		})
+	}
+}
@@ -5,13 +5,22 @@ import (
 	"gosm/pkg/config"
 	"gosm/pkg/utils"
 	"os"
+	"path/filepath"
 	"strconv"
 )
 
 var tsPath = config.Global.HLS.TsPath
 var tsPrefix = config.Global.HLS.TsPrefix
 var duration = config.Global.HLS.TsDuration
-var winSize = config.Global.HLS.TsWindow / config.Global.HLS.TsDuration
+var winSize = windowSize(config.Global.HLS.TsWindow, config.Global.HLS.TsDuration)
+
+// windowSize segments in playlist, one if ts duration not configured
+func windowSize(window int, duration int) int {
+	if duration <= 0 {
+		return 1
+	}
+	return window / duration
+}
 
 type TSSegment struct {
 	ID       int
@@ -19,7 +28,7 @@ type TSSegment struct {
 }
 
 type M3U8 struct {
-	path          string       // ts files path
+	path          string       // ts files & playlist path
 	prefix        string       // ts file prefix
 	stream        string       // stream name
 	lastTimestamp uint32       // last ts segment(I-frame) timestamp
@@ -28,9 +37,9 @@ type M3U8 struct {
 	segments      []*TSSegment // ts segments
 }
 
-func NewM3U8(stream string) *M3U8 {
+func NewM3U8(path string, stream string) *M3U8 {
 	m3u8 := &M3U8{
-		path:          tsPath,
+		path:          path,
 		prefix:        tsPrefix,
 		stream:        stream,
 		lastTimestamp: 0,
@@ -41,8 +50,14 @@ func NewM3U8(stream string) *M3U8 {
 	return m3u8
 }
 
+// NextSegment file path of the next ts segment
 func (m3u8 *M3U8) NextSegment() string {
-	return m3u8.prefix + m3u8.stream + "-" + strconv.Itoa(m3u8.sn) + ".ts"
+	return filepath.Join(m3u8.path, m3u8.segmentName(m3u8.sn))
+}
+
+// segmentName ts file name, relative to playlist
+func (m3u8 *M3U8) segmentName(sn int) string {
+	return m3u8.prefix + m3u8.stream + "-" + strconv.Itoa(sn) + ".ts"
 }
 
 // Check check should cut ts segment
@@ -99,7 +114,7 @@ func (m3u8 *M3U8) GenMasterPlaylist() error {
 // GenMediaPlaylist .
 func (m3u8 *M3U8) GenMediaPlaylist() error {
 	// temporary .m3u8
-	fn := strconv.FormatInt(utils.Snowflake.NextID(), 10) + ".m3u8"
+	fn := filepath.Join(m3u8.path, strconv.FormatInt(utils.Snowflake.NextID(), 10)+".m3u8")
 	fp, err := os.Create(fn)
 	if err != nil {
 		return err
@@ -115,7 +130,7 @@ func (m3u8 *M3U8) GenMediaPlaylist() error {
 	// media segment tags
 	for _, segment := range m3u8.segments {
 		duration := segment.Duration
-		fn := m3u8.prefix + m3u8.stream + "-" + strconv.Itoa(segment.ID)
+		fn := m3u8.segmentName(segment.ID)
 		if _, err := fp.WriteString(fmt.Sprintf("#EXTINF:%.3f,\n%s\n", duration, fn)); err != nil {
 			return err
 		}
@@ -125,5 +140,5 @@ func (m3u8 *M3U8) GenMediaPlaylist() error {
 	if err := fp.Close(); err != nil {
 		return err
 	}
-	return os.Rename(fn, m3u8.stream+".m3u8")
+	return os.Rename(fn, filepath.Join(m3u8.path, m3u8.stream+".m3u8"))
 }
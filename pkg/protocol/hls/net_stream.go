@@ -5,6 +5,7 @@ import (
 	"errors"
 	"gosm/pkg/avformat"
 	"gosm/pkg/log"
+	"path/filepath"
 )
 
 // NetStream implements subscribe interface, play as subscriber
@@ -18,13 +19,15 @@ type NetStream struct {
 
 // SubscribeInfo .
 type SubscribeInfo struct {
+	Vhost  string
 	App    string
 	Stream string
 }
 
-func NewNetStream(app string, stream string) (*NetStream, error) {
+// NewNetStream hls files written as {ts_path}/{vhost}/{app}/{stream}.m3u8
+func NewNetStream(vhost string, app string, stream string) (*NetStream, error) {
 	// ts writer
-	w, err := NewWriter(stream)
+	w, err := NewWriter(filepath.Join(tsPath, vhost, app), stream)
 	if err != nil {
 		return nil, err
 	}
@@ -34,6 +37,7 @@ func NewNetStream(app string, stream string) (*NetStream, error) {
 		ctx:    ctx,
 		cancel: cancel,
 		info: &SubscribeInfo{
+			Vhost:  vhost,
 			App:    app,
 			Stream: stream,
 		},
@@ -45,6 +49,11 @@ func NewNetStream(app string, stream string) (*NetStream, error) {
 	return ns, nil
 }
 
+// SetSegmentHandler sets callback of ts fragment file completed, ex. on_record_done hook
+func (ns *NetStream) SetSegmentHandler(handler func(fn string)) {
+	ns.w.onSegment = handler
+}
+
 func (ns *NetStream) writting() {
 	for {
 		select {
@@ -79,5 +88,5 @@ func (ns *NetStream) WriteAVPacket(packet *avformat.AVPacket) error {
 
 // Close .
 func (ns *NetStream) Close() error {
-	return ns.w.tsMuxer.Close()
+	return ns.w.Close()
 }
@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/http"
 	"path"
+	"path/filepath"
 	"strings"
 )
 
@@ -75,8 +76,10 @@ func (server *Server) handleConn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// stream := urls[len(urls)-2]
-	fn := urls[len(urls)-1]
+	// {ts_path}/{vhost}/{app}/{file}, path cleaned by muxer
+	vhost := config.Global.Vhost(r.Host)
+	app := urls[len(urls)-2]
+	fn := filepath.Join(tsPath, vhost, app, urls[len(urls)-1])
 	switch ext {
 	case ".m3u8":
 		w.Header().Add("Server", config.HLS)
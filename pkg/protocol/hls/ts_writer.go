@@ -39,6 +39,7 @@ import (
 //   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 
 type TSMuxer struct {
+	fn     string // file name of current fragment
 	fp     *os.File
 	rw     *bufio.ReadWriter
 	packet []byte
@@ -50,6 +51,7 @@ func NewTSMuxer(fn string) (*TSMuxer, error) {
 		return nil, err
 	}
 	muxer := &TSMuxer{
+		fn:     fn,
 		fp:     fp,
 		rw:     bufio.NewReadWriter(bufio.NewReader(fp), bufio.NewWriter(fp)),
 		packet: make([]byte, 188),
@@ -71,6 +73,7 @@ func (muxer *TSMuxer) Reset(fn string) error {
 	if err != nil {
 		return err
 	}
+	muxer.fn = fn
 	muxer.fp = fp
 	muxer.rw.Reader.Reset(fp)
 	muxer.rw.Writer.Reset(fp)
@@ -212,15 +215,22 @@ type Writer struct {
 	tsMuxer *TSMuxer
 	audioCC uint8
 	videoCC uint8
+
+	// callback of fragment file completed
+	onSegment func(fn string)
 }
 
-func NewWriter(stream string) (w *Writer, err error) {
+// NewWriter ts fragments & playlist of stream written into dir
+func NewWriter(dir string, stream string) (w *Writer, err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
 	w = &Writer{}
 	w.stream = stream
 	w.pesPacket = &bytes.Buffer{}
 	w.avcParser = avc.NewAVCParser(w.pesPacket)
 	w.aacParser = aac.NewAACParser(w.pesPacket)
-	w.m3u8 = NewM3U8(stream)
+	w.m3u8 = NewM3U8(dir, stream)
 	w.tsMuxer, err = NewTSMuxer(w.m3u8.NextSegment())
 	w.audioCC = 0
 	w.videoCC = 0
@@ -228,6 +238,17 @@ func NewWriter(stream string) (w *Writer, err error) {
 	return w, err
 }
 
+// Close close the last fragment file
+func (w *Writer) Close() error {
+	if err := w.tsMuxer.Close(); err != nil {
+		return err
+	}
+	if w.onSegment != nil {
+		w.onSegment(w.tsMuxer.fn)
+	}
+	return nil
+}
+
 // Write
 func (w *Writer) Write(packet *avformat.AVPacket) error {
 	if packet.IsVideo() {
@@ -280,10 +301,14 @@ func (w *Writer) packVideoPES(packet *avformat.AVPacket) error {
 		}
 		// cut ts segment
 		if ok {
+			done := w.tsMuxer.fn
 			fn := w.m3u8.NextSegment()
 			if err := w.tsMuxer.Reset(fn); err != nil {
 				return err
 			}
+			if w.onSegment != nil {
+				w.onSegment(done)
+			}
 		}
 	}
 
@@ -2,47 +2,80 @@ package httpflv
 
 import (
 	"context"
-	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"gosm/pkg/avformat"
 	"gosm/pkg/avformat/flv"
+	"gosm/pkg/config"
 )
 
 // NetStream implements subscribe interface, play as subscriber
 type NetStream struct {
-	ctx    context.Context
-	cancel context.CancelFunc
-	info   *SubscribeInfo
-	fw     *flv.Writer
+	ctx     context.Context
+	cancel  context.CancelFunc
+	info    *SubscribeInfo
+	w       http.ResponseWriter
+	conn    net.Conn // underlying connection, nil if unknown
+	fw      *flv.Writer
+	once    sync.Once  // response started
+	err     error      // error of response start
+	mu      sync.Mutex // writing, response must not be written once handler returned
+	writing uint32     // writing in progress, interrupted once closed
 }
 
 // SubscribeInfo .
 type SubscribeInfo struct {
-	App    string
-	Stream string
+	Vhost      string // resolved by host of request
+	App        string
+	Stream     string
+	Query      string // raw query of request url
+	RemoteAddr string
 }
 
-// NewNetStream .
-func NewNetStream(w io.Writer, app string, stream string) (*NetStream, error) {
-	// flv writer
-	fw, err := flv.NewWriter(w, app, stream)
-	if err != nil {
-		return nil, err
-	}
+// NewNetStream http-flv response is started lazily, either by Start or the first av packet
+func NewNetStream(w http.ResponseWriter, r *http.Request, app string, stream string) (*NetStream, error) {
 	// http flv media stream
 	ctx, cancel := context.WithCancel(context.Background())
 	ns := &NetStream{
 		ctx:    ctx,
 		cancel: cancel,
 		info: &SubscribeInfo{
-			App:    app,
-			Stream: stream,
+			Vhost:      config.Global.Vhost(r.Host),
+			App:        app,
+			Stream:     stream,
+			Query:      r.URL.RawQuery,
+			RemoteAddr: r.RemoteAddr,
 		},
-		fw: fw,
+		w:  w,
+		fw: nil,
 	}
+	ns.conn, _ = r.Context().Value(connKey{}).(net.Conn)
 	return ns, nil
 }
 
+// Start write http response header and flv header once
+func (ns *NetStream) Start() error {
+	ns.once.Do(func() {
+		// header response
+		ns.w.Header().Add("Server", config.HTTPFLV)
+		ns.w.Header().Add("Connection", "Keep-Alive")
+		ns.w.Header().Add("Cache-Control", "no-cache")
+		ns.w.Header().Add("Content-Type", "video/x-flv")
+		// ns.w.Header().Add("Content-Type","octet-stream")
+		ns.w.Header().Add("Transfer-Encoding", "chunked")
+		ns.w.Header().Add("Access-Control-Allow-Origin", "*")
+		ns.w.WriteHeader(200)
+
+		// flv writer
+		ns.fw, ns.err = flv.NewWriter(ns.w, ns.info.App, ns.info.Stream)
+	})
+	return ns.err
+}
+
 /************************************/
 /******** Subscribe Interface *******/
 /************************************/
@@ -54,6 +87,17 @@ func (ns *NetStream) Info() *SubscribeInfo {
 
 // WriteAVPacket .
 func (ns *NetStream) WriteAVPacket(packet *avformat.AVPacket) error {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	// marked before checking, so that either closing sees it or it sees closed
+	atomic.StoreUint32(&ns.writing, 1)
+	defer atomic.StoreUint32(&ns.writing, 0)
+	if err := ns.ctx.Err(); err != nil {
+		return err
+	}
+	if err := ns.Start(); err != nil {
+		return err
+	}
 	flvTag := &flv.Tag{
 		TagHeader: &flv.TagHeader{
 			TagType:   packet.TypeID,
@@ -69,5 +113,16 @@ func (ns *NetStream) WriteAVPacket(packet *avformat.AVPacket) error {
 // Close .
 func (ns *NetStream) Close() error {
 	ns.cancel()
+	// writing may be stalled by peer never reading, response broken anyway
+	if atomic.LoadUint32(&ns.writing) == 1 && ns.conn != nil {
+		ns.conn.SetWriteDeadline(time.Now())
+	}
 	return nil
 }
+
+// wait waits until closed and the writing in progress finished
+func (ns *NetStream) wait() {
+	<-ns.ctx.Done()
+	ns.mu.Lock()
+	ns.mu.Unlock()
+}
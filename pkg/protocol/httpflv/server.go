@@ -2,11 +2,12 @@ package httpflv
 
 import (
 	"context"
+	"errors"
 	"net"
 	"net/http"
 	"strings"
 
-	"gosm/pkg/config"
+	"gosm/pkg/hook"
 	"gosm/pkg/log"
 )
 
@@ -15,6 +16,9 @@ type Observer interface {
 	OnHTTPFlvUnSubscribe(stream *NetStream) error
 }
 
+// connKey context key of underlying connection
+type connKey struct{}
+
 type Server struct {
 	ctx      context.Context
 	network  string
@@ -67,9 +71,15 @@ func (server *Server) Serve() {
 	muxer := http.NewServeMux()
 	muxer.HandleFunc("/", server.handleConn)
 
-	// http server
+	// http server, underlying connection kept in context to interrupt writing stalled by peer
+	httpServer := &http.Server{
+		Handler: muxer,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connKey{}, c)
+		},
+	}
 	go func() {
-		if err := http.Serve(server.listener, muxer); err != nil {
+		if err := httpServer.Serve(server.listener); err != nil {
 			log.Error("%v", err)
 		}
 	}()
@@ -95,29 +105,27 @@ func (server *Server) handleConn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// header response
-	w.Header().Add("Server", config.HTTPFLV)
-	w.Header().Add("Connection", "Keep-Alive")
-	w.Header().Add("Cache-Control", "no-cache")
-	w.Header().Add("Content-Type", "video/x-flv")
-	// w.Header().Add("Content-Type","octet-stream")
-	w.Header().Add("Transfer-Encoding", "chunked")
-	w.Header().Add("Access-Control-Allow-Origin", "*")
-	w.WriteHeader(200)
-
-	// create http-flv media net-stream
-	ns, err := NewNetStream(w, urls[0], urls[1])
+	// create http-flv media net-stream, response started once subscribed
+	ns, err := NewNetStream(w, r, urls[0], urls[1])
 	if err != nil {
 		http.Error(w, "http-flv: create net-stream error", http.StatusInternalServerError)
 		return
 	}
 	if err := server.obs.OnHTTPFlvSubscribe(ns); err != nil {
-		http.Error(w, "http-flv: net-stream subscribes error", http.StatusInternalServerError)
+		log.Debug("HTTP-FLV: subscribe '%s/%s' error, %v", urls[0], urls[1], err)
+		if errors.Is(err, hook.ErrRejected) {
+			http.Error(w, "http-flv: net-stream subscribing forbidden", http.StatusForbidden)
+		} else {
+			http.Error(w, "http-flv: net-stream subscribes error", http.StatusInternalServerError)
+		}
+		return
+	}
+	if err := ns.Start(); err != nil {
 		ns.cancel()
 	}
 
 	// waiting for done
-	<-ns.ctx.Done()
+	ns.wait()
 	if err := server.obs.OnHTTPFlvUnSubscribe(ns); err != nil {
 		log.Error("%v", err)
 	}
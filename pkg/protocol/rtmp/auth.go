@@ -0,0 +1,127 @@
+package rtmp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gosm/pkg/config"
+)
+
+// Authenticator consulted on connect, publish & play, returns nil to accept
+type Authenticator interface {
+	OnConnect(conn *ConnInfo) error
+	OnPublish(conn *ConnInfo, stream *StreamInfo) error
+	OnPlay(conn *ConnInfo, stream *StreamInfo) error
+}
+
+// ErrUnauthorized .
+var ErrUnauthorized = errors.New("RTMP: unauthorized")
+
+// DefaultAuth accepts publishing (and playing if configured) by any of
+//   - stream key:  rtmp://host/app/stream?key=<key>, key configured per 'app/stream'
+//   - token:       rtmp://host/app/stream?token=<token>, token in configured list
+//   - signed url:  rtmp://host/app/stream?expire=<unix>&sign=<hex(hmac-sha256(secret, 'app/stream?expire=<unix>'))>
+type DefaultAuth struct {
+	keys   map[string]string
+	tokens map[string]struct{}
+	secret []byte
+	play   bool
+}
+
+// NewDefaultAuth .
+func NewDefaultAuth(cfg *config.AuthCfg) *DefaultAuth {
+	auth := &DefaultAuth{
+		keys:   cfg.PublishKeys,
+		tokens: make(map[string]struct{}),
+		secret: []byte(cfg.Secret),
+		play:   cfg.Play,
+	}
+	for _, token := range cfg.Tokens {
+		auth.tokens[token] = struct{}{}
+	}
+	return auth
+}
+
+// OnConnect accepts any application, streams are checked one by one
+func (auth *DefaultAuth) OnConnect(conn *ConnInfo) error {
+	return nil
+}
+
+// OnPublish .
+func (auth *DefaultAuth) OnPublish(conn *ConnInfo, stream *StreamInfo) error {
+	return auth.check(conn.App, stream.Name, mergeQuery(conn.Query, stream.Query))
+}
+
+// OnPlay .
+func (auth *DefaultAuth) OnPlay(conn *ConnInfo, stream *StreamInfo) error {
+	if !auth.play {
+		return nil
+	}
+	return auth.check(conn.App, stream.StreamName, mergeQuery(conn.Query, stream.Query))
+}
+
+func (auth *DefaultAuth) check(app, stream string, query url.Values) error {
+	path := app + "/" + stream
+	if key, ok := auth.keys[path]; ok && key != "" && hmac.Equal([]byte(key), []byte(query.Get("key"))) {
+		return nil
+	}
+	if _, ok := auth.tokens[query.Get("token")]; ok && query.Get("token") != "" {
+		return nil
+	}
+	if len(auth.secret) > 0 && query.Get("sign") != "" {
+		return auth.verify(path, query.Get("expire"), query.Get("sign"))
+	}
+	return fmt.Errorf("%w, stream '%s'", ErrUnauthorized, path)
+}
+
+// verify signed url, expired or mismatched rejected
+func (auth *DefaultAuth) verify(path, expire, sign string) error {
+	deadline, err := strconv.ParseInt(expire, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w, stream '%s' invalid expire '%s'", ErrUnauthorized, path, expire)
+	}
+	if time.Now().Unix() > deadline {
+		return fmt.Errorf("%w, stream '%s' url expired", ErrUnauthorized, path)
+	}
+	signature, err := hex.DecodeString(sign)
+	if err != nil || !hmac.Equal(signature, Sign(auth.secret, path, deadline)) {
+		return fmt.Errorf("%w, stream '%s' signature mismatch", ErrUnauthorized, path)
+	}
+	return nil
+}
+
+// Sign hmac-sha256 signature of 'app/stream?expire=<unix>'
+func Sign(secret []byte, path string, expire int64) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(path + "?expire=" + strconv.FormatInt(expire, 10)))
+	return mac.Sum(nil)
+}
+
+// splitQuery split 'name?query' to name and query parameters
+func splitQuery(name string) (string, url.Values) {
+	idx := strings.IndexByte(name, '?')
+	if idx < 0 {
+		return name, url.Values{}
+	}
+	query, _ := url.ParseQuery(name[idx+1:])
+	return name[:idx], query
+}
+
+// mergeQuery stream query prior to connection query
+func mergeQuery(conn, stream url.Values) url.Values {
+	query := url.Values{}
+	for key, values := range conn {
+		query[key] = values
+	}
+	for key, values := range stream {
+		query[key] = values
+	}
+	return query
+}
@@ -61,7 +61,7 @@ func (cmd *Command) WriteTo(w Writer) (n int, err error) {
 	return
 }
 
-func connectSuccess(transactionID uint32) *Command {
+func connectSuccess(transactionID uint32, objectEncoding int) *Command {
 	object := make(map[string]interface{})
 	object["fmsVer"] = "GOSM/0,0,1,0"
 	object["author"] = "Snake"
@@ -71,6 +71,7 @@ func connectSuccess(transactionID uint32) *Command {
 	argument["level"] = "status"
 	argument["code"] = "NetConnection.Connect.Success"
 	argument["description"] = "Connection succeeded."
+	argument["objectEncoding"] = objectEncoding
 
 	return &Command{
 		Name:          "_result",
@@ -79,11 +80,11 @@ func connectSuccess(transactionID uint32) *Command {
 		UserArguments: []interface{}{argument}}
 }
 
-func connectReject(transactionID uint32) *Command {
+func connectReject(transactionID uint32, description string) *Command {
 	argument := make(map[string]interface{})
-	argument["level"] = "status"
+	argument["level"] = "error"
 	argument["code"] = "NetConnection.Connect.Rejected"
-	argument["description"] = "Connection rejected."
+	argument["description"] = description
 
 	return &Command{
 		Name:          "_error",
@@ -113,6 +114,46 @@ func publishStream() *Command {
 		UserArguments: []interface{}{argument}}
 }
 
+func publishBadName(description string) *Command {
+	argument := make(map[string]interface{})
+	argument["level"] = "error"
+	argument["code"] = "NetStream.Publish.BadName"
+	argument["description"] = description
+
+	return &Command{
+		Name:          "onStatus",
+		TransactionID: 0, // transaction id for netstream always 0
+		Objects:       []interface{}{nil},
+		UserArguments: []interface{}{argument}}
+}
+
+// response of FCPublish, see comments of NetConnection.onFCPublish
+func fcPublishBadName(description string) *Command {
+	argument := make(map[string]interface{})
+	argument["level"] = "error"
+	argument["code"] = "NetStream.Publish.BadName"
+	argument["description"] = description
+
+	return &Command{
+		Name:          "onFCPublish",
+		TransactionID: 0,
+		Objects:       []interface{}{nil},
+		UserArguments: []interface{}{argument}}
+}
+
+func playFailed(description string) *Command {
+	argument := make(map[string]interface{})
+	argument["level"] = "error"
+	argument["code"] = "NetStream.Play.Failed"
+	argument["description"] = description
+
+	return &Command{
+		Name:          "onStatus",
+		TransactionID: 0, // transaction id for netstream always 0
+		Objects:       []interface{}{nil},
+		UserArguments: []interface{}{argument}}
+}
+
 func resetStream() *Command {
 	argument := make(map[string]interface{})
 	argument["level"] = "status"
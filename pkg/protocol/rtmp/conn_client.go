@@ -2,20 +2,29 @@ package rtmp
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
-	"gosm/pkg/avformat"
 	"net"
 	"net/url"
 	"strings"
 	"sync/atomic"
+	"time"
+
+	"gosm/pkg/avformat"
+	"gosm/pkg/protocol/amf"
 )
 
 type Client struct {
-	url    *url.URL
-	app    string
-	stream string
-	tid    uint32         // transactionID
-	nc     *NetConnection // rtmp net-connection
+	url      *url.URL
+	app      string
+	stream   string
+	tid      uint32             // transactionID
+	streamID uint32             // net-stream id created by server
+	nc       *NetConnection     // rtmp net-connection
+	tls      *tls.Config        // rtmps only, verify server by url host if nil
+	ns       *NetStream         // playing net-stream, nil if publishing
+	metadata *avformat.MetaData // publishing metadata, given or derived from sequence headers
+	metaSent bool               // '@setDataFrame' sent before media
 }
 
 // NewClient .
@@ -28,16 +37,33 @@ func NewClient(remote string) (*Client, error) {
 	if len(urls) != 2 {
 		return nil, fmt.Errorf("RTMP: parse app & stream error, %v", err)
 	}
+	// query parameters go with stream name, ex. rtmp://host/app/stream?token=xxx
+	stream := urls[1]
+	if url.RawQuery != "" {
+		stream = stream + "?" + url.RawQuery
+	}
 	client := &Client{
-		url:    url,
-		app:    urls[0],
-		stream: urls[1],
-		tid:    0,
-		nc:     nil,
+		url:      url,
+		app:      urls[0],
+		stream:   stream,
+		tid:      0,
+		streamID: 0,
+		nc:       nil,
+		tls:      nil,
 	}
 	return client, nil
 }
 
+// SetMetaData sets metadata sent by publishing, otherwise derived from sequence headers
+func (client *Client) SetMetaData(metadata *avformat.MetaData) {
+	client.metadata = metadata
+}
+
+// SetTLSConfig sets tls config of rtmps, ex. custom root CAs
+func (client *Client) SetTLSConfig(cfg *tls.Config) {
+	client.tls = cfg
+}
+
 // Handshake .
 func (client *Client) Handshake() error {
 	var err error
@@ -45,7 +71,16 @@ func (client *Client) Handshake() error {
 
 	switch strings.ToLower(client.url.Scheme) {
 	case "rtmp":
-		goConn, err = net.Dial("tcp", client.url.Host)
+		goConn, err = net.Dial("tcp", client.hostPort(DefaultPort))
+	case "rtmps":
+		cfg := &tls.Config{}
+		if client.tls != nil {
+			cfg = client.tls.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = client.url.Hostname()
+		}
+		goConn, err = tls.Dial("tcp", client.hostPort(DefaultTLSPort), cfg)
 	default:
 		return fmt.Errorf("RTMP: client not support protocol: %s", client.url.Scheme)
 	}
@@ -55,6 +90,7 @@ func (client *Client) Handshake() error {
 
 	client.nc = NewNetConn(nil, goConn)
 	if err := client.nc.ComplexClientHandshake(); err != nil {
+		client.nc.Close()
 		return err
 	}
 	client.nc.Serve()
@@ -62,16 +98,27 @@ func (client *Client) Handshake() error {
 	return nil
 }
 
+// hostPort url host with default port if absent
+func (client *Client) hostPort(port string) string {
+	if client.url.Port() != "" {
+		return client.url.Host
+	}
+	return net.JoinHostPort(client.url.Hostname(), port)
+}
+
 // Connect .
 func (client *Client) Connect() error {
-	// 1. set chunk size
+	// 1. set chunk size & window acknowledgement size, server acknowledges bytes published
 	if err := client.nc.SetChunkSize(4096); err != nil {
 		return err
 	}
+	if err := client.nc.SetWindowAckSize(); err != nil {
+		return err
+	}
 
 	// 2. command connect()
 	argument := make(map[string]interface{})
-	argument["app"] = "live"
+	argument["app"] = client.app
 	argument["type"] = "nonprivate"
 	argument["flashVer"] = "FMLE/3.0 (compatible; FMSc/1.0)"
 	argument["swfUrl"] = client.url.Scheme + "://" + client.url.Host + "/" + client.app
@@ -79,21 +126,18 @@ func (client *Client) Connect() error {
 
 	connect := &Command{
 		Name:          "connect",
-		TransactionID: atomic.AddUint32(&client.tid, 1),
 		Objects:       []interface{}{},
 		UserArguments: []interface{}{argument},
 	}
-	if err := client.nc.WriteCommand(SIDNetConnnection, connect); err != nil {
-		return err
-	}
 
-	// 3. connect response, onResult(), see code in conn_command.go
-	return nil
+	// 3. connect response, '_result' or '_error'
+	_, err := client.call(SIDNetConnnection, connect, nil)
+	return err
 }
 
 // Publish .
 func (client *Client) Publish() error {
-	// 1. release
+	// 1. release, response not waited as some servers never respond
 	release := &Command{
 		Name:          "releaseStream",
 		TransactionID: atomic.AddUint32(&client.tid, 1),
@@ -104,7 +148,7 @@ func (client *Client) Publish() error {
 		return err
 	}
 
-	// 2. FC publish
+	// 2. FC publish, rejected by 'onFCPublish' status if any
 	fcPublish := &Command{
 		Name:          "FCPublish",
 		TransactionID: atomic.AddUint32(&client.tid, 1),
@@ -116,13 +160,7 @@ func (client *Client) Publish() error {
 	}
 
 	// 3. create stream
-	createStream := &Command{
-		Name:          "createStream",
-		TransactionID: atomic.AddUint32(&client.tid, 1),
-		Objects:       []interface{}{nil},
-		UserArguments: []interface{}{nil},
-	}
-	if err := client.nc.WriteCommand(SIDNetConnnection, createStream); err != nil {
+	if err := client.createStream(nil); err != nil {
 		return err
 	}
 
@@ -133,33 +171,256 @@ func (client *Client) Publish() error {
 		Objects:       []interface{}{nil},
 		UserArguments: []interface{}{client.stream, "live"},
 	}
-	if err := client.nc.WriteCommand(SIDNetStream, publish); err != nil {
+	if err := client.nc.WriteCommand(client.streamID, publish); err != nil {
+		return err
+	}
+	if err := client.waitStatus("publish", "NetStream.Publish.Start"); err != nil {
+		return err
+	}
+
+	// 5. @setDataFrame & onMetadata, if given
+	if client.metadata != nil {
+		return client.writeMetaData()
+	}
+	return nil
+}
+
+// Play .
+func (client *Client) Play() error {
+	// 1. create stream, registered by reading loop once created to receive av packets,
+	// as net-streams are owned by reading loop
+	err := client.createStream(func(streamID uint32) {
+		ns := NewNetStream(streamID, client.nc)
+		ns.info.StreamName, ns.info.Query = splitQuery(client.stream)
+		ns.timer = time.NewTimer(AVReadTimeout)
+		client.nc.streams[streamID] = ns
+		client.ns = ns
+	})
+	if err != nil {
+		return err
+	}
+
+	// 2. play, start -2 for live stream, or recorded one if not found
+	play := &Command{
+		Name:          "play",
+		TransactionID: atomic.AddUint32(&client.tid, 1),
+		Objects:       []interface{}{nil},
+		UserArguments: []interface{}{client.stream, -2},
+	}
+	if err := client.nc.WriteCommand(client.streamID, play); err != nil {
 		return err
 	}
 
-	// 5. @setDataFrame & onMetadata
+	// 3. buffer length in milliseconds
+	if err := client.nc.SetBufferLength(client.streamID, 1000); err != nil {
+		return err
+	}
+	return client.waitStatus("play", "NetStream.Play.Start")
+}
 
+// createStream creates net-stream, id returned by server used by publishing or playing,
+// onCreated called by reading loop with the id if not nil
+func (client *Client) createStream(onCreated func(streamID uint32)) error {
+	createStream := &Command{
+		Name:          "createStream",
+		Objects:       []interface{}{nil},
+		UserArguments: []interface{}{nil},
+	}
+	var onResult func(*Command)
+	if onCreated != nil {
+		onResult = func(response *Command) {
+			if streamID, err := createdStreamID(response); err == nil {
+				onCreated(streamID)
+			}
+		}
+	}
+	response, err := client.call(SIDNetConnnection, createStream, onResult)
+	if err != nil {
+		return err
+	}
+	streamID, err := createdStreamID(response)
+	if err != nil {
+		return err
+	}
+	client.streamID = streamID
 	return nil
 }
 
+// createdStreamID stream id of 'createStream' response
+func createdStreamID(response *Command) (uint32, error) {
+	if commandError("createStream", response) != nil || len(response.Objects) == 0 {
+		return 0, fmt.Errorf("RTMP: command 'createStream' response without stream id")
+	}
+	id, ok := response.Objects[len(response.Objects)-1].(float64)
+	if !ok {
+		return 0, fmt.Errorf("RTMP: command 'createStream' response with invalid stream id")
+	}
+	return uint32(id), nil
+}
+
+// call writes command with new transaction id, and waits for its response within CommandTimeout,
+// onResult called by reading loop before response returned if not nil
+func (client *Client) call(streamID uint32, command *Command, onResult func(*Command)) (*Command, error) {
+	command.TransactionID = atomic.AddUint32(&client.tid, 1)
+	ch := client.nc.trans.add(command.TransactionID, onResult)
+	defer client.nc.trans.remove(command.TransactionID)
+
+	if err := client.nc.WriteCommand(streamID, command); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(CommandTimeout)
+	defer timer.Stop()
+	select {
+	case response := <-ch:
+		return response, commandError(command.Name, response)
+	case <-client.nc.Done():
+		return nil, client.closedError(command.Name)
+	case <-timer.C:
+		return nil, fmt.Errorf("RTMP: command '%s' response timeout", command.Name)
+	}
+}
+
+// waitStatus waits net-stream status within CommandTimeout, until one of expected codes or an error one
+func (client *Client) waitStatus(name string, codes ...string) error {
+	timer := time.NewTimer(CommandTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case status := <-client.nc.trans.status:
+			if err := commandError(name, status); err != nil {
+				return err
+			}
+			_, code, _ := commandInfo(status)
+			for _, expected := range codes {
+				if code == expected {
+					return nil
+				}
+			}
+		case <-client.nc.Done():
+			return client.closedError(name)
+		case <-timer.C:
+			return fmt.Errorf("RTMP: command '%s' status timeout", name)
+		}
+	}
+}
+
+// closedError error of connection closed by server, reason in status queued if any, ex. 'onFCPublish'
+func (client *Client) closedError(name string) error {
+	for {
+		select {
+		case status := <-client.nc.trans.status:
+			if err := commandError(status.Name, status); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("RTMP: command '%s' failed, connection closed", name)
+		}
+	}
+}
+
+/************************************/
+/********* Publish Interface ********/
+/************************************/
+
+// ReadAVPacket read av packets of playing stream, metadata forwarded as '@setDataFrame'
+// like a publisher, other data messages skipped, ex. '|RtmpSampleAccess'
+func (client *Client) ReadAVPacket() (*avformat.AVPacket, error) {
+	if client.ns == nil {
+		return nil, fmt.Errorf("RTMP: client stream '%s' is not playing", client.stream)
+	}
+	for {
+		packet, err := client.ns.ReadAVPacket()
+		if err != nil {
+			return nil, err
+		}
+		if packet.TypeID != avformat.TypeMetadataAMF0 {
+			return packet, nil
+		}
+
+		amf := &amf.AMF0{}
+		if name, err := amf.ReadFrom(bytes.NewReader(packet.Body)); err != nil || name != "onMetaData" {
+			continue
+		}
+		buf := new(bytes.Buffer)
+		if _, err := amf.WriteString(buf, "@setDataFrame"); err != nil {
+			return nil, err
+		}
+		buf.Write(packet.Body)
+		packet.Body = buf.Bytes()
+		packet.Length = uint32(buf.Len())
+		return packet, nil
+	}
+}
+
 /************************************/
 /******** Subscribe Interface *******/
 /************************************/
 
-// WriteAVPacket .
+// WriteAVPacket metadata sent as '@setDataFrame' before the first media frame,
+// derived from sequence headers if neither given nor written, blocked while out buffer is full
 func (client *Client) WriteAVPacket(packet *avformat.AVPacket) error {
+	body := packet.Body
+	switch {
+	case packet.TypeID == avformat.TypeMetadataAMF0:
+		amf := &amf.AMF0{}
+		if name, err := amf.ReadFrom(bytes.NewReader(body)); err == nil && name == "onMetaData" {
+			buf := new(bytes.Buffer)
+			if _, err := amf.WriteString(buf, "@setDataFrame"); err != nil {
+				return err
+			}
+			buf.Write(body)
+			body = buf.Bytes()
+		}
+		client.metaSent = true
+	case !client.metaSent && len(body) >= 2 && (packet.IsAACSeqHeader() || packet.IsAVCSeqHeader() || packet.IsHEVCSeqHeader()):
+		if client.metadata == nil {
+			client.metadata = &avformat.MetaData{}
+		}
+		// best effort, fields of unparsed sequence header left empty
+		client.metadata.Update(packet)
+	case !client.metaSent && client.metadata != nil:
+		if err := client.writeMetaData(); err != nil {
+			return err
+		}
+	}
+
 	message := &Message{
 		TypeID:    packet.TypeID,
-		Length:    packet.Length,
+		Length:    uint32(len(body)),
 		Timestamp: packet.Timestamp,
-		StreamID:  packet.StreamID,
-		Body:      bytes.NewBuffer(packet.Body),
+		StreamID:  client.streamID,
+		Body:      bytes.NewBuffer(body),
 	}
-	return client.nc.AsyncWrite(message)
+	return client.nc.queueWrite(message)
+}
+
+// Done returns a channel closed once the connection is broken or closed
+func (client *Client) Done() <-chan struct{} {
+	return client.nc.Done()
+}
+
+// writeMetaData .
+func (client *Client) writeMetaData() error {
+	body, err := client.metadata.Marshal(true)
+	if err != nil {
+		return err
+	}
+	client.metaSent = true
+	return client.nc.AsyncWrite(&Message{
+		TypeID:    DataAmf0,
+		Length:    uint32(len(body)),
+		Timestamp: 0,
+		StreamID:  client.streamID,
+		Body:      bytes.NewBuffer(body),
+	})
 }
 
 // Close .
 func (client *Client) Close() error {
+	if client.nc == nil {
+		return nil
+	}
 	client.nc.Close()
 	return nil
 }
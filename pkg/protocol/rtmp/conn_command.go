@@ -3,7 +3,9 @@ package rtmp
 import (
 	"bytes"
 	"fmt"
+	"net/url"
 
+	"gosm/pkg/config"
 	"gosm/pkg/log"
 )
 
@@ -29,6 +31,8 @@ func (nc *NetConnection) onCommand(streamID uint32, command *Command) error {
 		case "_error":
 			fallthrough
 		case "onStatus":
+			fallthrough
+		case "onFCPublish":
 			return nc.onResult(command)
 		// commands followed not defined in rtmp-spec-1.0
 		case "releaseStream":
@@ -44,6 +48,11 @@ func (nc *NetConnection) onCommand(streamID uint32, command *Command) error {
 		}
 	}
 
+	// net-stream status for client waiting
+	if command.Name == "onStatus" && nc.trans != nil {
+		nc.trans.resolve(command)
+	}
+
 	// by convention, stream id for net-stream command equals 1
 	if stream, ok := nc.streams[streamID]; ok {
 		return stream.onCommand(command)
@@ -85,19 +94,41 @@ func (nc *NetConnection) onConnect(command *Command) error {
 		if pageURL, ok := obj["pageUrl"]; ok {
 			nc.info.PageURL = pageURL.(string)
 		}
-		if objectEncoding, ok := obj["objectEncoding"]; ok {
-			nc.info.ObjectEncoding = int(objectEncoding.(float64))
+		if objectEncoding, ok := obj["objectEncoding"].(float64); ok {
+			nc.info.ObjectEncoding = int(objectEncoding)
 		}
 	}
 
 	if nc.info.TcURL == "" {
-		return nc.WriteCommand(SIDNetConnnection, connectReject(command.TransactionID))
+		return nc.WriteCommand(SIDNetConnnection, connectReject(command.TransactionID, "Connection rejected."))
+	}
+
+	// query parameters in app, or in tcUrl, ex. rtmp://host/app?token=xxx
+	nc.info.App, nc.info.Query = splitQuery(nc.info.App)
+	tcURL, err := url.Parse(nc.info.TcURL)
+	if err == nil && len(nc.info.Query) == 0 {
+		nc.info.Query = tcURL.Query()
+	}
+
+	// vhost, ex. rtmp://host/app or rtmp://ip/app?vhost=host
+	host := nc.info.Query.Get("vhost")
+	if host == "" && tcURL != nil {
+		host = tcURL.Host
+	}
+	nc.info.Vhost = config.Global.Vhost(host)
+	if auth := nc.authenticator(); auth != nil {
+		if err := auth.OnConnect(nc.info); err != nil {
+			if err := nc.WriteCommand(SIDNetConnnection, connectReject(command.TransactionID, err.Error())); err != nil {
+				return err
+			}
+			return fmt.Errorf("RTMP: connect app '%s' rejected, %w", nc.info.App, err)
+		}
 	}
 
 	nc.SetChunkSize(4096)
 	nc.SetWindowAckSize()
 	nc.SetPeerBandwidth(2500000, BindwidthLimitDynamic)
-	return nc.WriteCommand(SIDNetConnnection, connectSuccess(command.TransactionID))
+	return nc.WriteCommand(SIDNetConnnection, connectSuccess(command.TransactionID, nc.info.ObjectEncoding))
 }
 
 // OnCreateStream .
@@ -121,6 +152,23 @@ func (nc *NetConnection) onCreateStream(command *Command) error {
 // To stop publishing, call "onFCPublish" with an info object with status
 // code set to "NetStream.Publish.BadName".
 func (nc *NetConnection) onFCPublish(command *Command) error {
+	auth := nc.authenticator()
+	if auth == nil || len(command.Objects) < 2 {
+		return nil
+	}
+	name, ok := command.Objects[1].(string)
+	if !ok {
+		return nil
+	}
+	info := &StreamInfo{}
+	info.Name, info.Query = splitQuery(name)
+	if err := auth.OnPublish(nc.info, info); err != nil {
+		if err := nc.WriteCommand(SIDNetConnnection, fcPublishBadName(err.Error())); err != nil {
+			return err
+		}
+		return fmt.Errorf("RTMP: FCPublish stream '%s' rejected, %w", info.Name, err)
+	}
+	nc.fcPublished = name
 	return nil
 }
 
@@ -134,6 +182,7 @@ func (nc *NetConnection) onDeleteStream(command *Command) error {
 	// stream id
 	if id, ok := command.Objects[1].(float64); ok {
 		if stream, ok := nc.streams[uint32(id)]; ok {
+			nc.releaseStream(stream)
 			stream.Close()
 		}
 		delete(nc.streams, uint32(id))
@@ -141,17 +190,52 @@ func (nc *NetConnection) onDeleteStream(command *Command) error {
 	return nil
 }
 
-// OnResult .
+// OnResult response of client commands
 func (nc *NetConnection) onResult(command *Command) error {
+	if nc.trans != nil {
+		nc.trans.resolve(command)
+	}
 	return nil
 }
 
-// WriteCommand write rtmp command response
+// releaseStream notify observer the stream stopped publishing or playing
+func (nc *NetConnection) releaseStream(stream *NetStream) {
+	if nc.server == nil {
+		return
+	}
+	var err error
+	switch {
+	case stream.publishing:
+		err = nc.server.obs.OnRTMPUnPublish(stream)
+	case stream.playing:
+		err = nc.server.obs.OnRTMPUnSubsribe(stream)
+	}
+	if err != nil {
+		log.Error("%v", err)
+	}
+	stream.publishing = false
+	stream.playing = false
+}
+
+// authenticator of server, nil if none or client side connection
+func (nc *NetConnection) authenticator() Authenticator {
+	if nc.server == nil {
+		return nil
+	}
+	return nc.server.auth
+}
+
+// WriteCommand write rtmp command response, in amf3 command message if negotiated by connect
 // @StreamID: 0 -> netConnection, generate by server -> netStream
 func (nc *NetConnection) WriteCommand(streamID uint32, command *Command) error {
 	buf := new(bytes.Buffer)
+	typeID := CommandAmf0
+	if nc.info.ObjectEncoding == ObjectEncodingAMF3 {
+		typeID = CommandAmf3
+		buf.WriteByte(0x00) // format, amf0 encoded values
+	}
 	if _, err := command.WriteTo(buf); err != nil {
 		return err
 	}
-	return nc.WriteMessage(CommandAmf0, streamID, 0, buf.Bytes())
+	return nc.WriteMessage(typeID, streamID, 0, buf.Bytes())
 }
@@ -0,0 +1,122 @@
+package rtmp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"gosm/pkg/protocol/amf"
+)
+
+// readMessage reads chunks until a full message got
+func readMessage(t *testing.T, nc *NetConnection) *Message {
+	for {
+		message, err := nc.Read()
+		if err != nil {
+			t.Fatalf("error to read message: %v", err)
+		}
+		if message != nil {
+			return message
+		}
+	}
+}
+
+// resolved command of transaction, delivered by reading loop
+func resolved(t *testing.T, ch chan *Command) *Command {
+	select {
+	case command := <-ch:
+		return command
+	case <-time.After(time.Second):
+		t.Fatalf("command not resolved")
+	}
+	return nil
+}
+
+func TestWriteCommandAMF3(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	server := NewNetConn(nil, a)
+	server.info.ObjectEncoding = ObjectEncodingAMF3
+	client := NewNetConn(nil, b)
+	ch := client.trans.add(1, nil)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.WriteCommand(SIDNetConnnection, connectSuccess(1, ObjectEncodingAMF3))
+	}()
+	message := readMessage(t, client)
+	if err := <-errs; err != nil {
+		t.Fatalf("error to write command: %v", err)
+	}
+	if message.TypeID != CommandAmf3 || message.Body.Bytes()[0] != 0x00 {
+		t.Fatalf("type %d, format 0x%x, expected type %d of format 0x00", message.TypeID, message.Body.Bytes()[0], CommandAmf3)
+	}
+	if err := client.process(message); err != nil {
+		t.Fatalf("error to process command: %v", err)
+	}
+
+	command := resolved(t, ch)
+	if command.Name != "_result" || command.TransactionID != 1 || len(command.Objects) != 2 {
+		t.Fatalf("command %+v, expected '_result' of transaction 1 with 2 objects", command)
+	}
+	if _, code, _ := commandInfo(command); code != "NetConnection.Connect.Success" {
+		t.Fatalf("code %s, expected NetConnection.Connect.Success", code)
+	}
+	info, _ := command.Objects[1].(map[string]interface{})
+	if info["objectEncoding"] != float64(ObjectEncodingAMF3) {
+		t.Fatalf("object encoding %v, expected %d", info["objectEncoding"], ObjectEncodingAMF3)
+	}
+}
+
+func TestProcessCommandAMF3(t *testing.T) {
+	// format | "_result" | 2 | null | avmplus-object {code: "NetStream.Publish.Start", clientid: 7}
+	body := new(bytes.Buffer)
+	body.WriteByte(0x00)
+	encoder := &amf.AMF0{}
+	encoder.WriteString(body, "_result")
+	encoder.WriteNumber(body, 2)
+	encoder.WriteNull(body)
+	body.Write([]byte{amf.AMF0AvmplusObject, amf.AMF3Object, 0x0B, 0x01,
+		0x09, 'c', 'o', 'd', 'e', amf.AMF3String, 0x2F})
+	body.WriteString("NetStream.Publish.Start")
+	body.Write([]byte{0x11, 'c', 'l', 'i', 'e', 'n', 't', 'i', 'd', amf.AMF3Integer, 0x07, 0x01})
+
+	tests := []struct {
+		name  string
+		body  []byte
+		valid bool
+	}{
+		{name: "avmplus object", body: body.Bytes(), valid: true},
+		{name: "unsupported format", body: append([]byte{0x01}, body.Bytes()[1:]...)},
+		{name: "empty", body: []byte{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := net.Pipe()
+			defer a.Close()
+			defer b.Close()
+			client := NewNetConn(nil, a)
+			ch := client.trans.add(2, nil)
+
+			message := &Message{TypeID: CommandAmf3, Length: uint32(len(test.body)), Body: bytes.NewBuffer(test.body)}
+			err := client.process(message)
+			if !test.valid {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error to process command: %v", err)
+			}
+			command := resolved(t, ch)
+			info, _ := command.Objects[1].(map[string]interface{})
+			if command.Name != "_result" || info["code"] != "NetStream.Publish.Start" || info["clientid"] != float64(7) {
+				t.Fatalf("command %+v, expected '_result' with code & client id", command)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"gosm/pkg/config"
+	"gosm/pkg/log"
+)
+
+// PingInterval interval of ping request & acknowledgement check, 0 to disable both
+var PingInterval = time.Duration(config.Global.RTMP.PingInterval) * time.Second
+
+// AckTimeout max duration the peer may hold acknowledgement once window size bytes sent, 0 to disable
+var AckTimeout = time.Duration(config.Global.RTMP.AckTimeout) * time.Second
+
+// countConn counts bytes read from and written to connection, as sequence number of acknowledgement
+type countConn struct {
+	read    uint64 // first for 64-bit atomic alignment
+	written uint64
+	net.Conn
+}
+
+// Read .
+func (c *countConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddUint64(&c.read, uint64(n))
+	return n, err
+}
+
+// Write .
+func (c *countConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddUint64(&c.written, uint64(n))
+	return n, err
+}
+
+// keepalive state of connection, updated by reading loop and read by others
+type keepalive struct {
+	writtenAtAck uint64    // bytes written when the last acknowledgement received, first for 64-bit atomic alignment
+	start        time.Time // reference of ping timestamp
+	acked        uint32    // sequence number of the last acknowledgement sent
+	peerAcked    uint32    // sequence number of the last acknowledgement received
+	windowSent   uint32    // 1 once window acknowledgement size sent, no acknowledgement expected before
+	rtt          int64     // nano seconds of the last ping round trip
+}
+
+// ackIfNeeded sends acknowledgement once received bytes reached peer's window size
+func (nc *NetConnection) ackIfNeeded() error {
+	sequence := uint32(atomic.LoadUint64(&nc.counter.read))
+	if nc.remoteWindowsSize == 0 || sequence-nc.alive.acked < nc.remoteWindowsSize {
+		return nil
+	}
+	return nc.SetAck(sequence)
+}
+
+// onAcknowledgement records acknowledgement from peer
+func (nc *NetConnection) onAcknowledgement(sequence uint32) {
+	atomic.StoreUint32(&nc.alive.peerAcked, sequence)
+	atomic.StoreUint64(&nc.alive.writtenAtAck, atomic.LoadUint64(&nc.counter.written))
+}
+
+// onPingResponse measures round trip time by timestamp of ping request echoed
+func (nc *NetConnection) onPingResponse(timestamp uint32) {
+	now := uint32(time.Since(nc.alive.start) / time.Millisecond)
+	atomic.StoreInt64(&nc.alive.rtt, int64(now-timestamp)*int64(time.Millisecond))
+}
+
+// RTT round trip time measured by the last ping, 0 if never responded
+func (nc *NetConnection) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&nc.alive.rtt))
+}
+
+// AckLag bytes sent but not acknowledged by peer yet
+func (nc *NetConnection) AckLag() uint32 {
+	return uint32(atomic.LoadUint64(&nc.counter.written)) - atomic.LoadUint32(&nc.alive.peerAcked)
+}
+
+// keepalive pings peer periodically, and closes connection if peer stopped acknowledging,
+// that more than window size bytes sent since the last acknowledgement for ack timeout
+func (nc *NetConnection) keepalive() {
+	if PingInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(PingInterval)
+	defer ticker.Stop()
+
+	var overdue time.Time // since acknowledgement expected
+	for {
+		select {
+		case <-nc.done:
+			return
+		case <-ticker.C:
+		}
+
+		if !nc.ackOverdue() {
+			overdue = time.Time{}
+		} else if overdue.IsZero() {
+			overdue = time.Now()
+		} else if AckTimeout > 0 && time.Since(overdue) > AckTimeout {
+			log.Error("RTMP: peer '%s' stopped acknowledging for %v, %d bytes unacknowledged",
+				nc.info.RemoteAddr, time.Since(overdue).Truncate(time.Second), nc.AckLag())
+			nc.Close()
+			return
+		}
+
+		if err := nc.ping(); err != nil {
+			log.Debug("RTMP: ping '%s' skipped, %v", nc.info.RemoteAddr, err)
+		}
+	}
+}
+
+// ackOverdue whether more than window size bytes sent since the last acknowledgement received,
+// counted locally rather than by sequence number which some peers count in their own way,
+// never overdue if peer was not told window acknowledgement size
+func (nc *NetConnection) ackOverdue() bool {
+	if atomic.LoadUint32(&nc.alive.windowSent) == 0 {
+		return false
+	}
+	written := atomic.LoadUint64(&nc.counter.written)
+	return written-atomic.LoadUint64(&nc.alive.writtenAtAck) > uint64(nc.windowsSize)
+}
+
+// ping user control message ping request, written asynchronously never blocked by a stalled peer
+func (nc *NetConnection) ping() error {
+	message := &Message{
+		TypeID:    UserControlMessages,
+		Length:    6,
+		Timestamp: 0,
+		StreamID:  0,
+		Body:      new(bytes.Buffer),
+	}
+	binary.Write(message.Body, binary.BigEndian, EventPingRequest)
+	binary.Write(message.Body, binary.BigEndian, uint32(time.Since(nc.alive.start)/time.Millisecond))
+	return nc.AsyncWrite(message)
+}
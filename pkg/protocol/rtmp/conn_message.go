@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"time"
+	"sync/atomic"
 
 	"gosm/pkg/log"
 	"gosm/pkg/protocol/amf"
@@ -13,12 +13,6 @@ import (
 func (nc *NetConnection) process(message *Message) error {
 	// log.Debug("%0s message: %+v\n", "C -> S", message)
 
-	// make acknowledgement
-	nc.received += message.Length
-	if nc.received >= nc.remoteWindowsSize {
-		nc.SetAck(nc.received)
-	}
-
 	switch message.TypeID {
 	case SetChunkSize:
 		return nc.processSetChunkSize(message)
@@ -37,11 +31,15 @@ func (nc *NetConnection) process(message *Message) error {
 	case VideoType:
 		return nc.processMediaMessage(message)
 	case AggregateMessageType:
+		return nc.processAggregateMessage(message)
 	case SharedObjectAmf0:
+		fallthrough
 	case SharedObjectAmf3:
+		log.Debug("RTMP: shared object message not supported, ignored")
 	case DataAmf0:
 		return nc.processMediaMessage(message)
 	case DataAmf3:
+		return nc.processDataAMF3(message)
 	case CommandAmf0:
 		return nc.processCommandAMF0(message)
 	case CommandAmf3:
@@ -69,6 +67,11 @@ func (nc *NetConnection) processAbortMessage(message *Message) error {
 }
 
 func (nc *NetConnection) processAcknowledgement(message *Message) error {
+	var sequence uint32
+	if err := binary.Read(message.Body, binary.BigEndian, &sequence); err != nil {
+		return err
+	}
+	nc.onAcknowledgement(sequence)
 	return nil
 }
 
@@ -87,8 +90,17 @@ func (nc *NetConnection) processUserControlMessages(message *Message) error {
 	case EventSetBufferLength:
 	case EventStreamIsRecorded:
 	case EventPingRequest:
-		nc.SetPingResponse(uint32(time.Now().UnixNano() / 1e6))
+		var timestamp uint32
+		if err := binary.Read(message.Body, binary.BigEndian, &timestamp); err != nil {
+			return err
+		}
+		return nc.SetPingResponse(timestamp)
 	case EventPingResponse:
+		var timestamp uint32
+		if err := binary.Read(message.Body, binary.BigEndian, &timestamp); err != nil {
+			return err
+		}
+		nc.onPingResponse(timestamp)
 	case EventRequestVerify:
 	case EventRespondVerify:
 	case EventBufferEmpty:
@@ -130,13 +142,15 @@ func (nc *NetConnection) processCommandAMF0(message *Message) error {
 	if err != nil {
 		return fmt.Errorf("RTMP: command amf0, error to parse name, %s", err)
 	}
-	command.Name = name.(string)
+	command.Name, _ = name.(string)
 
 	transactionID, err := amf.ReadFrom(message.Body)
 	if err != nil {
 		return fmt.Errorf("RTMP: command amf0, error to parse transaction ID, %s", err)
 	}
-	command.TransactionID = uint32(transactionID.(float64))
+	if tid, ok := transactionID.(float64); ok {
+		command.TransactionID = uint32(tid)
+	}
 
 	for message.Body.Len() > 0 {
 		property, err := amf.ReadFrom(message.Body)
@@ -149,8 +163,80 @@ func (nc *NetConnection) processCommandAMF0(message *Message) error {
 	return nc.onCommand(message.StreamID, command)
 }
 
-// TODO: supported
+// processCommandAMF3 amf3 command message, amf0 encoded following a leading 0x00 format byte,
+// values in amf3 switched by avmplus-object-marker
 func (nc *NetConnection) processCommandAMF3(message *Message) error {
+	if err := nc.skipFormat(message); err != nil {
+		return fmt.Errorf("RTMP: command amf3, %s", err)
+	}
+	return nc.processCommandAMF0(message)
+}
+
+// processDataAMF3 amf3 data message, propagated as amf0 one without the leading format byte
+func (nc *NetConnection) processDataAMF3(message *Message) error {
+	if err := nc.skipFormat(message); err != nil {
+		return fmt.Errorf("RTMP: data amf3, %s", err)
+	}
+	message.TypeID = DataAmf0
+	message.Length = uint32(message.Body.Len())
+	return nc.processMediaMessage(message)
+}
+
+// skipFormat skips the leading format byte of amf3 command/data message, 0x00 for amf0
+func (nc *NetConnection) skipFormat(message *Message) error {
+	format, err := message.Body.ReadByte()
+	if err != nil {
+		return fmt.Errorf("error to read format, %s", err)
+	}
+	if format != 0x00 {
+		return fmt.Errorf("unsupported format 0x%x", format)
+	}
+	return nil
+}
+
+// processAggregateMessage splits aggregate message into sub-messages in flv tag format,
+// timestamps rebased on the aggregate message's one
+//  - Type (1byte) | Size (3bytes) | Timestamp (3bytes) | TimestampExtended (1byte) | StreamID (3bytes) | Body | BackPointer (4bytes)
+func (nc *NetConnection) processAggregateMessage(message *Message) error {
+	p := message.Body.Bytes()
+	var base uint32 // timestamp of the first sub-message
+	for pos := 0; pos < len(p); {
+		if pos+11 > len(p) {
+			return fmt.Errorf("RTMP: aggregate message truncated, %d bytes remain", len(p)-pos)
+		}
+		typeID := p[pos]
+		size := int(p[pos+1])<<16 | int(p[pos+2])<<8 | int(p[pos+3])
+		timestamp := uint32(p[pos+7])<<24 | uint32(p[pos+4])<<16 | uint32(p[pos+5])<<8 | uint32(p[pos+6])
+		pos += 11
+		if pos+size+4 > len(p) {
+			return fmt.Errorf("RTMP: aggregate sub-message truncated, size %d, %d bytes remain", size, len(p)-pos)
+		}
+		if pos == 11 {
+			base = timestamp
+		}
+		body := p[pos : pos+size]
+		pos += size
+		if pointer := binary.BigEndian.Uint32(p[pos:]); pointer != uint32(size+11) {
+			return fmt.Errorf("RTMP: aggregate sub-message back pointer %d, expected %d", pointer, size+11)
+		}
+		pos += 4
+
+		switch typeID {
+		case AudioType, VideoType, DataAmf0:
+			sub := &Message{
+				TypeID:    typeID,
+				Length:    uint32(size),
+				Timestamp: message.Timestamp + timestamp - base,
+				StreamID:  message.StreamID,
+				Body:      bytes.NewBuffer(body),
+			}
+			if err := nc.processMediaMessage(sub); err != nil {
+				return err
+			}
+		default:
+			log.Debug("RTMP: aggregate sub-message type %d not supported, ignored", typeID)
+		}
+	}
 	return nil
 }
 
@@ -162,7 +248,7 @@ func (nc *NetConnection) processMediaMessage(message *Message) error {
 	}
 
 	// TODO: maybe block, fix me.
-	if stream.closed {
+	if stream.isClosed() {
 		return fmt.Errorf("RTMP: stream '%s' is closed", stream.info.Name)
 	}
 	stream.avQueue <- message
@@ -221,8 +307,8 @@ func (nc *NetConnection) SetAbortMessage(csid uint32) error {
 	return nil
 }
 
-// SetAck .
-func (nc *NetConnection) SetAck(size uint32) error {
+// SetAck acknowledgement with sequence number, bytes received so far
+func (nc *NetConnection) SetAck(sequence uint32) error {
 	message := &Message{
 		TypeID:    Acknowledgement,
 		Length:    4,
@@ -230,11 +316,11 @@ func (nc *NetConnection) SetAck(size uint32) error {
 		StreamID:  0,
 		Body:      new(bytes.Buffer),
 	}
-	if err := binary.Write(message.Body, binary.BigEndian, size); err != nil {
+	if err := binary.Write(message.Body, binary.BigEndian, sequence); err != nil {
 		return err
 	}
 
-	nc.received = 0
+	nc.alive.acked = sequence
 	return nc.Write(message)
 }
 
@@ -251,7 +337,11 @@ func (nc *NetConnection) SetWindowAckSize() error {
 		return err
 	}
 
-	return nc.Write(message)
+	if err := nc.Write(message); err != nil {
+		return err
+	}
+	atomic.StoreUint32(&nc.alive.windowSent, 1)
+	return nil
 }
 
 // SetPeerBandwidth .
@@ -0,0 +1,136 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// subMessage sub-message of aggregate message in flv tag format
+func subMessage(typeID uint8, timestamp uint32, body []byte) []byte {
+	p := make([]byte, 11, 11+len(body)+4)
+	p[0] = typeID
+	p[1], p[2], p[3] = byte(len(body)>>16), byte(len(body)>>8), byte(len(body))
+	p[4], p[5], p[6], p[7] = byte(timestamp>>16), byte(timestamp>>8), byte(timestamp), byte(timestamp>>24)
+	p = append(p, body...)
+	return append(p, 0, 0, 0, 0)
+}
+
+// aggregate sub-messages with back pointers filled
+func aggregate(subs ...[]byte) []byte {
+	var p []byte
+	for _, sub := range subs {
+		binary.BigEndian.PutUint32(sub[len(sub)-4:], uint32(len(sub)-4))
+		p = append(p, sub...)
+	}
+	return p
+}
+
+func TestProcessAggregateMessage(t *testing.T) {
+	type sub struct {
+		typeID    uint8
+		timestamp uint32
+		body      string
+	}
+	tests := []struct {
+		name      string
+		timestamp uint32
+		body      []byte
+		expected  []sub
+	}{
+		{
+			name:      "audio & video",
+			timestamp: 1000,
+			body: aggregate(
+				subMessage(VideoType, 1000, []byte("v0")),
+				subMessage(AudioType, 1010, []byte("a0")),
+				subMessage(VideoType, 1040, []byte("v1")),
+			),
+			expected: []sub{{VideoType, 1000, "v0"}, {AudioType, 1010, "a0"}, {VideoType, 1040, "v1"}},
+		},
+		{
+			name:      "rebased on aggregate timestamp",
+			timestamp: 5000,
+			body: aggregate(
+				subMessage(VideoType, 0x01000000, []byte("v0")),
+				subMessage(VideoType, 0x01000028, []byte("v1")),
+				subMessage(DataAmf0, 0x01000050, []byte("d0")),
+			),
+			expected: []sub{{VideoType, 5000, "v0"}, {VideoType, 5040, "v1"}, {DataAmf0, 5080, "d0"}},
+		},
+		{
+			name:      "unsupported type ignored",
+			timestamp: 0,
+			body: aggregate(
+				subMessage(CommandAmf0, 0, []byte("c0")),
+				subMessage(AudioType, 20, []byte("a0")),
+			),
+			expected: []sub{{AudioType, 20, "a0"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nc, stream := newAggregateConn(t)
+			message := &Message{TypeID: AggregateMessageType, Timestamp: test.timestamp, StreamID: 1,
+				Length: uint32(len(test.body)), Body: bytes.NewBuffer(test.body)}
+			if err := nc.process(message); err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			close(stream.avQueue)
+			var subs []sub
+			for message := range stream.avQueue {
+				if message.Length != uint32(message.Body.Len()) || message.StreamID != 1 {
+					t.Fatalf("length %d, stream %d of %q", message.Length, message.StreamID, message.Body.String())
+				}
+				subs = append(subs, sub{message.TypeID, message.Timestamp, message.Body.String()})
+			}
+			if !reflect.DeepEqual(subs, test.expected) {
+				t.Fatalf("sub-messages %v, expected %v", subs, test.expected)
+			}
+		})
+	}
+}
+
+func TestProcessAggregateMessageInvalid(t *testing.T) {
+	valid := aggregate(subMessage(VideoType, 0, []byte("v0")), subMessage(AudioType, 20, []byte("a0")))
+	corrupt := append([]byte{}, valid...)
+	corrupt[len(valid)/2-1] = 0xFF // back pointer of the first sub-message
+	oversize := append([]byte{}, valid...)
+	oversize[3] = 0xFF // size of the first sub-message
+
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{name: "truncated header", body: valid[:len(valid)/2+5]},
+		{name: "truncated body", body: valid[:len(valid)/2+12]},
+		{name: "truncated back pointer", body: valid[:len(valid)-2]},
+		{name: "corrupt back pointer", body: corrupt},
+		{name: "corrupt size", body: oversize},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nc, _ := newAggregateConn(t)
+			message := &Message{TypeID: AggregateMessageType, StreamID: 1,
+				Length: uint32(len(test.body)), Body: bytes.NewBuffer(test.body)}
+			if err := nc.process(message); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+// newAggregateConn connection with publishing stream 1
+func newAggregateConn(t *testing.T) (*NetConnection, *NetStream) {
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	nc := NewNetConn(nil, a)
+	stream := NewNetStream(1, nc)
+	nc.streams[1] = stream
+	return nc, stream
+}
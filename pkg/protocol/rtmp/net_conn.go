@@ -5,6 +5,9 @@ import (
 	"bytes"
 	"errors"
 	"net"
+	"net/url"
+	"sync"
+	"time"
 
 	"gosm/pkg/log"
 )
@@ -14,7 +17,7 @@ type ConnInfo struct {
 	App            string
 	FlashVer       string
 	SwfURL         string
-	TcURL          string
+	TcURL          string `json:"-"` // may carry credentials in query, never exposed by api
 	Fpad           bool
 	Capabilities   int
 	AudioCodecs    int
@@ -22,11 +25,15 @@ type ConnInfo struct {
 	VideoFunction  int
 	PageURL        string
 	ObjectEncoding int
+	Query          url.Values `json:"-"` // query parameters of app or tcUrl
+	Vhost          string     // resolved by query 'vhost' or host of tcUrl
+	RemoteAddr     string     // client address
 }
 
 // NetConnection rtmp logical net connection
 type NetConnection struct {
 	goConn               net.Conn
+	counter              *countConn // bytes read & written of goConn
 	rw                   *bufio.ReadWriter
 	chunkSize            uint32
 	remoteChunkSize      uint32
@@ -37,28 +44,40 @@ type NetConnection struct {
 	bandwithLimit        uint8
 	remoteBandwidthLimit uint8
 	chunkStreams         map[uint32]*ChunkStream
-	received             uint32                // received message size
+	alive                *keepalive            // acknowledgement & ping state
+	wmu                  sync.Mutex            // written by reading loop, writing loop & keepalive
 	info                 *ConnInfo             // rtmp connection information
 	outBuffer            chan *Message         // inner writing message buffer
 	streams              map[uint32]*NetStream // client net-streams
 	server               *Server               // rtmp server, for publishing callback
+	fcPublished          string                // stream name authenticated by FCPublish
+	done                 chan struct{}         // closed once reading exit
+	trans                *transactions         // pending commands of client side, nil if server side
 }
 
 // NewNetConn rtmp logical net connection
 func NewNetConn(server *Server, goConn net.Conn) *NetConnection {
+	var trans *transactions
+	if server == nil {
+		trans = newTransactions()
+	}
+	counter := &countConn{Conn: goConn}
 	return &NetConnection{
 		goConn:            goConn,
-		rw:                bufio.NewReadWriter(bufio.NewReader(goConn), bufio.NewWriter(goConn)),
+		counter:           counter,
+		rw:                bufio.NewReadWriter(bufio.NewReader(counter), bufio.NewWriter(counter)),
 		chunkSize:         128,
 		remoteChunkSize:   128,
 		windowsSize:       2500000,
 		remoteWindowsSize: 2500000,
 		chunkStreams:      make(map[uint32]*ChunkStream),
-		received:          0,
-		info:              &ConnInfo{},
+		alive:             &keepalive{start: time.Now()},
+		info:              &ConnInfo{RemoteAddr: goConn.RemoteAddr().String()},
 		outBuffer:         make(chan *Message, 1024),
 		streams:           make(map[uint32]*NetStream),
 		server:            server,
+		done:              make(chan struct{}),
+		trans:             trans,
 	}
 }
 
@@ -67,12 +86,24 @@ func (nc *NetConnection) Close() error {
 	return nc.goConn.Close()
 }
 
+// Done returns a channel closed once the connection is broken or closed
+func (nc *NetConnection) Done() <-chan struct{} {
+	return nc.done
+}
+
 // Serve .
 func (nc *NetConnection) Serve() error {
 	// do loop to read rtmp message
 	go func() {
 		defer func() {
+			for id, stream := range nc.streams {
+				nc.releaseStream(stream)
+				// no more av packets, the only sender is this reading loop
+				close(stream.avQueue)
+				delete(nc.streams, id)
+			}
 			nc.Close()
+			close(nc.done)
 			log.Debug("RTMP: client remote: %v, reading exit", nc.goConn.RemoteAddr())
 		}()
 
@@ -83,6 +114,11 @@ func (nc *NetConnection) Serve() error {
 				return
 			}
 
+			if err := nc.ackIfNeeded(); err != nil {
+				log.Error("RTMP: acknowledgement error, %v", err)
+				return
+			}
+
 			if message == nil {
 				continue
 			}
@@ -108,6 +144,9 @@ func (nc *NetConnection) Serve() error {
 		}
 	}()
 
+	// do loop to ping and check acknowledgement
+	go nc.keepalive()
+
 	return nil
 }
 
@@ -185,6 +224,8 @@ func (nc *NetConnection) Read() (*Message, error) {
 
 // write message to client
 func (nc *NetConnection) Write(message *Message) error {
+	nc.wmu.Lock()
+	defer nc.wmu.Unlock()
 	// log.Debug("%0s message: %+v\n", "S -> C", message)
 	if err := message.WriteTo(nc.rw.Writer, nc.chunkSize); err != nil {
 		return err
@@ -203,3 +244,13 @@ func (nc *NetConnection) AsyncWrite(message *Message) error {
 	nc.outBuffer <- message
 	return nil
 }
+
+// write message to net-connection inner buffer, blocked while buffer is full until connection closed
+func (nc *NetConnection) queueWrite(message *Message) error {
+	select {
+	case nc.outBuffer <- message:
+		return nil
+	case <-nc.done:
+		return errors.New("RTMP: net-connection is closed")
+	}
+}
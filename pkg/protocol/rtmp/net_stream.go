@@ -3,6 +3,8 @@ package rtmp
 import (
 	"bytes"
 	"fmt"
+	"net/url"
+	"sync/atomic"
 	"time"
 
 	"gosm/pkg/avformat"
@@ -22,6 +24,9 @@ type StreamInfo struct {
 	Start      int
 	Duration   int
 	Reset      bool
+
+	// query parameters of stream name, ex. 'stream?token=xxx'
+	Query url.Values
 }
 
 // NetStream rtmp logical net-stream
@@ -31,7 +36,10 @@ type NetStream struct {
 	info    *StreamInfo   // information of publisher or subscriber
 	avQueue chan *Message // for publishing audio/video/metadata message
 	timer   *time.Timer   // for read timeout
-	closed  bool
+	closed  uint32        // 1 once closed, closed by connection or room while read & written by others
+
+	publishing bool // exported to observer as publisher
+	playing    bool // exported to observer as subscriber
 }
 
 // NewNetStream return a new rtmp net-stream
@@ -40,7 +48,7 @@ func NewNetStream(id uint32, nc *NetConnection) *NetStream {
 		id:      id,
 		nc:      nc,
 		info:    &StreamInfo{},
-		closed:  false,
+		closed:  0,
 		timer:   nil,
 		avQueue: make(chan *Message, 1024),
 	}
@@ -61,6 +69,8 @@ func (ns *NetStream) onCommand(command *Command) error {
 		return ns.onPublish(command)
 	case "seek":
 	case "pause":
+	case "onStatus":
+		return ns.onStatus(command)
 	default:
 		return fmt.Errorf("RTMP: unsupport net-stream command type: %s", command.Name)
 	}
@@ -71,13 +81,23 @@ func (ns *NetStream) onCommand(command *Command) error {
 func (ns *NetStream) onPlay(command *Command) error {
 	// stream name
 	if name, ok := command.Objects[1].(string); ok {
-		ns.info.StreamName = name
+		ns.info.StreamName, ns.info.Query = splitQuery(name)
 	}
 	// start
 	if start, ok := command.Objects[2].(int); ok {
 		ns.info.Start = start
 	}
 
+	// authenticate
+	if auth := ns.nc.authenticator(); auth != nil {
+		if err := auth.OnPlay(ns.nc.info, ns.info); err != nil {
+			if err := ns.nc.WriteCommand(ns.id, playFailed(err.Error())); err != nil {
+				return err
+			}
+			return fmt.Errorf("RTMP: play stream '%s' rejected, %w", ns.info.StreamName, err)
+		}
+	}
+
 	// set chunksize
 	if err := ns.nc.SetChunkSize(ns.nc.chunkSize); err != nil {
 		return err
@@ -103,6 +123,7 @@ func (ns *NetStream) onPlay(command *Command) error {
 	if err := ns.nc.server.obs.OnRTMPSubscribe(ns); err != nil {
 		return err
 	}
+	ns.playing = true
 
 	return nil
 }
@@ -110,14 +131,23 @@ func (ns *NetStream) onPlay(command *Command) error {
 // OnPublish .
 func (ns *NetStream) onPublish(command *Command) error {
 	// stream name
-	if name, ok := command.Objects[1].(string); ok {
-		ns.info.Name = name
-	}
+	name, _ := command.Objects[1].(string)
+	ns.info.Name, ns.info.Query = splitQuery(name)
 	// stream type
 	if t, ok := command.Objects[2].(string); ok {
 		ns.info.Type = t
 	}
 
+	// authenticate, unless already done by FCPublish with the same name
+	if auth := ns.nc.authenticator(); auth != nil && (name == "" || name != ns.nc.fcPublished) {
+		if err := auth.OnPublish(ns.nc.info, ns.info); err != nil {
+			if err := ns.nc.WriteCommand(ns.id, publishBadName(err.Error())); err != nil {
+				return err
+			}
+			return fmt.Errorf("RTMP: publish stream '%s' rejected, %w", ns.info.Name, err)
+		}
+	}
+
 	// make response
 	if err := ns.nc.WriteCommand(SIDNetStream, publishStream()); err != nil {
 		return err
@@ -128,10 +158,30 @@ func (ns *NetStream) onPublish(command *Command) error {
 	if err := ns.nc.server.obs.OnRTMPPublish(ns); err != nil {
 		return err
 	}
+	ns.publishing = true
 
 	return nil
 }
 
+// OnStatus status of playing stream, client side only
+func (ns *NetStream) onStatus(command *Command) error {
+	if len(command.Objects) < 2 {
+		return nil
+	}
+	info, ok := command.Objects[1].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	level, _ := info["level"].(string)
+	code, _ := info["code"].(string)
+	description, _ := info["description"].(string)
+	// failed or stopped, no more av packets
+	if level == "error" || code == "NetStream.Play.Stop" || code == "NetStream.Play.UnpublishNotify" {
+		return fmt.Errorf("RTMP: stream '%s' status %s, %s", ns.info.StreamName, code, description)
+	}
+	return nil
+}
+
 // OnDeleteStream .
 func (ns *NetStream) onDeleteStream(command *Command) error {
 	return ns.nc.onDeleteStream(command)
@@ -153,7 +203,7 @@ func (ns *NetStream) ConnInfo() *ConnInfo {
 
 // ReadAVPacket read with timeout
 func (ns *NetStream) ReadAVPacket() (*avformat.AVPacket, error) {
-	if ns.closed {
+	if ns.isClosed() {
 		return nil, fmt.Errorf("RTMP: stream '%s' is closed", ns.info.Name)
 	}
 
@@ -180,9 +230,9 @@ func (ns *NetStream) ReadAVPacket() (*avformat.AVPacket, error) {
 /******** Subscribe Interface *******/
 /************************************/
 
-// WriteAVPacket non-block write
+// WriteAVPacket blocked while out buffer is full, written by subscriber's own goroutine
 func (ns *NetStream) WriteAVPacket(packet *avformat.AVPacket) error {
-	if ns.closed {
+	if ns.isClosed() {
 		return fmt.Errorf("RTMP: stream id '%d' is closed", ns.id)
 	}
 
@@ -194,12 +244,17 @@ func (ns *NetStream) WriteAVPacket(packet *avformat.AVPacket) error {
 		Body:      bytes.NewBuffer(packet.Body),
 	}
 
-	return ns.nc.AsyncWrite(message)
+	return ns.nc.queueWrite(message)
 }
 
 // Close .
 func (ns *NetStream) Close() error {
-	ns.closed = true
+	atomic.StoreUint32(&ns.closed, 1)
 	ns.nc.Close()
 	return nil
 }
+
+// isClosed .
+func (ns *NetStream) isClosed() bool {
+	return atomic.LoadUint32(&ns.closed) == 1
+}
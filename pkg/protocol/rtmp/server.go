@@ -2,9 +2,11 @@ package rtmp
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
+	"time"
 
 	"gosm/pkg/log"
 )
@@ -22,6 +24,8 @@ type Server struct {
 	address  string
 	listener net.Listener
 	obs      Observer
+	tls      *tls.Config   // rtmps if not nil
+	auth     Authenticator // accept all if nil
 }
 
 // NewServer .
@@ -45,11 +49,33 @@ func NewServer(network string, address string) (*Server, func(), error) {
 	return server, closeFunc, nil
 }
 
+// NewTLSServer rtmps server, rtmp over tls with certificate & key in PEM format
+func NewTLSServer(network string, address string, certFile string, keyFile string) (*Server, func(), error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("RTMPS: load certificate error, %v", err)
+	}
+	server, closeFunc, err := NewServer(network, address)
+	if err != nil {
+		return nil, nil, err
+	}
+	server.tls = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	return server, closeFunc, nil
+}
+
 // SetObserver .
 func (server *Server) SetObserver(obs Observer) {
 	server.obs = obs
 }
 
+// SetAuthenticator sets authenticator of connect, publish & play
+func (server *Server) SetAuthenticator(auth Authenticator) {
+	server.auth = auth
+}
+
 // Serve .
 func (server *Server) Serve() {
 	if server.obs == nil {
@@ -61,7 +87,12 @@ func (server *Server) Serve() {
 	if err != nil {
 		log.Fatal("RTMP: server listen error, %v", err)
 	}
-	log.Info("RTMP: server listen on %s", server.listener.Addr())
+	if server.tls != nil {
+		server.listener = tls.NewListener(server.listener, server.tls)
+		log.Info("RTMPS: server listen on %s", server.listener.Addr())
+	} else {
+		log.Info("RTMP: server listen on %s", server.listener.Addr())
+	}
 
 	go func() {
 		for {
@@ -85,6 +116,16 @@ func (server *Server) Serve() {
 
 // handleConn .
 func (server *Server) handleConn(goConn net.Conn) error {
+	// tls handshake within timeout, instead of lazily by the first read of rtmp handshake
+	if tlsConn, ok := goConn.(*tls.Conn); ok {
+		tlsConn.SetDeadline(time.Now().Add(Timeout))
+		if err := tlsConn.Handshake(); err != nil {
+			goConn.Close()
+			return fmt.Errorf("RTMPS: server tls handshake error, %w", err)
+		}
+		tlsConn.SetDeadline(time.Time{})
+	}
+
 	rtmpConn := NewNetConn(server, goConn)
 
 	if err := rtmpConn.ServerHandshake(); err != nil {
@@ -0,0 +1,96 @@
+package rtmp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CommandTimeout max duration waiting for command response
+var CommandTimeout = 10 * time.Second
+
+// transactions client side pending commands, correlated with '_result' or '_error' by transaction id,
+// net-stream status ('onStatus' or 'onFCPublish') queued in order as its transaction id is 0 by convention
+type transactions struct {
+	mu      sync.Mutex
+	pending map[uint32]*pending
+	status  chan *Command
+}
+
+// pending command waiting for response
+type pending struct {
+	ch       chan *Command
+	onResult func(*Command) // called by reading loop before delivered, nil if none
+}
+
+// newTransactions .
+func newTransactions() *transactions {
+	return &transactions{
+		pending: make(map[uint32]*pending),
+		status:  make(chan *Command, 16),
+	}
+}
+
+// add registers pending command before writing, so that response never missed,
+// onResult called by reading loop before response delivered if not nil
+func (t *transactions) add(tid uint32, onResult func(*Command)) chan *Command {
+	ch := make(chan *Command, 1)
+	t.mu.Lock()
+	t.pending[tid] = &pending{ch: ch, onResult: onResult}
+	t.mu.Unlock()
+	return ch
+}
+
+// remove .
+func (t *transactions) remove(tid uint32) {
+	t.mu.Lock()
+	delete(t.pending, tid)
+	t.mu.Unlock()
+}
+
+// resolve delivers response to pending command or status queue, dropped if nobody waiting
+func (t *transactions) resolve(command *Command) {
+	if command.TransactionID == 0 {
+		select {
+		case t.status <- command:
+		default:
+		}
+		return
+	}
+
+	t.mu.Lock()
+	p, ok := t.pending[command.TransactionID]
+	delete(t.pending, command.TransactionID)
+	t.mu.Unlock()
+	if ok {
+		if p.onResult != nil {
+			p.onResult(command)
+		}
+		p.ch <- command
+	}
+}
+
+// commandInfo information object of response, see rtmp-spec-1.0 section 7.2.1.1 connect
+func commandInfo(command *Command) (level string, code string, description string) {
+	for _, object := range command.Objects {
+		if info, ok := object.(map[string]interface{}); ok {
+			if _, ok := info["code"]; !ok {
+				continue
+			}
+			level, _ = info["level"].(string)
+			code, _ = info["code"].(string)
+			description, _ = info["description"].(string)
+			return
+		}
+	}
+	return
+}
+
+// commandError error of '_error' response, or status in 'error' level
+func commandError(name string, command *Command) error {
+	level, code, description := commandInfo(command)
+	if command.Name == "_error" || level == "error" {
+		return fmt.Errorf("RTMP: command '%s' failed, %s, %s", name, code, description)
+	}
+	return nil
+}
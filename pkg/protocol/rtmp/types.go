@@ -1,5 +1,11 @@
 package rtmp
 
+// Default ports of url without port
+const (
+	DefaultPort    = "1935"
+	DefaultTLSPort = "443"
+)
+
 // Message Type
 const (
 	SetChunkSize         = uint8(1)  // Set Chunk Size
@@ -19,6 +25,12 @@ const (
 	CommandAmf3          = uint8(17) // Command Message
 )
 
+// Object Encoding, negotiated by connect
+const (
+	ObjectEncodingAMF0 = 0
+	ObjectEncodingAMF3 = 3
+)
+
 // Stream ID
 const (
 	SIDNetConnnection = uint32(0)
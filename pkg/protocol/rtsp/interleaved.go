@@ -0,0 +1,149 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"gosm/pkg/log"
+)
+
+// InterleavedMagic leading byte of interleaved binary data, see rfc2326 section 10.12
+//
+//	'$' | channel(8) | length(16) | data
+const InterleavedMagic = '$'
+
+// interleavedConn rtp/rtcp packet conn over rtsp tcp connection,
+// reading from channels dispatched by rtsp connection, writing to the first channel
+type interleavedConn struct {
+	nc        *NetConnection
+	channel   uint8
+	queue     chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newInterleavedConn(nc *NetConnection, channel uint8) *interleavedConn {
+	return &interleavedConn{
+		nc:      nc,
+		channel: channel,
+		queue:   make(chan []byte, 512),
+		done:    make(chan struct{}),
+	}
+}
+
+// push packet from rtsp connection, drop if conn closed or queue is full,
+// never blocking reading loop, ex. channel of playing read by nobody
+func (conn *interleavedConn) push(data []byte) bool {
+	if conn.isClosed() {
+		return false
+	}
+	select {
+	case conn.queue <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadFrom .
+func (conn *interleavedConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	if conn.isClosed() {
+		return 0, nil, net.ErrClosed
+	}
+	select {
+	case <-conn.done:
+		return 0, nil, net.ErrClosed
+	case data := <-conn.queue:
+		return copy(p, data), conn.nc.goConn.RemoteAddr(), nil
+	}
+}
+
+// WriteTo write packet as interleaved frame, addr is ignored
+func (conn *interleavedConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if conn.isClosed() {
+		return 0, net.ErrClosed
+	}
+	if err := conn.nc.WriteInterleaved(conn.channel, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close .
+func (conn *interleavedConn) Close() error {
+	conn.closeOnce.Do(func() {
+		close(conn.done)
+	})
+	return nil
+}
+
+// isClosed .
+func (conn *interleavedConn) isClosed() bool {
+	select {
+	case <-conn.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// LocalAddr .
+func (conn *interleavedConn) LocalAddr() net.Addr {
+	return conn.nc.goConn.LocalAddr()
+}
+
+// SetDeadline not supported
+func (conn *interleavedConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// SetReadDeadline not supported
+func (conn *interleavedConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline not supported
+func (conn *interleavedConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// readInterleaved read one interleaved frame and dispatch to channel's conn, drop if unbound
+func (nc *NetConnection) readInterleaved() error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(nc.rw.Reader, header); err != nil {
+		return err
+	}
+	if header[0] != InterleavedMagic {
+		return fmt.Errorf("RTSP: invalid interleaved magic 0x%02x", header[0])
+	}
+	data := make([]byte, binary.BigEndian.Uint16(header[2:]))
+	if _, err := io.ReadFull(nc.rw.Reader, data); err != nil {
+		return err
+	}
+	if conn, ok := nc.channels[header[1]]; ok && !conn.push(data) {
+		log.Debug("RTSP: interleaved channel %d is closed or full, packet dropped", header[1])
+	}
+	return nil
+}
+
+// WriteInterleaved write data as interleaved frame on channel
+func (nc *NetConnection) WriteInterleaved(channel uint8, data []byte) error {
+	if len(data) > 0xFFFF {
+		return fmt.Errorf("RTSP: interleaved data too large, %d bytes", len(data))
+	}
+	header := []byte{InterleavedMagic, channel, byte(len(data) >> 8), byte(len(data))}
+
+	nc.wmu.Lock()
+	defer nc.wmu.Unlock()
+	if _, err := nc.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := nc.rw.Write(data); err != nil {
+		return err
+	}
+	return nc.rw.Flush()
+}
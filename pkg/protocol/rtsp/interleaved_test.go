@@ -0,0 +1,150 @@
+package rtsp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+// newBufferedConn rtsp connection reading from bytes, writing to buffer
+func newBufferedConn(t *testing.T, in []byte) (*NetConnection, *bytes.Buffer) {
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	out := new(bytes.Buffer)
+	nc := NewNetConn(nil, a)
+	nc.rw = bufio.NewReadWriter(bufio.NewReader(bytes.NewReader(in)), bufio.NewWriter(out))
+	return nc, out
+}
+
+// interleaved frame: '$' | channel | length | data
+func frame(channel uint8, data string) []byte {
+	return append([]byte{InterleavedMagic, channel, byte(len(data) >> 8), byte(len(data))}, data...)
+}
+
+func TestReadInterleaved(t *testing.T) {
+	var in []byte
+	in = append(in, frame(0, "rtp-0")...)
+	in = append(in, frame(5, "unbound")...)
+	in = append(in, frame(1, "rtcp-0")...)
+	in = append(in, frame(0, "")...)
+	in = append(in, frame(0, string(make([]byte, 0xFFFF)))...)
+
+	nc, _ := newBufferedConn(t, in)
+	rtpConn, rtcpConn := newInterleavedConn(nc, 0), newInterleavedConn(nc, 1)
+	nc.channels[0], nc.channels[1] = rtpConn, rtcpConn
+	for idx := 0; idx < 5; idx++ {
+		if err := nc.readInterleaved(); err != nil {
+			t.Fatalf("frame %d: error %v", idx, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		conn     *interleavedConn
+		expected []string
+	}{
+		{name: "rtp channel", conn: rtpConn, expected: []string{"rtp-0", "", string(make([]byte, 0xFFFF))}},
+		{name: "rtcp channel", conn: rtcpConn, expected: []string{"rtcp-0"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if len(test.conn.queue) != len(test.expected) {
+				t.Fatalf("%d packets queued, expected %d", len(test.conn.queue), len(test.expected))
+			}
+			buf := make([]byte, 0x10000)
+			for _, expected := range test.expected {
+				n, addr, err := test.conn.ReadFrom(buf)
+				if err != nil || string(buf[:n]) != expected || addr == nil {
+					t.Fatalf("read %d bytes from %v, error %v, expected %d bytes", n, addr, err, len(expected))
+				}
+			}
+		})
+	}
+}
+
+func TestReadInterleavedInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{name: "empty", in: nil},
+		{name: "invalid magic", in: []byte{'R', 'T', 'S', 'P'}},
+		{name: "truncated header", in: []byte{InterleavedMagic, 0x00, 0x00}},
+		{name: "truncated data", in: frame(0, "rtp-0")[:7]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nc, _ := newBufferedConn(t, test.in)
+			nc.channels[0] = newInterleavedConn(nc, 0)
+			if err := nc.readInterleaved(); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestInterleavedConnPush(t *testing.T) {
+	nc, _ := newBufferedConn(t, nil)
+	conn := newInterleavedConn(nc, 0)
+	for idx := 0; idx < cap(conn.queue); idx++ {
+		if !conn.push([]byte{byte(idx)}) {
+			t.Fatalf("packet %d dropped, expected queued", idx)
+		}
+	}
+	if conn.push([]byte{0xFF}) {
+		t.Fatalf("packet queued, expected dropped if queue is full")
+	}
+
+	// queued packets dropped once closed
+	conn.ReadFrom(make([]byte, 16))
+	conn.Close()
+	if conn.push([]byte{0xFF}) {
+		t.Fatalf("packet queued, expected dropped if closed")
+	}
+	if n, _, err := conn.ReadFrom(make([]byte, 16)); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("read %d bytes, error %v, expected %v", n, err, net.ErrClosed)
+	}
+}
+
+func TestWriteInterleaved(t *testing.T) {
+	tests := []struct {
+		name     string
+		channel  uint8
+		data     []byte
+		expected []byte
+	}{
+		{name: "rtp", channel: 0, data: []byte("rtp-0"), expected: frame(0, "rtp-0")},
+		{name: "rtcp", channel: 3, data: []byte("rtcp-1"), expected: frame(3, "rtcp-1")},
+		{name: "max size", channel: 0, data: make([]byte, 0xFFFF), expected: frame(0, string(make([]byte, 0xFFFF)))},
+		{name: "too large", channel: 0, data: make([]byte, 0x10000)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nc, out := newBufferedConn(t, nil)
+			conn := newInterleavedConn(nc, test.channel)
+			n, err := conn.WriteTo(test.data, nil)
+			if test.expected == nil {
+				if err == nil || out.Len() != 0 {
+					t.Fatalf("written %d bytes, expected error", out.Len())
+				}
+				return
+			}
+			if err != nil || n != len(test.data) {
+				t.Fatalf("written %d bytes, error %v, expected %d", n, err, len(test.data))
+			}
+			if !bytes.Equal(out.Bytes(), test.expected) {
+				t.Fatalf("written %x, expected %x", out.Bytes()[:4], test.expected[:4])
+			}
+
+			conn.Close()
+			if _, err := conn.WriteTo(test.data, nil); !errors.Is(err, net.ErrClosed) {
+				t.Fatalf("error %v, expected %v", err, net.ErrClosed)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package rtsp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Request RTSP request message
+//
+//	Method SP Request-URI SP RTSP-Version CRLF
+//	*(general-header | request-header | entity-header) CRLF
+//	CRLF
+//	[ message-body ]
+type Request struct {
+	Method string
+	URL    *url.URL
+	Proto  string
+	Header textproto.MIMEHeader
+	Body   []byte
+}
+
+// CSeq .
+func (req *Request) CSeq() string {
+	return req.Header.Get("CSeq")
+}
+
+// Session session id without timeout parameter
+func (req *Request) Session() string {
+	return strings.TrimSpace(strings.SplitN(req.Header.Get("Session"), ";", 2)[0])
+}
+
+// ReadRequest read a full request from reader
+func ReadRequest(br *bufio.Reader) (*Request, error) {
+	tp := textproto.NewReader(br)
+
+	// request line
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("RTSP: malformed request line '%s'", line)
+	}
+	req := &Request{
+		Method: parts[0],
+		Proto:  parts[2],
+	}
+	if req.Proto != Version {
+		return nil, fmt.Errorf("RTSP: unsupported protocol version '%s'", req.Proto)
+	}
+	if req.URL, err = url.Parse(parts[1]); err != nil {
+		return nil, fmt.Errorf("RTSP: malformed request url '%s', %v", parts[1], err)
+	}
+
+	// headers
+	if req.Header, err = tp.ReadMIMEHeader(); err != nil {
+		return nil, err
+	}
+
+	// body
+	if length := req.Header.Get("Content-Length"); length != "" {
+		size, err := strconv.Atoi(length)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("RTSP: invalid content length '%s'", length)
+		}
+		req.Body = make([]byte, size)
+		if _, err := io.ReadFull(br, req.Body); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// Response RTSP response message
+//
+//	RTSP-Version SP Status-Code SP Reason-Phrase CRLF
+//	*(general-header | response-header | entity-header) CRLF
+//	CRLF
+//	[ message-body ]
+type Response struct {
+	StatusCode int
+	Header     map[string]string
+	Body       []byte
+}
+
+// NewResponse response with CSeq copied from request
+func NewResponse(req *Request, code int) *Response {
+	res := &Response{
+		StatusCode: code,
+		Header:     make(map[string]string),
+		Body:       nil,
+	}
+	res.Header["CSeq"] = req.CSeq()
+	return res
+}
+
+// WriteTo write response to writer
+func (res *Response) WriteTo(w io.Writer) (int64, error) {
+	buf := new(bytes.Buffer)
+
+	// status line
+	reason, ok := StatusText[res.StatusCode]
+	if !ok {
+		reason = "Unknown"
+	}
+	fmt.Fprintf(buf, "%s %d %s\r\n", Version, res.StatusCode, reason)
+
+	// headers, CSeq first, others in order
+	if cseq, ok := res.Header["CSeq"]; ok {
+		fmt.Fprintf(buf, "CSeq: %s\r\n", cseq)
+	}
+	keys := make([]string, 0, len(res.Header))
+	for key := range res.Header {
+		if key != "CSeq" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(buf, "%s: %s\r\n", key, res.Header[key])
+	}
+	if len(res.Body) > 0 {
+		fmt.Fprintf(buf, "Content-Length: %d\r\n", len(res.Body))
+	}
+	buf.WriteString("\r\n")
+	buf.Write(res.Body)
+
+	return buf.WriteTo(w)
+}
@@ -0,0 +1,126 @@
+package rtsp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		method  string
+		path    string
+		cseq    string
+		session string
+		body    string
+	}{
+		{
+			name:   "options",
+			raw:    "OPTIONS rtsp://127.0.0.1:554/live/stream RTSP/1.0\r\nCSeq: 1\r\nUser-Agent: test\r\n\r\n",
+			method: MethodOptions,
+			path:   "/live/stream",
+			cseq:   "1",
+		},
+		{
+			name:    "session with timeout",
+			raw:     "PLAY rtsp://127.0.0.1/live/stream?token=x RTSP/1.0\r\nCSeq: 4\r\nSession: 12345678;timeout=60\r\nRange: npt=0.000-\r\n\r\n",
+			method:  MethodPlay,
+			path:    "/live/stream",
+			cseq:    "4",
+			session: "12345678",
+		},
+		{
+			name:   "announce with body",
+			raw:    "ANNOUNCE rtsp://127.0.0.1/live/stream RTSP/1.0\r\ncseq: 2\r\nContent-Type: application/sdp\r\nContent-Length: 5\r\n\r\nv=0\r\nOPTIONS",
+			method: MethodAnnounce,
+			path:   "/live/stream",
+			cseq:   "2",
+			body:   "v=0\r\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := ReadRequest(bufio.NewReader(strings.NewReader(test.raw)))
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if req.Method != test.method || req.URL.Path != test.path || req.CSeq() != test.cseq {
+				t.Fatalf("%s %s cseq %s, expected %s %s cseq %s", req.Method, req.URL.Path, req.CSeq(),
+					test.method, test.path, test.cseq)
+			}
+			if req.Session() != test.session || string(req.Body) != test.body {
+				t.Fatalf("session %q body %q, expected %q %q", req.Session(), req.Body, test.session, test.body)
+			}
+		})
+	}
+}
+
+func TestReadRequestInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "empty", raw: ""},
+		{name: "malformed request line", raw: "OPTIONS RTSP/1.0\r\n\r\n"},
+		{name: "unsupported version", raw: "OPTIONS rtsp://127.0.0.1/live RTSP/2.0\r\nCSeq: 1\r\n\r\n"},
+		{name: "malformed url", raw: "OPTIONS rtsp://[::1 RTSP/1.0\r\nCSeq: 1\r\n\r\n"},
+		{name: "invalid content length", raw: "ANNOUNCE rtsp://127.0.0.1/live RTSP/1.0\r\nContent-Length: -1\r\n\r\n"},
+		{name: "truncated body", raw: "ANNOUNCE rtsp://127.0.0.1/live RTSP/1.0\r\nContent-Length: 10\r\n\r\nv=0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if req, err := ReadRequest(bufio.NewReader(strings.NewReader(test.raw))); err == nil {
+				t.Fatalf("request %+v, expected error", req)
+			}
+		})
+	}
+}
+
+func TestResponseWriteTo(t *testing.T) {
+	req := &Request{Header: map[string][]string{"Cseq": {"3"}}}
+	tests := []struct {
+		name     string
+		code     int
+		header   map[string]string
+		body     string
+		expected string
+	}{
+		{
+			name:     "headers sorted after cseq",
+			code:     StatusOK,
+			header:   map[string]string{"Session": "12345678", "Public": "OPTIONS, DESCRIBE"},
+			expected: "RTSP/1.0 200 OK\r\nCSeq: 3\r\nPublic: OPTIONS, DESCRIBE\r\nSession: 12345678\r\n\r\n",
+		},
+		{
+			name:     "body with content length",
+			code:     StatusOK,
+			header:   map[string]string{"Content-Type": "application/sdp"},
+			body:     "v=0\r\n",
+			expected: "RTSP/1.0 200 OK\r\nCSeq: 3\r\nContent-Type: application/sdp\r\nContent-Length: 5\r\n\r\nv=0\r\n",
+		},
+		{
+			name:     "unknown status",
+			code:     299,
+			expected: "RTSP/1.0 299 Unknown\r\nCSeq: 3\r\n\r\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := NewResponse(req, test.code)
+			for key, value := range test.header {
+				res.Header[key] = value
+			}
+			res.Body = []byte(test.body)
+			buf := new(bytes.Buffer)
+			if _, err := res.WriteTo(buf); err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if buf.String() != test.expected {
+				t.Fatalf("written %q, expected %q", buf.String(), test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package rtsp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gosm/pkg/config"
+	"gosm/pkg/hook"
+	"gosm/pkg/log"
+	"gosm/pkg/utils"
+)
+
+// errTeardown session teardown by client, stop serving
+var errTeardown = errors.New("RTSP: session teardown")
+
+// NetConnection rtsp control connection, one session per connection
+type NetConnection struct {
+	goConn   net.Conn
+	rw       *bufio.ReadWriter
+	wmu      sync.Mutex                 // response & interleaved data writing
+	session  string                     // session id, created by first SETUP
+	state    int                        // session state
+	stream   *NetStream                 // announced or described net-stream
+	channels map[uint8]*interleavedConn // interleaved channel <=> rtp/rtcp conn
+	server   *Server                    // rtsp server, for publishing callback
+}
+
+// NewNetConn rtsp control connection
+func NewNetConn(server *Server, goConn net.Conn) *NetConnection {
+	return &NetConnection{
+		goConn:   goConn,
+		rw:       bufio.NewReadWriter(bufio.NewReader(goConn), bufio.NewWriter(goConn)),
+		session:  "",
+		state:    StateInit,
+		stream:   nil,
+		channels: make(map[uint8]*interleavedConn),
+		server:   server,
+	}
+}
+
+// Close close rtsp connection
+func (nc *NetConnection) Close() error {
+	return nc.goConn.Close()
+}
+
+// Serve .
+func (nc *NetConnection) Serve() error {
+	// do loop to read rtsp request or interleaved data
+	go func() {
+		defer func() {
+			nc.teardown()
+			nc.Close()
+			log.Debug("RTSP: client remote: %v, reading exit", nc.goConn.RemoteAddr())
+		}()
+
+		for {
+			// interleaved rtp/rtcp
+			if magic, err := nc.rw.Peek(1); err == nil && magic[0] == InterleavedMagic {
+				if err := nc.readInterleaved(); err != nil {
+					if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+						log.Error("RTSP: net connection read interleaved error, %v", err)
+					}
+					return
+				}
+				continue
+			}
+
+			req, err := ReadRequest(nc.rw.Reader)
+			if err != nil {
+				if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+					log.Error("RTSP: net connection read error, %v", err)
+				}
+				return
+			}
+
+			if err := nc.process(req); err != nil {
+				if err != errTeardown {
+					log.Error("RTSP: process request error, %v", err)
+				}
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (nc *NetConnection) process(req *Request) error {
+	log.Debug("%0s request: %s %s, CSeq: %s\n", "C -> S", req.Method, req.URL, req.CSeq())
+
+	// session must match once established
+	if nc.session != "" && req.Session() != "" && req.Session() != nc.session {
+		return nc.WriteError(req, StatusSessionNotFound)
+	}
+
+	switch req.Method {
+	case MethodOptions:
+		return nc.onOptions(req)
+	case MethodDescribe:
+		return nc.onDescribe(req)
+	case MethodAnnounce:
+		return nc.onAnnounce(req)
+	case MethodSetup:
+		return nc.onSetup(req)
+	case MethodPlay:
+		return nc.onPlay(req)
+	case MethodRecord:
+		return nc.onRecord(req)
+	case MethodTeardown:
+		return nc.onTeardown(req)
+	case MethodGetParameter, MethodSetParameter: // keepalive
+		return nc.WriteResponse(nc.newResponse(req, StatusOK))
+	default:
+		return nc.WriteError(req, StatusMethodNotAllowed)
+	}
+}
+
+// OnOptions .
+func (nc *NetConnection) onOptions(req *Request) error {
+	res := nc.newResponse(req, StatusOK)
+	res.Header["Public"] = strings.Join([]string{
+		MethodOptions, MethodDescribe, MethodAnnounce, MethodSetup, MethodPlay,
+		MethodRecord, MethodTeardown, MethodGetParameter, MethodSetParameter,
+	}, ", ")
+	return nc.WriteResponse(res)
+}
+
+// OnDescribe create subscriber net-stream, generate sdp from room's sequence headers
+func (nc *NetConnection) onDescribe(req *Request) error {
+	if nc.stream != nil {
+		return nc.WriteError(req, StatusMethodNotValidInThisState)
+	}
+	app, stream, _, err := parseURL(req.URL)
+	if err != nil {
+		return nc.WriteError(req, StatusBadRequest)
+	}
+
+	ns := NewNetStream(nc, config.Global.Vhost(req.URL.Host), app, stream, ModePlay)
+	video, audio, err := nc.server.obs.OnRTSPDescribe(ns)
+	if errors.Is(err, hook.ErrRejected) {
+		log.Debug("RTSP: describe app '%s', stream '%s' rejected, %v", app, stream, err)
+		return nc.WriteError(req, StatusForbidden)
+	}
+	if err != nil || (video == nil && audio == nil) {
+		log.Debug("RTSP: describe app '%s', stream '%s' not found, %v", app, stream, err)
+		return nc.WriteError(req, StatusNotFound)
+	}
+	if err := ns.describe(video, audio); err != nil {
+		if errors.Is(err, errUnsupportedCodec) {
+			log.Debug("RTSP: describe app '%s', stream '%s' unsupported, %v", app, stream, err)
+			return nc.WriteError(req, StatusUnsupportedMediaType)
+		}
+		log.Error("RTSP: describe app '%s', stream '%s' error, %v", app, stream, err)
+		return nc.WriteError(req, StatusInternalServerError)
+	}
+	nc.stream = ns
+
+	res := nc.newResponse(req, StatusOK)
+	res.Header["Content-Base"] = strings.TrimSuffix(req.URL.String(), "/") + "/"
+	res.Header["Content-Type"] = "application/sdp"
+	res.Body = ns.sdp.Bytes()
+	return nc.WriteResponse(res)
+}
+
+// OnAnnounce create publisher net-stream with client's sdp
+func (nc *NetConnection) onAnnounce(req *Request) error {
+	if nc.stream != nil {
+		return nc.WriteError(req, StatusMethodNotValidInThisState)
+	}
+	if req.Header.Get("Content-Type") != "application/sdp" {
+		return nc.WriteError(req, StatusBadRequest)
+	}
+	app, stream, _, err := parseURL(req.URL)
+	if err != nil {
+		return nc.WriteError(req, StatusBadRequest)
+	}
+	sdp, err := ParseSDP(req.Body)
+	if err != nil {
+		log.Error("%v", err)
+		return nc.WriteError(req, StatusBadRequest)
+	}
+
+	ns := NewNetStream(nc, config.Global.Vhost(req.URL.Host), app, stream, ModeRecord)
+	ns.sdp = sdp
+	nc.stream = ns
+	return nc.WriteResponse(nc.newResponse(req, StatusOK))
+}
+
+// OnSetup negotiate transport of one media
+func (nc *NetConnection) onSetup(req *Request) error {
+	ns := nc.stream
+	if ns == nil || (nc.state != StateInit && nc.state != StateReady) {
+		return nc.WriteError(req, StatusMethodNotValidInThisState)
+	}
+
+	_, _, control, err := parseURL(req.URL)
+	if err != nil {
+		return nc.WriteError(req, StatusBadRequest)
+	}
+	media := ns.media(control)
+	if media == nil {
+		return nc.WriteError(req, StatusNotFound)
+	}
+	transport, err := ParseTransport(req.Header.Get("Transport"))
+	if err != nil {
+		log.Debug("%v", err)
+		return nc.WriteError(req, StatusUnsupportedTransport)
+	}
+	transport.Mode = ns.info.Mode
+	if transport.Mode == ModePlay && !transport.IsInterleaved() && transport.ClientPort[0] == 0 {
+		return nc.WriteError(req, StatusUnsupportedTransport)
+	}
+
+	if err := ns.setup(media, transport); err != nil {
+		if err == errUnsupportedTransport {
+			return nc.WriteError(req, StatusUnsupportedTransport)
+		}
+		log.Error("RTSP: setup app '%s', stream '%s' error, %v", ns.info.App, ns.info.Stream, err)
+		return nc.WriteError(req, StatusInternalServerError)
+	}
+
+	// session established
+	if nc.session == "" {
+		nc.session = strconv.FormatInt(utils.Snowflake.NextID(), 10)
+	}
+	nc.state = StateReady
+
+	res := nc.newResponse(req, StatusOK)
+	res.Header["Transport"] = transport.String()
+	return nc.WriteResponse(res)
+}
+
+// OnPlay export subscriber
+func (nc *NetConnection) onPlay(req *Request) error {
+	ns := nc.stream
+	if ns == nil || ns.info.Mode != ModePlay || nc.state != StateReady {
+		return nc.WriteError(req, StatusMethodNotValidInThisState)
+	}
+
+	res := nc.newResponse(req, StatusOK)
+	res.Header["Range"] = "npt=0.000-"
+	res.Header["RTP-Info"] = ns.rtpInfo(strings.TrimSuffix(req.URL.String(), "/") + "/")
+	if err := nc.WriteResponse(res); err != nil {
+		return err
+	}
+
+	nc.state = StatePlaying
+	ns.play()
+	return nc.server.obs.OnRTSPSubscribe(ns)
+}
+
+// OnRecord export publisher
+func (nc *NetConnection) onRecord(req *Request) error {
+	ns := nc.stream
+	if ns == nil || ns.info.Mode != ModeRecord || nc.state != StateReady {
+		return nc.WriteError(req, StatusMethodNotValidInThisState)
+	}
+
+	// publisher exported before response, so that it could be rejected
+	ns.record()
+	if err := nc.server.obs.OnRTSPPublish(ns); err != nil {
+		if errors.Is(err, hook.ErrRejected) {
+			nc.WriteError(req, StatusForbidden)
+		} else {
+			nc.WriteError(req, StatusInternalServerError)
+		}
+		return err
+	}
+	nc.state = StateRecording
+	return nc.WriteResponse(nc.newResponse(req, StatusOK))
+}
+
+// OnTeardown .
+func (nc *NetConnection) onTeardown(req *Request) error {
+	if err := nc.WriteResponse(nc.newResponse(req, StatusOK)); err != nil {
+		return err
+	}
+	log.Debug("RTSP: session '%s' teardown", nc.session)
+	return errTeardown
+}
+
+// notify observer the stream stopped
+func (nc *NetConnection) teardown() {
+	ns := nc.stream
+	if ns == nil {
+		return
+	}
+
+	var err error
+	switch nc.state {
+	case StatePlaying:
+		err = nc.server.obs.OnRTSPUnSubscribe(ns)
+	case StateRecording:
+		err = nc.server.obs.OnRTSPUnPublish(ns)
+	}
+	if err != nil {
+		log.Error("%v", err)
+	}
+	nc.state = StateInit
+	ns.Close()
+}
+
+// response with common headers
+func (nc *NetConnection) newResponse(req *Request, code int) *Response {
+	res := NewResponse(req, code)
+	res.Header["Server"] = config.RTSP
+	if nc.session != "" {
+		res.Header["Session"] = nc.session + ";timeout=60"
+	}
+	return res
+}
+
+// WriteError response error status
+func (nc *NetConnection) WriteError(req *Request, code int) error {
+	return nc.WriteResponse(nc.newResponse(req, code))
+}
+
+// WriteResponse .
+func (nc *NetConnection) WriteResponse(res *Response) error {
+	log.Debug("%0s response: %d, CSeq: %s\n", "S -> C", res.StatusCode, res.Header["CSeq"])
+
+	nc.wmu.Lock()
+	defer nc.wmu.Unlock()
+	if _, err := res.WriteTo(nc.rw.Writer); err != nil {
+		return err
+	}
+	return nc.rw.Flush()
+}
+
+// parseURL parse rtsp://host[:port]/app/stream[/control]
+func parseURL(u *url.URL) (app string, stream string, control string, err error) {
+	paths := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if last := paths[len(paths)-1]; strings.Contains(last, "=") {
+		control = last
+		paths = paths[:len(paths)-1]
+	}
+	if len(paths) < 2 || paths[0] == "" {
+		return "", "", "", fmt.Errorf("RTSP: parse app & stream error, %s", u)
+	}
+	return paths[0], strings.Join(paths[1:], "/"), control, nil
+}
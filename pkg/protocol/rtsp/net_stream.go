@@ -0,0 +1,432 @@
+package rtsp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"gosm/pkg/avformat"
+	"gosm/pkg/avformat/avc"
+	"gosm/pkg/log"
+	"gosm/pkg/protocol/rtsp/rtcp"
+	"gosm/pkg/protocol/rtsp/rtp"
+	"gosm/pkg/protocol/rtsp/udp"
+)
+
+// errUnsupportedTransport lower transport mixed within one session
+var errUnsupportedTransport = errors.New("RTSP: mixed udp and interleaved transport")
+
+// errUnsupportedCodec codec of room not packetized for playback
+var errUnsupportedCodec = errors.New("RTSP: unsupported codec for playback")
+
+// SenderReportInterval interval to send rtcp sender report to udp subscriber
+const SenderReportInterval = 5 * time.Second
+
+// dynamic payload types of generated sdp
+const (
+	PayloadTypeVideo = uint8(96)
+	PayloadTypeAudio = uint8(97)
+)
+
+// StreamInfo .
+type StreamInfo struct {
+	Vhost      string // resolved by host of request url
+	App        string
+	Stream     string
+	Mode       string // play or record
+	RemoteAddr string
+}
+
+// track outbound rtp track of subscriber
+type track struct {
+	control    string
+	packetizer *rtp.Packetizer
+	conn       net.PacketConn // udp sender or interleaved channel
+	addr       net.Addr       // client rtp address, nil if interleaved
+	rtcpAddr   net.Addr       // client rtcp address, nil if interleaved
+
+	mu        sync.Mutex // sending stats, written by room while read by sender report
+	packets   uint32     // rtp packets sent
+	octets    uint32     // rtp payload octets sent
+	ts        uint32     // rtp timestamp of the last packet sent
+	clockRate uint32     // clock rate of the last packet sent
+	sentAt    time.Time  // wall clock of the last packet sent
+}
+
+// sent update sending stats
+func (t *track) sent(ts uint32, clockRate uint32, packets uint32, octets uint32, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.packets += packets
+	t.octets += octets
+	t.ts = ts
+	t.clockRate = clockRate
+	t.sentAt = now
+}
+
+// senderReport rtp timestamp extrapolated from the last packet sent, nil if nothing sent yet
+func (t *track) senderReport(now time.Time) *rtcp.SenderReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.packets == 0 {
+		return nil
+	}
+	elapsed := uint64(now.Sub(t.sentAt)) * uint64(t.clockRate) / uint64(time.Second)
+	return rtcp.NewSenderReport(t.packetizer.SSRC(), now, t.ts+uint32(elapsed), t.packets, t.octets)
+}
+
+// NetStream rtsp logical net-stream, publisher (ANNOUNCE/RECORD) or subscriber (DESCRIBE/PLAY)
+type NetStream struct {
+	nc         *NetConnection
+	info       *StreamInfo
+	sdp        *SessionDescription
+	transports map[string]*Transport // media control <=> transport
+	session    *udp.Session          // rtp/rtcp receiver for publishing
+	rtpIn      *interleavedConn      // interleaved rtp receiver for publishing
+	rtcpIn     *interleavedConn      // interleaved rtcp receiver for publishing
+	rtpConn    *net.UDPConn          // rtp sender for playing
+	rtcpConn   *net.UDPConn          // rtcp sender for playing
+	video      *track                // video track for playing
+	audio      *track                // audio track for playing
+	once       sync.Once
+	done       chan struct{} // closed by connection or teardown, while read & written by room
+}
+
+// NewNetStream .
+func NewNetStream(nc *NetConnection, vhost string, app string, stream string, mode string) *NetStream {
+	return &NetStream{
+		nc: nc,
+		info: &StreamInfo{
+			Vhost:      vhost,
+			App:        app,
+			Stream:     stream,
+			Mode:       mode,
+			RemoteAddr: nc.goConn.RemoteAddr().String(),
+		},
+		sdp:        nil,
+		transports: make(map[string]*Transport),
+		session:    nil,
+		rtpIn:      nil,
+		rtcpIn:     nil,
+		rtpConn:    nil,
+		rtcpConn:   nil,
+		video:      nil,
+		audio:      nil,
+		done:       make(chan struct{}),
+	}
+}
+
+// Info .
+func (ns *NetStream) Info() *StreamInfo {
+	return ns.info
+}
+
+// SDP .
+func (ns *NetStream) SDP() *SessionDescription {
+	return ns.sdp
+}
+
+// find media by control, aggregate control matches the only media
+func (ns *NetStream) media(control string) *MediaDescription {
+	if ns.sdp == nil {
+		return nil
+	}
+	for _, media := range ns.sdp.Medias {
+		if c := media.Control(); c == control || (control != "" && strings.HasSuffix(c, "/"+control)) {
+			return media
+		}
+	}
+	if control == "" && len(ns.sdp.Medias) == 1 {
+		return ns.sdp.Medias[0]
+	}
+	return nil
+}
+
+// generate sdp from video/audio sequence header
+func (ns *NetStream) describe(video, audio *avformat.AVPacket) error {
+	sdp := NewSDP(ns.info.Stream)
+	if video != nil {
+		if !video.IsAVCSeqHeader() {
+			return fmt.Errorf("%w, only H.264 video supported", errUnsupportedCodec)
+		}
+		parser := avc.NewAVCParser(nil)
+		if err := parser.ParseExtradata(video.Body[5:]); err != nil {
+			return err
+		}
+		sdp.AddVideo(PayloadTypeVideo, parser.Extradata())
+	}
+	if audio != nil {
+		if !audio.IsAACSeqHeader() {
+			return fmt.Errorf("%w, only AAC audio supported", errUnsupportedCodec)
+		}
+		if err := sdp.AddAudio(PayloadTypeAudio, audio.Body[2:]); err != nil {
+			return err
+		}
+	}
+	ns.sdp = sdp
+	return nil
+}
+
+// setup media transport
+func (ns *NetStream) setup(media *MediaDescription, transport *Transport) error {
+	for _, t := range ns.transports {
+		if t.IsInterleaved() != transport.IsInterleaved() {
+			return errUnsupportedTransport
+		}
+	}
+	if transport.IsInterleaved() {
+		// channels assigned by server if not specified
+		if transport.Interleaved[0] < 0 {
+			channel := 2 * len(ns.transports)
+			transport.Interleaved = [2]int{channel, channel + 1}
+		}
+		for _, channel := range transport.Interleaved {
+			if _, ok := ns.nc.channels[uint8(channel)]; ok {
+				return fmt.Errorf("RTSP: interleaved channel %d already in use", channel)
+			}
+		}
+	}
+
+	if ns.info.Mode == ModeRecord {
+		if err := ns.setupRecord(media, transport); err != nil {
+			return err
+		}
+	}
+	if ns.info.Mode == ModePlay {
+		if err := ns.setupPlay(media, transport); err != nil {
+			return err
+		}
+	}
+
+	ns.transports[media.Control()] = transport
+	return nil
+}
+
+// setup receiver of publishing media
+func (ns *NetStream) setupRecord(media *MediaDescription, transport *Transport) error {
+	// all medias of one publisher share the same rtp/rtcp receiver, separated by payload type
+	if ns.session == nil {
+		if transport.IsInterleaved() {
+			ns.rtpIn = newInterleavedConn(ns.nc, uint8(transport.Interleaved[0]))
+			ns.rtcpIn = newInterleavedConn(ns.nc, uint8(transport.Interleaved[1]))
+			ns.session = udp.NewSessionWithConn(ns.rtpIn, ns.rtcpIn)
+		} else {
+			session, err := ns.nc.server.newUDPSession()
+			if err != nil {
+				return err
+			}
+			ns.session = session
+		}
+	}
+
+	codec, _, _ := media.RTPMap()
+	switch {
+	case media.Type == "video" && codec == "H264":
+		sps, pps := media.ParameterSets()
+		ns.session.SetVideoTrack(media.Format, sps, pps)
+	case media.Type == "video" && codec == "H265":
+		vps, sps, pps := media.HEVCParameterSets()
+		ns.session.SetHEVCTrack(media.Format, vps, sps, pps)
+	case media.Type == "audio" && codec == "MPEG4-GENERIC":
+		ns.session.SetAudioTrack(media.Format, media.AudioSpecificConfig())
+	default:
+		log.Warn("RTSP: unsupported %s codec '%s', ignored", media.Type, codec)
+	}
+
+	if transport.IsInterleaved() {
+		ns.nc.channels[uint8(transport.Interleaved[0])] = ns.rtpIn
+		ns.nc.channels[uint8(transport.Interleaved[1])] = ns.rtcpIn
+	} else {
+		port := ns.session.LocalPort()
+		transport.ServerPort = [2]int{port, port + 1}
+		if transport.ClientPort[1] != 0 {
+			remote := ns.nc.goConn.RemoteAddr().(*net.TCPAddr)
+			ns.session.SetRTCPAddr(&net.UDPAddr{IP: remote.IP, Port: transport.ClientPort[1], Zone: remote.Zone})
+		}
+	}
+	return nil
+}
+
+// setup sender of playing media
+func (ns *NetStream) setupPlay(media *MediaDescription, transport *Transport) error {
+	t := &track{control: media.Control()}
+	if transport.IsInterleaved() {
+		conn := newInterleavedConn(ns.nc, uint8(transport.Interleaved[0]))
+		ns.nc.channels[uint8(transport.Interleaved[0])] = conn
+		t.conn = conn
+	} else {
+		// all tracks of one subscriber share the same rtp/rtcp sending port pair
+		if ns.rtpConn == nil {
+			rtpConn, rtcpConn, err := ns.nc.server.newUDPConnPair()
+			if err != nil {
+				return err
+			}
+			ns.rtpConn, ns.rtcpConn = rtpConn, rtcpConn
+		}
+		remote := ns.nc.goConn.RemoteAddr().(*net.TCPAddr)
+		t.conn = ns.rtpConn
+		t.addr = &net.UDPAddr{IP: remote.IP, Port: transport.ClientPort[0], Zone: remote.Zone}
+		t.rtcpAddr = &net.UDPAddr{IP: remote.IP, Port: transport.ClientPort[1], Zone: remote.Zone}
+
+		port := ns.rtpConn.LocalAddr().(*net.UDPAddr).Port
+		transport.ServerPort = [2]int{port, port + 1}
+	}
+
+	_, clockRate, _ := media.RTPMap()
+	t.packetizer = rtp.NewPacketizer(media.Format, uint32(clockRate))
+	switch media.Type {
+	case "video":
+		ns.video = t
+	case "audio":
+		ns.audio = t
+	}
+	return nil
+}
+
+// rtpInfo 'RTP-Info' header of PLAY response, see rfc2326 section 12.33
+func (ns *NetStream) rtpInfo(base string) string {
+	infos := make([]string, 0, 2)
+	for _, t := range []*track{ns.video, ns.audio} {
+		if t != nil {
+			infos = append(infos, fmt.Sprintf("url=%s%s;seq=%d", base, t.control, t.packetizer.Sequence()))
+		}
+	}
+	return strings.Join(infos, ",")
+}
+
+// start sending sender reports to udp subscriber
+func (ns *NetStream) play() {
+	if ns.rtcpConn != nil {
+		go ns.report()
+	}
+}
+
+// report send sender report of each track periodically, receiver reports of client read and logged,
+// see rfc3550 section 6.4.1
+func (ns *NetStream) report() {
+	conn := rtcp.NewConn(ns.rtcpConn)
+	go conn.Serve()
+
+	ticker := time.NewTicker(SenderReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ns.done:
+			return
+		case packet := <-conn.Queue():
+			if packet.PT == rtcp.RR {
+				log.Debug("RTSP: stream '%s' receiver report of ssrc %d, %d blocks", ns.info.Stream, packet.SSRC, packet.RC)
+			}
+		case now := <-ticker.C:
+			for _, t := range []*track{ns.video, ns.audio} {
+				if t == nil || t.rtcpAddr == nil {
+					continue
+				}
+				sr := t.senderReport(now)
+				if sr == nil {
+					continue
+				}
+				sdes := &rtcp.SourceDescription{SSRC: sr.SSRC, CNAME: fmt.Sprintf("gosm-%08x", sr.SSRC)}
+				if err := conn.WritePackets(t.rtcpAddr, sr, sdes); err != nil {
+					log.Debug("RTSP: stream '%s' send sender report error, %v", ns.info.Stream, err)
+				}
+			}
+		}
+	}
+}
+
+// start receiving rtp/rtcp packets
+func (ns *NetStream) record() {
+	if ns.session != nil {
+		go ns.session.Serve()
+	}
+}
+
+/************************************/
+/********* Publish Interface ********/
+/************************************/
+
+// ReadAVPacket .
+func (ns *NetStream) ReadAVPacket() (*avformat.AVPacket, error) {
+	if ns.isClosed() || ns.session == nil {
+		return nil, fmt.Errorf("RTSP: stream '%s' is closed", ns.info.Stream)
+	}
+	return ns.session.ReadAVPacket()
+}
+
+/************************************/
+/******** Subscribe Interface *******/
+/************************************/
+
+// WriteAVPacket packetize av packet to rtp and send to client
+func (ns *NetStream) WriteAVPacket(packet *avformat.AVPacket) error {
+	if ns.isClosed() {
+		return fmt.Errorf("RTSP: stream '%s' is closed", ns.info.Stream)
+	}
+
+	var t *track
+	var packets []*rtp.Packet
+	var err error
+	switch {
+	case packet.IsVideo() && packet.IsAVC():
+		if t = ns.video; t != nil {
+			packets, err = t.packetizer.PacketizeAVC(packet)
+		}
+	case packet.IsAudio() && packet.IsAAC():
+		if t = ns.audio; t != nil {
+			packets, err = t.packetizer.PacketizeAAC(packet)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(packets) == 0 {
+		return nil
+	}
+	octets := 0
+	for _, rtpPacket := range packets {
+		p := rtpPacket.Bytes()
+		if _, err := t.conn.WriteTo(p, t.addr); err != nil {
+			return err
+		}
+		octets += len(p) - rtp.RTPHeaderLength
+	}
+	t.sent(packets[len(packets)-1].Timestamp(), t.packetizer.ClockRate(), uint32(len(packets)), uint32(octets), time.Now())
+	return nil
+}
+
+// Close .
+func (ns *NetStream) Close() error {
+	var err error
+	ns.once.Do(func() {
+		close(ns.done)
+		if ns.session != nil {
+			ns.session.Close()
+		}
+		if ns.rtpConn != nil {
+			ns.rtpConn.Close()
+			ns.rtcpConn.Close()
+		}
+		for _, t := range []*track{ns.video, ns.audio} {
+			if t != nil && t.addr == nil {
+				t.conn.Close() // interleaved channel
+			}
+		}
+		err = ns.nc.Close()
+	})
+	return err
+}
+
+// isClosed .
+func (ns *NetStream) isClosed() bool {
+	select {
+	case <-ns.done:
+		return true
+	default:
+		return false
+	}
+}
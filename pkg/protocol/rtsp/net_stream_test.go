@@ -0,0 +1,102 @@
+package rtsp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"gosm/pkg/avformat"
+	"gosm/pkg/avformat/avc"
+	"gosm/pkg/avformat/flv"
+	"gosm/pkg/protocol/rtsp/rtcp"
+	"gosm/pkg/protocol/rtsp/rtp"
+)
+
+func TestDescribe(t *testing.T) {
+	cfg := &avc.AVCDecoderConfigurationRecord{ConfigurationVersion: 1, AvcProfileIndication: 0x64,
+		AvcLevelIndication: 0x1F, Sps: []byte{0x67, 0x64, 0x00, 0x1F}, Pps: []byte{0x68, 0xEE, 0x3C, 0x80}}
+	avcSeqHeader := &avformat.AVPacket{TypeID: avformat.TypeVideo,
+		Body: append([]byte{flv.AVCKeyFrame<<4 | flv.CodevIDAVC, flv.AVCSeqHeader, 0x00, 0x00, 0x00}, cfg.Bytes()...)}
+	hevcSeqHeader := &avformat.AVPacket{TypeID: avformat.TypeVideo,
+		Body: []byte{flv.AVCKeyFrame<<4 | flv.CodevIDHEVC, flv.AVCSeqHeader, 0x00, 0x00, 0x00, 0x01}}
+	aacSeqHeader := &avformat.AVPacket{TypeID: avformat.TypeAudio, Body: []byte{0xAF, flv.AACSeqHeader, 0x12, 0x10}}
+	mp3 := &avformat.AVPacket{TypeID: avformat.TypeAudio, Body: []byte{0x2F, 0xFF, 0xFB}}
+
+	tests := []struct {
+		name        string
+		video       *avformat.AVPacket
+		audio       *avformat.AVPacket
+		medias      int
+		unsupported bool
+	}{
+		{name: "h264 & aac", video: avcSeqHeader, audio: aacSeqHeader, medias: 2},
+		{name: "aac only", audio: aacSeqHeader, medias: 1},
+		{name: "h265", video: hevcSeqHeader, audio: aacSeqHeader, unsupported: true},
+		{name: "mp3", video: avcSeqHeader, audio: mp3, unsupported: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ns := &NetStream{info: &StreamInfo{App: "live", Stream: "stream", Mode: ModePlay}}
+			err := ns.describe(test.video, test.audio)
+			if test.unsupported {
+				if !errors.Is(err, errUnsupportedCodec) || ns.sdp != nil {
+					t.Fatalf("error %v, expected %v", err, errUnsupportedCodec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if len(ns.sdp.Medias) != test.medias {
+				t.Fatalf("%d medias, expected %d", len(ns.sdp.Medias), test.medias)
+			}
+		})
+	}
+}
+
+func TestSenderReport(t *testing.T) {
+	tests := []struct {
+		name      string
+		clockRate uint32
+		last      uint32 // rtp timestamp of the last packet sent
+		elapsed   time.Duration
+		ts        uint32
+	}{
+		{name: "video", clockRate: 90000, last: 1000, elapsed: 2 * time.Second, ts: 1000 + 180000},
+		{name: "audio", clockRate: 44100, last: 1000, elapsed: 500 * time.Millisecond, ts: 1000 + 22050},
+		{name: "wrap", clockRate: 90000, last: 0xFFFFFFF6, elapsed: time.Second, ts: 90000 - 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tr := &track{packetizer: rtp.NewPacketizer(PayloadTypeVideo, test.clockRate)}
+			sentAt := time.Unix(1600000000, 250000000)
+			if sr := tr.senderReport(sentAt); sr != nil {
+				t.Fatalf("sender report %+v, expected nil before sending", sr)
+			}
+			tr.sent(test.last-10, test.clockRate, 3, 3000, sentAt.Add(-time.Second))
+			tr.sent(test.last, test.clockRate, 2, 200, sentAt)
+
+			now := sentAt.Add(test.elapsed)
+			buf := new(bytes.Buffer)
+			if _, err := tr.senderReport(now).WriteTo(buf); err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			packet, err := rtcp.ParsePacket(buf.Bytes())
+			if err != nil || packet.PT != rtcp.SR || packet.Size() != buf.Len() {
+				t.Fatalf("packet %+v of %d bytes, error %v", packet, buf.Len(), err)
+			}
+			sr, err := packet.ParseSR()
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if sr.SSRC != tr.packetizer.SSRC() || sr.TS != test.ts || sr.PacketCount != 5 || sr.OctetCount != 3200 {
+				t.Fatalf("ssrc %d, ts %d, packets %d, octets %d, expected %d, %d, 5, 3200",
+					sr.SSRC, sr.TS, sr.PacketCount, sr.OctetCount, tr.packetizer.SSRC(), test.ts)
+			}
+			if ntp := int64(sr.NTP()); ntp > now.UnixNano() || ntp < now.UnixNano()-1 {
+				t.Fatalf("ntp %d, expected %d", ntp, now.UnixNano())
+			}
+		})
+	}
+}
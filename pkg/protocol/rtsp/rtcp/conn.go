@@ -1,12 +1,18 @@
 package rtcp
 
 import (
+	"bytes"
+	"errors"
 	"gosm/pkg/log"
+	"io"
 	"net"
 )
 
 const MTU = 1508
 
+// MaxPacketSize max packet size of rtcp over udp or rtsp interleaved
+const MaxPacketSize = 0xFFFF
+
 type Connection struct {
 	goConn net.PacketConn
 	queue  chan *Packet
@@ -36,18 +42,43 @@ func (conn *Connection) Serve() {
 		log.Debug("RTCP: connection local: %v, exit", conn.goConn.LocalAddr())
 	}()
 
+	// interleaved packet may be large than MTU
+	buf := make([]byte, MaxPacketSize)
 	for {
-		payload := make([]byte, MTU)
-		n, _, err := conn.goConn.ReadFrom(payload)
+		n, _, err := conn.goConn.ReadFrom(buf)
 		if err != nil {
+			// connection closed actived
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			log.Error("RTCP: read error, %v", err)
 			continue
 		}
 
-		packet, err := ParsePacket(payload[:n])
+		payload := make([]byte, n)
+		copy(payload, buf[:n])
+		packets, err := ParseCompound(payload)
 		if err != nil {
 			log.Error("RTCP: parse error, %v", err)
 		}
-		conn.queue <- packet
+		for _, packet := range packets {
+			select {
+			case conn.queue <- packet:
+			default:
+				log.Debug("RTCP: packet queue is full, type %d dropped", packet.PT)
+			}
+		}
+	}
+}
+
+// WritePackets write packets as one compound packet
+func (conn *Connection) WritePackets(addr net.Addr, packets ...io.WriterTo) error {
+	buf := new(bytes.Buffer)
+	for _, packet := range packets {
+		if _, err := packet.WriteTo(buf); err != nil {
+			return err
+		}
 	}
+	_, err := conn.goConn.WriteTo(buf.Bytes(), addr)
+	return err
 }
@@ -0,0 +1,126 @@
+package rtcp
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// feedback message types, see rfc4585 section 6.1 & rfc5104 section 4.3
+const (
+	FMTNACK = uint8(1) // RTPFB generic NACK
+	FMTPLI  = uint8(1) // PSFB picture loss indication
+	FMTFIR  = uint8(4) // PSFB full intra request
+)
+
+// SDES CNAME item
+const SDESCNAME = uint8(1)
+
+// SourceDescription SDES with one chunk of CNAME
+//
+// 0                   1                   2                   3
+// 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |V=2|P|    SC   |  PT=SDES=202  |             length            |
+// +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+// |                          SSRC/CSRC_1                          |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |    CNAME=1    |     length    | user and domain name        ...
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type SourceDescription struct {
+	SSRC  uint32
+	CNAME string
+}
+
+func (sdes *SourceDescription) WriteTo(w io.Writer) (int64, error) {
+	// chunk: ssrc + items + null terminated, padded to 32 bits
+	chunk := []byte{SDESCNAME, byte(len(sdes.CNAME))}
+	chunk = append(chunk, sdes.CNAME...)
+	chunk = append(chunk, 0x00)
+	for len(chunk)%4 != 0 {
+		chunk = append(chunk, 0x00)
+	}
+	header := &Header{V: 2, RC: 1, PT: SDES, Length: uint16(1 + len(chunk)/4), SSRC: sdes.SSRC}
+	n, err := w.Write(append(header.Bytes(), chunk...))
+	return int64(n), err
+}
+
+// NACK generic negative acknowledgement, see rfc4585 section 6.2.1
+//
+// 0                   1                   2                   3
+// 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |V=2|P|  FMT=1  |   PT=RTPFB    |             length            |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |                  SSRC of packet sender                        |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |                  SSRC of media source                         |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |            PID                |             BLP               |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type NACK struct {
+	SenderSSRC uint32
+	MediaSSRC  uint32
+	Lost       []uint16 // lost sequence numbers in ascending order
+}
+
+func (nack *NACK) WriteTo(w io.Writer) (int64, error) {
+	// PID + bitmask of following 16 lost packets
+	fci := make([]byte, 0, 4*len(nack.Lost))
+	for idx := 0; idx < len(nack.Lost); {
+		pid := nack.Lost[idx]
+		blp := uint16(0)
+		idx++
+		for ; idx < len(nack.Lost); idx++ {
+			diff := nack.Lost[idx] - pid
+			if diff == 0 || diff > 16 {
+				break
+			}
+			blp |= 1 << (diff - 1)
+		}
+		fci = append(fci, byte(pid>>8), byte(pid), byte(blp>>8), byte(blp))
+	}
+	return writeFeedback(w, RTPFB, FMTNACK, nack.SenderSSRC, nack.MediaSSRC, fci)
+}
+
+// PLI picture loss indication, see rfc4585 section 6.3.1
+type PLI struct {
+	SenderSSRC uint32
+	MediaSSRC  uint32
+}
+
+func (pli *PLI) WriteTo(w io.Writer) (int64, error) {
+	return writeFeedback(w, PSFB, FMTPLI, pli.SenderSSRC, pli.MediaSSRC, nil)
+}
+
+// FIR full intra request, see rfc5104 section 4.3.1
+//
+// 0                   1                   2                   3
+// 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |                              SSRC                             |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// | Seq nr.       |    Reserved                                   |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type FIR struct {
+	SenderSSRC uint32
+	MediaSSRC  uint32
+	SeqNr      uint8
+}
+
+func (fir *FIR) WriteTo(w io.Writer) (int64, error) {
+	fci := make([]byte, 8)
+	binary.BigEndian.PutUint32(fci, fir.MediaSSRC)
+	fci[4] = fir.SeqNr
+	// media source ssrc of common header is unused, set to 0
+	return writeFeedback(w, PSFB, FMTFIR, fir.SenderSSRC, 0, fci)
+}
+
+// feedback message: header + sender ssrc + media ssrc + fci
+func writeFeedback(w io.Writer, pt uint8, fmt uint8, sender uint32, media uint32, fci []byte) (int64, error) {
+	header := &Header{V: 2, RC: fmt, PT: pt, Length: uint16(2 + len(fci)/4), SSRC: sender}
+	p := header.Bytes()
+	p = append(p, byte(media>>24), byte(media>>16), byte(media>>8), byte(media))
+	p = append(p, fci...)
+	n, err := w.Write(p)
+	return int64(n), err
+}
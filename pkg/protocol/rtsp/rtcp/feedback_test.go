@@ -0,0 +1,99 @@
+package rtcp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// sender ssrc 1, media ssrc 2 of feedbacks
+var (
+	sender = []byte{0x00, 0x00, 0x00, 0x01}
+	media  = []byte{0x00, 0x00, 0x00, 0x02}
+)
+
+func concat(parts ...[]byte) []byte {
+	var p []byte
+	for _, part := range parts {
+		p = append(p, part...)
+	}
+	return p
+}
+
+func TestFeedback(t *testing.T) {
+	tests := []struct {
+		name     string
+		packet   io.WriterTo
+		expected []byte
+	}{
+		{
+			name:     "nack single",
+			packet:   &NACK{SenderSSRC: 1, MediaSSRC: 2, Lost: []uint16{100}},
+			expected: concat([]byte{0x81, RTPFB, 0x00, 0x03}, sender, media, []byte{0x00, 0x64, 0x00, 0x00}),
+		},
+		{
+			name:     "nack bitmask",
+			packet:   &NACK{SenderSSRC: 1, MediaSSRC: 2, Lost: []uint16{100, 101, 103, 116}},
+			expected: concat([]byte{0x81, RTPFB, 0x00, 0x03}, sender, media, []byte{0x00, 0x64, 0x80, 0x05}),
+		},
+		{
+			name:   "nack beyond bitmask",
+			packet: &NACK{SenderSSRC: 1, MediaSSRC: 2, Lost: []uint16{100, 117, 118}},
+			expected: concat([]byte{0x81, RTPFB, 0x00, 0x04}, sender, media,
+				[]byte{0x00, 0x64, 0x00, 0x00}, []byte{0x00, 0x75, 0x00, 0x01}),
+		},
+		{
+			name:     "nack across wrap",
+			packet:   &NACK{SenderSSRC: 1, MediaSSRC: 2, Lost: []uint16{65534, 65535, 0, 2}},
+			expected: concat([]byte{0x81, RTPFB, 0x00, 0x03}, sender, media, []byte{0xFF, 0xFE, 0x00, 0x0B}),
+		},
+		{
+			name:     "pli",
+			packet:   &PLI{SenderSSRC: 1, MediaSSRC: 2},
+			expected: concat([]byte{0x81, PSFB, 0x00, 0x02}, sender, media),
+		},
+		{
+			name:   "fir",
+			packet: &FIR{SenderSSRC: 1, MediaSSRC: 2, SeqNr: 7},
+			expected: concat([]byte{0x84, PSFB, 0x00, 0x04}, sender, []byte{0x00, 0x00, 0x00, 0x00},
+				media, []byte{0x07, 0x00, 0x00, 0x00}),
+		},
+		{
+			name:     "sdes empty cname",
+			packet:   &SourceDescription{SSRC: 1, CNAME: ""},
+			expected: concat([]byte{0x81, SDES, 0x00, 0x02}, sender, []byte{SDESCNAME, 0x00, 0x00, 0x00}),
+		},
+		{
+			name:     "sdes padded",
+			packet:   &SourceDescription{SSRC: 1, CNAME: "ab"},
+			expected: concat([]byte{0x81, SDES, 0x00, 0x03}, sender, []byte{SDESCNAME, 0x02, 'a', 'b', 0x00, 0x00, 0x00, 0x00}),
+		},
+		{
+			name:     "sdes aligned",
+			packet:   &SourceDescription{SSRC: 1, CNAME: "abcde"},
+			expected: concat([]byte{0x81, SDES, 0x00, 0x03}, sender, []byte{SDESCNAME, 0x05, 'a', 'b', 'c', 'd', 'e', 0x00}),
+		},
+		{
+			name:   "sdes padded to next word",
+			packet: &SourceDescription{SSRC: 1, CNAME: "abcdef"},
+			expected: concat([]byte{0x81, SDES, 0x00, 0x04}, sender,
+				[]byte{SDESCNAME, 0x06, 'a', 'b', 'c', 'd', 'e', 'f', 0x00, 0x00, 0x00, 0x00}),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			n, err := test.packet.WriteTo(buf)
+			if err != nil || int(n) != buf.Len() {
+				t.Fatalf("written %d of %d bytes, error %v", n, buf.Len(), err)
+			}
+			if !bytes.Equal(buf.Bytes(), test.expected) {
+				t.Fatalf("written %x, expected %x", buf.Bytes(), test.expected)
+			}
+			packet, err := ParsePacket(buf.Bytes())
+			if err != nil || packet.Size() != buf.Len() || packet.SSRC != 1 {
+				t.Fatalf("parsed %d bytes of ssrc %d, error %v, expected %d", packet.Size(), packet.SSRC, err, buf.Len())
+			}
+		})
+	}
+}
@@ -4,16 +4,19 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"time"
 )
 
 const (
-	SR   = uint8(200)
-	RR   = uint8(201)
-	SDES = uint8(202)
-	BYE  = uint8(203)
-	APP  = uint8(204)
+	SR    = uint8(200)
+	RR    = uint8(201)
+	SDES  = uint8(202)
+	BYE   = uint8(203)
+	APP   = uint8(204)
+	RTPFB = uint8(205) // transport layer feedback, rfc4585
+	PSFB  = uint8(206) // payload-specific feedback, rfc4585
 )
-const ReportBlockSize = 32 * 6
+const ReportBlockSize = 4 * 6 // bytes
 const FixedNTP = (70*365 + 17) * 24 * 60 * 60
 
 type Packet struct {
@@ -30,12 +33,35 @@ func ParsePacket(p []byte) (*Packet, error) {
 	if err != nil {
 		return nil, err
 	}
+	size := packet.Size()
+	if size > len(p) {
+		return nil, fmt.Errorf("RTCP: packet length %d out of range: %d", size, len(p))
+	}
 	if packet.Header.Length >= 1 {
-		packet.Payload = p[n:]
+		packet.Payload = p[n:size]
 	}
 	return packet, nil
 }
 
+// ParseCompound parse all packets of a compound rtcp packet
+func ParseCompound(p []byte) ([]*Packet, error) {
+	packets := make([]*Packet, 0, 2)
+	for len(p) > 0 {
+		packet, err := ParsePacket(p)
+		if err != nil {
+			return packets, err
+		}
+		packets = append(packets, packet)
+		p = p[packet.Size():]
+	}
+	return packets, nil
+}
+
+// Size packet size in bytes, including header
+func (packet *Packet) Size() int {
+	return (int(packet.Header.Length) + 1) * 4
+}
+
 // RTCP header
 //
 // 0                   1                   2                   3
@@ -62,9 +88,22 @@ func (header *Header) Parse(p []byte) (n int, err error) {
 	header.RC = p[0] & 0x1F
 	header.PT = p[1]
 	header.Length = binary.BigEndian.Uint16(p[2:])
+	if len(p) >= 8 {
+		header.SSRC = binary.BigEndian.Uint32(p[4:])
+	}
 	return 4, nil
 }
 
+// Bytes marshal header with ssrc
+func (header *Header) Bytes() []byte {
+	p := make([]byte, 8)
+	p[0] = header.V<<6 | header.P<<5 | header.RC&0x1F
+	p[1] = header.PT
+	binary.BigEndian.PutUint16(p[2:], header.Length)
+	binary.BigEndian.PutUint32(p[4:], header.SSRC)
+	return p
+}
+
 // SR sender report
 //
 // 0                   1                   2                   3
@@ -124,8 +163,11 @@ type ReportBlock struct {
 }
 
 // parse sender report
-func (packet *Packet) ParseSR() *SenderReport {
+func (packet *Packet) ParseSR() (*SenderReport, error) {
 	p := packet.Payload
+	if len(p) < 24 {
+		return nil, fmt.Errorf("RTCP: not enough bytes to parse SR, length: %d", len(p))
+	}
 
 	sr := &SenderReport{
 		Header: packet.Header,
@@ -151,10 +193,10 @@ func (packet *Packet) ParseSR() *SenderReport {
 			block.LSR = binary.BigEndian.Uint32(p[pos+16:])
 			block.DLSR = binary.BigEndian.Uint32(p[pos+20:])
 			sr.Blocks = append(sr.Blocks, block)
-			pos += 24
+			pos += ReportBlockSize
 		}
 	}
-	return sr
+	return sr, nil
 }
 
 // msw and lsw as ntp timestamp, return in nano
@@ -162,6 +204,40 @@ func (sr *SenderReport) NTP() uint64 {
 	return uint64(sr.MSW-FixedNTP)*1e9 + uint64(sr.LSW)*1e9>>32
 }
 
+// MiddleNTP middle 32 bits of ntp timestamp, as LSR of report block
+func (sr *SenderReport) MiddleNTP() uint32 {
+	return sr.MSW<<16 | sr.LSW>>16
+}
+
+// NewSenderReport sender report without report blocks, ntp timestamp of wall clock
+func NewSenderReport(ssrc uint32, now time.Time, ts uint32, packetCount uint32, octetCount uint32) *SenderReport {
+	return &SenderReport{
+		Header:      &Header{V: 2, PT: SR, Length: 6, SSRC: ssrc},
+		MSW:         uint32(now.Unix() + FixedNTP),
+		LSW:         uint32(uint64(now.Nanosecond()) << 32 / 1e9),
+		TS:          ts,
+		PacketCount: packetCount,
+		OctetCount:  octetCount,
+		Blocks:      make([]*ReportBlock, 0),
+	}
+}
+
+func (sr *SenderReport) WriteTo(w io.Writer) (int64, error) {
+	sr.Header.RC = uint8(len(sr.Blocks))
+	sr.Header.Length = uint16(6 + 6*len(sr.Blocks))
+	p := append(sr.Header.Bytes(), make([]byte, 20)...)
+	binary.BigEndian.PutUint32(p[8:], sr.MSW)
+	binary.BigEndian.PutUint32(p[12:], sr.LSW)
+	binary.BigEndian.PutUint32(p[16:], sr.TS)
+	binary.BigEndian.PutUint32(p[20:], sr.PacketCount)
+	binary.BigEndian.PutUint32(p[24:], sr.OctetCount)
+	for _, block := range sr.Blocks {
+		p = append(p, block.Bytes()...)
+	}
+	n, err := w.Write(p)
+	return int64(n), err
+}
+
 // RR receiver report
 //
 // 0                   1                   2                   3
@@ -190,10 +266,35 @@ func (sr *SenderReport) NTP() uint64 {
 
 type ReceiverReport struct {
 	*Header
-	blocks []*ReportBlock
+	Blocks []*ReportBlock
+}
+
+// NewReceiverReport .
+func NewReceiverReport(ssrc uint32, blocks []*ReportBlock) *ReceiverReport {
+	return &ReceiverReport{
+		Header: &Header{V: 2, RC: uint8(len(blocks)), PT: RR, Length: uint16(1 + 6*len(blocks)), SSRC: ssrc},
+		Blocks: blocks,
+	}
 }
 
 func (rr *ReceiverReport) WriteTo(w io.Writer) (int64, error) {
-	n := 0
-	return int64(n), nil
+	p := rr.Header.Bytes()
+	for _, block := range rr.Blocks {
+		p = append(p, block.Bytes()...)
+	}
+	n, err := w.Write(p)
+	return int64(n), err
+}
+
+// Bytes marshal report block
+func (block *ReportBlock) Bytes() []byte {
+	p := make([]byte, ReportBlockSize)
+	binary.BigEndian.PutUint32(p[0:], block.SSRC)
+	binary.BigEndian.PutUint32(p[4:], block.Lost&0xFFFFFF)
+	p[4] = block.Fraction
+	binary.BigEndian.PutUint32(p[8:], block.SN)
+	binary.BigEndian.PutUint32(p[12:], block.Jitter)
+	binary.BigEndian.PutUint32(p[16:], block.LSR)
+	binary.BigEndian.PutUint32(p[20:], block.DLSR)
+	return p
 }
@@ -1,6 +1,7 @@
 package rtp
 
 import (
+	"errors"
 	"gosm/pkg/avformat"
 	"gosm/pkg/log"
 	"net"
@@ -8,10 +9,16 @@ import (
 
 const MTU = 1508
 
+// MaxPacketSize max packet size of rtp over udp or rtsp interleaved
+const MaxPacketSize = 0xFFFF
+
 // Connection .
 type Connection struct {
 	goConn     net.PacketConn
-	ssrc       uint32
+	videoSSRC  uint32 // video source
+	audioSSRC  uint32 // audio source
+	videoPT    uint8  // video payload type
+	audioPT    uint8  // audio payload type
 	videoQueue chan *Packet
 	audioQueue chan *Packet
 	avQueue    chan *avformat.AVPacket
@@ -21,7 +28,10 @@ type Connection struct {
 func NewConn(goConn net.PacketConn) *Connection {
 	conn := &Connection{
 		goConn:     goConn,
-		ssrc:       0,
+		videoSSRC:  0,
+		audioSSRC:  0,
+		videoPT:    PacketTypeAVC,
+		audioPT:    PacketTypeAAC,
 		videoQueue: make(chan *Packet, 512),
 		audioQueue: make(chan *Packet, 512),
 		avQueue:    make(chan *avformat.AVPacket, 1024),
@@ -34,6 +44,27 @@ func (conn *Connection) Close() error {
 	return conn.goConn.Close()
 }
 
+// SetPayloadType overrides default payload types, ex. negotiated by sdp
+func (conn *Connection) SetPayloadType(video, audio uint8) {
+	conn.videoPT = video
+	conn.audioPT = audio
+}
+
+// VideoPT .
+func (conn *Connection) VideoPT() uint8 {
+	return conn.videoPT
+}
+
+// AudioPT .
+func (conn *Connection) AudioPT() uint8 {
+	return conn.audioPT
+}
+
+// LocalAddr .
+func (conn *Connection) LocalAddr() net.Addr {
+	return conn.goConn.LocalAddr()
+}
+
 // return readonly rtp video packet queue
 func (conn *Connection) VideoQueue() <-chan *Packet {
 	return conn.videoQueue
@@ -51,36 +82,47 @@ func (conn *Connection) Serve() {
 		log.Debug("RTP: server local: %v, exit", conn.goConn.LocalAddr())
 	}()
 
+	// interleaved packet may be large than MTU
+	buf := make([]byte, MaxPacketSize)
 	for {
-		payload := make([]byte, MTU)
-		n, _, err := conn.goConn.ReadFrom(payload)
+		n, _, err := conn.goConn.ReadFrom(buf)
 		if err != nil {
-			log.Error("RTP: read error, %v", err)
+			// connection closed actived
+			if !errors.Is(err, net.ErrClosed) {
+				log.Error("RTP: read error, %v", err)
+			}
 			return
 		}
-		packet, err := ParsePacket(payload[:n])
+		payload := make([]byte, n)
+		copy(payload, buf[:n])
+		packet, err := ParsePacket(payload)
 		if err != nil {
 			log.Error("RTP: parse packet error, %v", err)
 			continue
 		}
 
-		// one connection supports only one stream type
-		if conn.ssrc == 0 {
-			conn.ssrc = packet.header.ssrc
-		}
-		if conn.ssrc != 0 && conn.ssrc != packet.header.ssrc {
-			log.Error("RTP: only one stream supported, expected ssrc: %d, but got %d", conn.ssrc, packet.header.ssrc)
-			return
-		}
-
-		// separate audio/video
+		// separate audio/video, one source per media, packets of other sources dropped
 		switch packet.header.pt {
-		case PacketTypeAVC:
+		case conn.videoPT:
+			if conn.videoSSRC == 0 {
+				conn.videoSSRC = packet.header.ssrc
+			}
+			if conn.videoSSRC != packet.header.ssrc {
+				log.Debug("RTP: video expected ssrc: %d, but got %d, dropped", conn.videoSSRC, packet.header.ssrc)
+				continue
+			}
 			if len(conn.videoQueue) > cap(conn.videoQueue)-24 {
 				log.Debug("RTP: net-stream rtp video packet buffer is nealy full")
 			}
 			conn.videoQueue <- packet
-		case PacketTypeAAC:
+		case conn.audioPT:
+			if conn.audioSSRC == 0 {
+				conn.audioSSRC = packet.header.ssrc
+			}
+			if conn.audioSSRC != packet.header.ssrc {
+				log.Debug("RTP: audio expected ssrc: %d, but got %d, dropped", conn.audioSSRC, packet.header.ssrc)
+				continue
+			}
 			if len(conn.audioQueue) > cap(conn.audioQueue)-24 {
 				log.Debug("RTP: net-stream rtp audio packet buffer is nealy full")
 			}
@@ -10,23 +10,52 @@ import (
 )
 
 type Depacketizer struct {
-	fragments []*Packet // FU-* or audio packet cache
-	sps       []byte
-	pps       []byte
-	sei       []byte
-	nalus     *bytes.Buffer
+	codec          string    // video codec, CodecH264 or CodecH265
+	fragments      []*Packet // FU-* packet cache
+	audioFragments []*Packet // audio packet cache
+	vps            []byte    // h.265 only
+	sps            []byte
+	pps            []byte
+	sei            []byte
+	nalus          *bytes.Buffer
+	videoSN        int  // last video sequence number, -1 if none
+	audioSN        int  // last audio sequence number, -1 if none
+	corrupted      bool // access unit incomplete, dropped until next marker
+	needKeyframe   bool // keyframe required since access unit dropped
 }
 
 func NewDepacketizer() *Depacketizer {
 	return &Depacketizer{
-		fragments: make([]*Packet, 0),
-		sps:       nil,
-		pps:       nil,
-		sei:       nil,
-		nalus:     bytes.NewBuffer([]byte{}),
+		codec:          CodecH264,
+		fragments:      make([]*Packet, 0),
+		audioFragments: make([]*Packet, 0),
+		vps:            nil,
+		sps:            nil,
+		pps:            nil,
+		sei:            nil,
+		nalus:          bytes.NewBuffer([]byte{}),
+		videoSN:        -1,
+		audioSN:        -1,
+		corrupted:      false,
+		needKeyframe:   true,
 	}
 }
 
+// SetVideoCodec sets video codec, H.264 by default
+func (depacketizer *Depacketizer) SetVideoCodec(codec string) {
+	depacketizer.codec = codec
+}
+
+// VideoCodec .
+func (depacketizer *Depacketizer) VideoCodec() string {
+	return depacketizer.codec
+}
+
+// VPS h.265 only
+func (depacketizer *Depacketizer) VPS() []byte {
+	return depacketizer.vps
+}
+
 func (depacketizer *Depacketizer) SPS() []byte {
 	return depacketizer.sps
 }
@@ -35,13 +64,71 @@ func (depacketizer *Depacketizer) PPS() []byte {
 	return depacketizer.pps
 }
 
+// SetParameterSets sets out-of-band sps & pps, ex. sdp sprop-parameter-sets
+func (depacketizer *Depacketizer) SetParameterSets(sps, pps []byte) {
+	depacketizer.sps = sps
+	depacketizer.pps = pps
+}
+
+// SetHEVCParameterSets sets out-of-band vps & sps & pps, ex. sdp sprop-vps, sprop-sps, sprop-pps
+func (depacketizer *Depacketizer) SetHEVCParameterSets(vps, sps, pps []byte) {
+	depacketizer.vps = vps
+	depacketizer.sps = sps
+	depacketizer.pps = pps
+}
+
 func (depacketizer *Depacketizer) Nalus() []byte {
 	nalus := make([]byte, depacketizer.nalus.Len())
 	io.ReadFull(depacketizer.nalus, nalus)
 	return nalus
 }
 
+// DepacketizeVideo depacketize video packets in sequence, returns true if a complete access unit ready,
+// access unit with packet lost or malformed is dropped entirely
 func (depacketizer *Depacketizer) DepacketizeVideo(packet *Packet) (bool, error) {
+	// gap of sequence number means packets lost, drop current access unit
+	sn := int(packet.header.sn)
+	if depacketizer.videoSN >= 0 && sn != (depacketizer.videoSN+1)&0xFFFF {
+		depacketizer.dropAccessUnit()
+	}
+	depacketizer.videoSN = sn
+
+	var marker bool
+	var err error
+	if depacketizer.codec == CodecH265 {
+		marker, err = depacketizer.depacketizeHEVC(packet)
+	} else {
+		marker, err = depacketizer.depacketizeVideo(packet)
+	}
+	if err != nil {
+		depacketizer.dropAccessUnit()
+	}
+	if marker && depacketizer.corrupted {
+		depacketizer.nalus.Reset()
+		depacketizer.corrupted = false
+		return false, err
+	}
+	return marker, err
+}
+
+// dropAccessUnit drop fragments & nalus of current access unit
+func (depacketizer *Depacketizer) dropAccessUnit() {
+	depacketizer.fragments = depacketizer.fragments[:0]
+	depacketizer.nalus.Reset()
+	depacketizer.corrupted = true
+	depacketizer.needKeyframe = true
+}
+
+// NeedKeyframe whether keyframe is required to recover decoding, ex. at beginning or after loss
+func (depacketizer *Depacketizer) NeedKeyframe() bool {
+	return depacketizer.needKeyframe
+}
+
+func (depacketizer *Depacketizer) depacketizeVideo(packet *Packet) (bool, error) {
+	if len(packet.payload) == 0 {
+		return packet.header.m == 0x01, fmt.Errorf("RTP Parser: empty video payload")
+	}
+
 	// ---------------------------------------------------------
 	//	H.264/AVC
 	// ---------------------------------------------------------
@@ -70,9 +157,17 @@ func (depacketizer *Depacketizer) DepacketizeVideo(packet *Packet) (bool, error)
 	case NALUMTAP24:
 		log.Debug("RTP: not support MTAP-24")
 	case NALUFUA:
+		if len(packet.payload) < 2 {
+			return marker, fmt.Errorf("RTP Parser: FU-A payload too short")
+		}
 		fuHeader := packet.payload[1]
 		if (fuHeader>>7)&0x01 == 0x01 { // FU-A start
 			depacketizer.fragments = depacketizer.fragments[:0]
+		} else if len(depacketizer.fragments) == 0 { // FU-A start lost
+			if depacketizer.corrupted {
+				return marker, nil
+			}
+			return marker, fmt.Errorf("RTP Parser: FU-A without start fragment")
 		}
 		depacketizer.fragments = append(depacketizer.fragments, packet) // FU-A continue
 		if (fuHeader>>6)&0x01 != 0x01 {                                 // FU-A end
@@ -84,6 +179,7 @@ func (depacketizer *Depacketizer) DepacketizeVideo(packet *Packet) (bool, error)
 		for _, fragment := range depacketizer.fragments {   // restore nalu-rbsp
 			nalu = append(nalu, fragment.payload[2:]...)
 		}
+		depacketizer.fragments = depacketizer.fragments[:0]
 		if err := depacketizer.parseNalu(nalu); err != nil {
 			return marker, err
 		}
@@ -92,21 +188,21 @@ func (depacketizer *Depacketizer) DepacketizeVideo(packet *Packet) (bool, error)
 		log.Debug("RTP: not support FU-B")
 	}
 
-	// ---------------------------------------------------------
-	// TODO: support H.265/HEVC
-	// ---------------------------------------------------------
 	return marker, nil
 }
 
 // parse sps / pps / sei from STAP-*
 func (depacketizer *Depacketizer) parseSTAP(nalus []byte) error {
 	for pos := 0; pos != len(nalus); {
-		if pos > len(nalus) {
+		if pos+2 > len(nalus) {
 			return fmt.Errorf("RTP Parser: parse STAP error, pos:%d, out of range:%d", pos, len(nalus))
 		}
 
 		lenOfNalu := int(binary.BigEndian.Uint16(nalus[pos:]))
 		pos = pos + 2
+		if lenOfNalu == 0 || pos+lenOfNalu > len(nalus) {
+			return fmt.Errorf("RTP Parser: parse STAP error, nalu size:%d, out of range:%d", lenOfNalu, len(nalus))
+		}
 
 		switch nalus[pos] & 0x1F {
 		case avc.NALUSEI:
@@ -115,9 +211,10 @@ func (depacketizer *Depacketizer) parseSTAP(nalus []byte) error {
 			depacketizer.sps = nalus[pos : pos+lenOfNalu]
 		case avc.NALUPPS:
 			depacketizer.pps = nalus[pos : pos+lenOfNalu]
-		case avc.NALUNonIDRPicture:
-			fallthrough
-		case avc.NALUIDRPicture: // avcC format: nalu-size + nalu
+		case avc.NALUNonIDRPicture, avc.NALUIDRPicture: // avcC format: nalu-size + nalu
+			if nalus[pos]&0x1F == avc.NALUIDRPicture {
+				depacketizer.needKeyframe = false
+			}
 			if err := binary.Write(depacketizer.nalus, binary.BigEndian, uint32(lenOfNalu)); err != nil {
 				return err
 			}
@@ -141,6 +238,8 @@ func (depacketizer *Depacketizer) parseNalu(nalu []byte) error {
 		depacketizer.sps = nalu
 	case avc.NALUPPS:
 		depacketizer.pps = nalu
+	case avc.NALUIDRPicture:
+		depacketizer.needKeyframe = false
 	}
 
 	// avcC format: nalu-size + nalu
@@ -177,25 +276,43 @@ type AudioFrame struct {
 }
 
 func (depacketizer *Depacketizer) DepacketizeAudio(packet *Packet) ([]*AudioFrame, error) {
+	// gap of sequence number means packets lost, drop fragmented access unit
+	sn := int(packet.header.sn)
+	if depacketizer.audioSN >= 0 && sn != (depacketizer.audioSN+1)&0xFFFF {
+		depacketizer.audioFragments = depacketizer.audioFragments[:0]
+	}
+	depacketizer.audioSN = sn
+
 	// aac raw payload
-	depacketizer.fragments = append(depacketizer.fragments, packet)
+	depacketizer.audioFragments = append(depacketizer.audioFragments, packet)
 	if packet.header.m != 0x01 {
 		return nil, nil
 	}
 
 	// copy rtp payload and reset cache
 	rtpPayload := make([]byte, 0)
-	for _, fragment := range depacketizer.fragments {
+	for _, fragment := range depacketizer.audioFragments {
 		rtpPayload = append(rtpPayload, fragment.payload...)
 	}
-	depacketizer.fragments = depacketizer.fragments[:0]
+	depacketizer.audioFragments = depacketizer.audioFragments[:0]
+	if len(rtpPayload) < 2 {
+		return nil, fmt.Errorf("RTP Parser: audio payload too short, %d bytes", len(rtpPayload))
+	}
 
 	auHeadersLength := uint16(rtpPayload[0])<<8 | uint16(rtpPayload[1])
 	numOfAuHeaders := auHeadersLength / 16
 	audioFrames := make([]*AudioFrame, numOfAuHeaders)
-	for pos, idx := uint16(2), uint16(0); idx < numOfAuHeaders; idx++ {
-		aacDataLen := uint16(rtpPayload[pos])<<5 | uint16(rtpPayload[pos+1])>>3
-		pos += 2
+	// all au-headers ahead of access units
+	pos := 2 + int(numOfAuHeaders)*2
+	if pos > len(rtpPayload) {
+		return nil, fmt.Errorf("RTP Parser: au-headers out of range, len:%d, payload:%d", auHeadersLength, len(rtpPayload))
+	}
+	for idx := uint16(0); idx < numOfAuHeaders; idx++ {
+		header := rtpPayload[2+idx*2:]
+		aacDataLen := int(header[0])<<5 | int(header[1])>>3
+		if pos+aacDataLen > len(rtpPayload) {
+			return nil, fmt.Errorf("RTP Parser: aac frame out of range, pos:%d, size:%d, payload:%d", pos, aacDataLen, len(rtpPayload))
+		}
 		aacPayload := rtpPayload[pos : pos+aacDataLen]
 		pos += aacDataLen
 
@@ -203,7 +320,7 @@ func (depacketizer *Depacketizer) DepacketizeAudio(packet *Packet) ([]*AudioFram
 			Timestamp: uint32(idx*1024) + packet.header.ts, // 1024 samples per aac frame
 			Raw:       aacPayload,
 		}
-		audioFrames[numOfAuHeaders] = audioFrame
+		audioFrames[idx] = audioFrame
 	}
 	return audioFrames, nil
 }
@@ -0,0 +1,142 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"gosm/pkg/avformat/hevc"
+	"gosm/pkg/log"
+)
+
+// rfc7798 4.4.2.  Aggregation Packets (APs)
+//
+//  0                   1                   2                   3
+//  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |                          RTP Header                           |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |   PayloadHdr (Type=48)        |         NALU 1 Size           |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |          NALU 1 HDR           |                               |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+         NALU 1 Data           |
+// |                   . . .                                       |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |  . . .        | NALU 2 Size                   | NALU 2 HDR    |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//
+// rfc7798 4.4.3.  Fragmentation Units (FUs)
+//
+//  0                   1                   2                   3
+//  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |    PayloadHdr (Type=49)       |   FU header   | DONL (cond)   |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//
+// FU header:
+// +---------------+
+// |0|1|2|3|4|5|6|7|
+// +-+-+-+-+-+-+-+-+
+// |S|E|  FuType   |
+// +---------------+
+//
+// NOTE: DONL absent, sprop-max-don-diff is 0 by default
+
+// depacketize hevc packet, returns true if marker reached
+func (depacketizer *Depacketizer) depacketizeHEVC(packet *Packet) (bool, error) {
+	marker := packet.header.m == 0x01
+	payload := packet.payload
+	if len(payload) < 3 {
+		return marker, fmt.Errorf("RTP Parser: hevc payload too short, len=%d", len(payload))
+	}
+
+	naluType := hevc.NALUType(payload[0])
+	switch {
+	case naluType < HEVCNALUAP: // single nal unit
+		if err := depacketizer.parseHEVCNalu(payload); err != nil {
+			return marker, err
+		}
+	case naluType == HEVCNALUAP:
+		if err := depacketizer.parseAP(payload[2:]); err != nil {
+			return marker, err
+		}
+	case naluType == HEVCNALUFU:
+		fuHeader := payload[2]
+		if fuHeader>>7&0x01 == 0x01 { // FU start
+			depacketizer.fragments = depacketizer.fragments[:0]
+		} else if len(depacketizer.fragments) == 0 { // FU start lost
+			if depacketizer.corrupted {
+				return marker, nil
+			}
+			return marker, fmt.Errorf("RTP Parser: hevc FU without start fragment")
+		}
+		depacketizer.fragments = append(depacketizer.fragments, packet)
+		if fuHeader>>6&0x01 != 0x01 { // FU end
+			return marker, nil
+		}
+
+		// restore nalu header with FuType, keep F & LayerId & TID
+		nalu := []byte{payload[0]&0x81 | (fuHeader&0x3F)<<1, payload[1]}
+		for _, fragment := range depacketizer.fragments {
+			nalu = append(nalu, fragment.payload[3:]...)
+		}
+		depacketizer.fragments = depacketizer.fragments[:0]
+		if err := depacketizer.parseHEVCNalu(nalu); err != nil {
+			return marker, err
+		}
+	case naluType == HEVCNALUPACI:
+		log.Debug("RTP: not support hevc PACI")
+	}
+	return marker, nil
+}
+
+// parse nalus from aggregation packet
+func (depacketizer *Depacketizer) parseAP(nalus []byte) error {
+	for pos := 0; pos != len(nalus); {
+		if pos+2 > len(nalus) {
+			return fmt.Errorf("RTP Parser: parse AP error, pos:%d, out of range:%d", pos, len(nalus))
+		}
+		lenOfNalu := int(binary.BigEndian.Uint16(nalus[pos:]))
+		pos = pos + 2
+		if lenOfNalu < 2 || pos+lenOfNalu > len(nalus) {
+			return fmt.Errorf("RTP Parser: parse AP error, nalu size:%d, out of range:%d", lenOfNalu, len(nalus))
+		}
+		if err := depacketizer.parseHEVCNalu(nalus[pos : pos+lenOfNalu]); err != nil {
+			return err
+		}
+		pos = pos + lenOfNalu
+	}
+	return nil
+}
+
+// parse vps / sps / pps, and append nalu in hvcC format
+func (depacketizer *Depacketizer) parseHEVCNalu(nalu []byte) error {
+	if len(nalu) < 2 {
+		return fmt.Errorf("RTP Parser: hevc nalu too short, len=%d", len(nalu))
+	}
+
+	naluType := hevc.NALUType(nalu[0])
+	switch {
+	case naluType == hevc.NALUVPS:
+		depacketizer.vps = nalu
+		return nil
+	case naluType == hevc.NALUSPS:
+		depacketizer.sps = nalu
+		return nil
+	case naluType == hevc.NALUPPS:
+		depacketizer.pps = nalu
+		return nil
+	case naluType == hevc.NALUAUD:
+		return nil
+	case hevc.IsIRAP(naluType):
+		depacketizer.needKeyframe = false
+	}
+
+	// hvcC format: nalu-size + nalu
+	if err := binary.Write(depacketizer.nalus, binary.BigEndian, uint32(len(nalu))); err != nil {
+		return err
+	}
+	if _, err := depacketizer.nalus.Write(nalu); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package rtp
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MaxJitterPackets packets buffered at most, flush regardless of latency if full
+	MaxJitterPackets = 512
+	// MaxDropout max sequence jump ahead treated as loss, see rfc3550 appendix A.1
+	MaxDropout = 3000
+	// MaxMisorder max sequence jump behind treated as late
+	MaxMisorder = 100
+	// MaxNackPackets max missing packets reported by one gap, retransmission is hopeless beyond
+	MaxNackPackets = 64
+)
+
+// JitterStats .
+type JitterStats struct {
+	Received uint64 // packets pushed
+	Lost     uint64 // packets never arrived within latency
+	Late     uint64 // packets arrived after its turn or duplicated, dropped
+}
+
+type jitterEntry struct {
+	ext     uint64 // extended sequence number
+	arrival time.Time
+	packet  *Packet
+}
+
+// JitterBuffer reorder packets of one source by sequence number,
+// a gap is waited for at most latency and then counted as lost
+type JitterBuffer struct {
+	latency time.Duration
+	entries []*jitterEntry // sorted by extended sequence number
+	started bool
+	maxExt  uint64 // highest extended sequence number
+	next    uint64 // next extended sequence number to pop
+	badSeq  int    // expected sequence number following a large jump, -1 if none
+
+	received uint64
+	lost     uint64
+	late     uint64
+}
+
+// NewJitterBuffer .
+func NewJitterBuffer(latency time.Duration) *JitterBuffer {
+	return &JitterBuffer{
+		latency: latency,
+		entries: make([]*jitterEntry, 0, 64),
+		started: false,
+		maxExt:  0,
+		next:    0,
+		badSeq:  -1,
+	}
+}
+
+// Push insert packet by sequence number, late or duplicated packet dropped,
+// returns missing sequence numbers newly detected ahead of the packet
+func (jb *JitterBuffer) Push(packet *Packet, now time.Time) []uint16 {
+	atomic.AddUint64(&jb.received, 1)
+	sn := packet.header.sn
+	ext := jb.extend(sn)
+
+	// large jump, resync if the following packet continues with it, ex. source restarted
+	if ext > jb.maxExt+MaxDropout || ext+MaxMisorder < jb.next {
+		if jb.badSeq != int(sn) {
+			jb.badSeq = int(sn + 1)
+			atomic.AddUint64(&jb.late, 1)
+			return nil
+		}
+		jb.entries = jb.entries[:0]
+		jb.started = false
+		ext = jb.extend(sn)
+	}
+	jb.badSeq = -1
+	var missing []uint16
+	if ext > jb.maxExt {
+		if gap := ext - jb.maxExt - 1; gap > 0 && gap <= MaxNackPackets {
+			for lost := jb.maxExt + 1; lost < ext; lost++ {
+				missing = append(missing, uint16(lost))
+			}
+		}
+		jb.maxExt = ext
+	}
+	if ext < jb.next {
+		atomic.AddUint64(&jb.late, 1)
+		return nil
+	}
+
+	// insert from tail, mostly in order
+	idx := len(jb.entries)
+	for idx > 0 && jb.entries[idx-1].ext >= ext {
+		if jb.entries[idx-1].ext == ext {
+			atomic.AddUint64(&jb.late, 1)
+			return nil
+		}
+		idx--
+	}
+	jb.entries = append(jb.entries, nil)
+	copy(jb.entries[idx+1:], jb.entries[idx:])
+	jb.entries[idx] = &jitterEntry{ext: ext, arrival: now, packet: packet}
+	return missing
+}
+
+// Pop packets in sequence, skip the gap if waited over latency or buffer is full
+func (jb *JitterBuffer) Pop(now time.Time) []*Packet {
+	var packets []*Packet
+	for len(jb.entries) > 0 {
+		entry := jb.entries[0]
+		if entry.ext != jb.next {
+			if now.Sub(entry.arrival) < jb.latency && len(jb.entries) < MaxJitterPackets {
+				break
+			}
+			if gap := entry.ext - jb.next; gap < MaxDropout {
+				atomic.AddUint64(&jb.lost, gap)
+			}
+			jb.next = entry.ext
+		}
+		packets = append(packets, entry.packet)
+		jb.entries[0] = nil
+		jb.entries = jb.entries[1:]
+		jb.next++
+	}
+	return packets
+}
+
+// Stats .
+func (jb *JitterBuffer) Stats() JitterStats {
+	return JitterStats{
+		Received: atomic.LoadUint64(&jb.received),
+		Lost:     atomic.LoadUint64(&jb.lost),
+		Late:     atomic.LoadUint64(&jb.late),
+	}
+}
+
+// extend 16 bits sequence number with wraparound cycles
+func (jb *JitterBuffer) extend(sn uint16) uint64 {
+	if !jb.started {
+		jb.started = true
+		jb.maxExt = 1<<16 | uint64(sn) // reserve one cycle for reordering ahead of the first packet
+		jb.next = jb.maxExt
+		return jb.maxExt
+	}
+	delta := int16(sn - uint16(jb.maxExt))
+	return uint64(int64(jb.maxExt) + int64(delta))
+}
@@ -0,0 +1,148 @@
+package rtp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJitterBuffer(t *testing.T) {
+	type step struct {
+		at      time.Duration // since the first push
+		push    []uint16      // sequence numbers pushed in order
+		missing []uint16      // missing sequence numbers reported by pushes
+		pop     []uint16      // sequence numbers popped after pushes
+	}
+	tests := []struct {
+		name    string
+		latency time.Duration
+		steps   []step
+		stats   JitterStats
+	}{
+		{
+			name:    "in order",
+			latency: 50 * time.Millisecond,
+			steps: []step{
+				{at: 0, push: []uint16{1, 2, 3}, pop: []uint16{1, 2, 3}},
+			},
+			stats: JitterStats{Received: 3},
+		},
+		{
+			name:    "wrap 65535 to 0",
+			latency: 50 * time.Millisecond,
+			steps: []step{
+				{at: 0, push: []uint16{65534, 65535, 0, 1}, pop: []uint16{65534, 65535, 0, 1}},
+			},
+			stats: JitterStats{Received: 4},
+		},
+		{
+			name:    "reorder within latency",
+			latency: 50 * time.Millisecond,
+			steps: []step{
+				{at: 0, push: []uint16{10, 12}, missing: []uint16{11}, pop: []uint16{10}},
+				{at: 20 * time.Millisecond, push: []uint16{11}, pop: []uint16{11, 12}},
+			},
+			stats: JitterStats{Received: 3},
+		},
+		{
+			name:    "reorder across wrap",
+			latency: 50 * time.Millisecond,
+			steps: []step{
+				{at: 0, push: []uint16{65534, 0}, missing: []uint16{65535}, pop: []uint16{65534}},
+				{at: 10 * time.Millisecond, push: []uint16{65535}, pop: []uint16{65535, 0}},
+			},
+			stats: JitterStats{Received: 3},
+		},
+		{
+			name:    "earlier than the first packet",
+			latency: 50 * time.Millisecond,
+			steps: []step{
+				{at: 0, push: []uint16{5, 4}, pop: []uint16{5}},
+			},
+			stats: JitterStats{Received: 2, Late: 1},
+		},
+		{
+			name:    "loss after latency expired",
+			latency: 50 * time.Millisecond,
+			steps: []step{
+				{at: 0, push: []uint16{1, 4}, missing: []uint16{2, 3}, pop: []uint16{1}},
+				{at: 40 * time.Millisecond, pop: nil},
+				{at: 60 * time.Millisecond, pop: []uint16{4}},
+				{at: 70 * time.Millisecond, push: []uint16{2}, pop: nil},
+			},
+			stats: JitterStats{Received: 3, Lost: 2, Late: 1},
+		},
+		{
+			name:    "duplicate dropped",
+			latency: 50 * time.Millisecond,
+			steps: []step{
+				{at: 0, push: []uint16{1, 2, 2}, pop: []uint16{1, 2}},
+				{at: 10 * time.Millisecond, push: []uint16{1}, pop: nil},
+			},
+			stats: JitterStats{Received: 4, Late: 2},
+		},
+		{
+			name:    "resync after large jump",
+			latency: 50 * time.Millisecond,
+			steps: []step{
+				{at: 0, push: []uint16{1, 2}, pop: []uint16{1, 2}},
+				{at: 10 * time.Millisecond, push: []uint16{40000}, pop: nil},
+				{at: 20 * time.Millisecond, push: []uint16{40001, 40002}, pop: []uint16{40001, 40002}},
+			},
+			stats: JitterStats{Received: 5, Late: 1},
+		},
+		{
+			name:    "single jump ignored",
+			latency: 50 * time.Millisecond,
+			steps: []step{
+				{at: 0, push: []uint16{1, 2}, pop: []uint16{1, 2}},
+				{at: 10 * time.Millisecond, push: []uint16{40000, 3}, pop: []uint16{3}},
+			},
+			stats: JitterStats{Received: 4, Late: 1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jb := NewJitterBuffer(test.latency)
+			start := time.Now()
+			for idx, step := range test.steps {
+				now := start.Add(step.at)
+				var missing []uint16
+				for _, sn := range step.push {
+					missing = append(missing, jb.Push(NewPacket(PacketTypeAVC, sn, 0, 1, false, nil), now)...)
+				}
+				if !reflect.DeepEqual(missing, step.missing) {
+					t.Fatalf("step %d: missing %v, expected %v", idx, missing, step.missing)
+				}
+				var popped []uint16
+				for _, packet := range jb.Pop(now) {
+					popped = append(popped, packet.SequenceNumber())
+				}
+				if !reflect.DeepEqual(popped, step.pop) {
+					t.Fatalf("step %d: popped %v, expected %v", idx, popped, step.pop)
+				}
+			}
+			if stats := jb.Stats(); stats != test.stats {
+				t.Fatalf("stats %+v, expected %+v", stats, test.stats)
+			}
+		})
+	}
+}
+
+func TestJitterBufferFull(t *testing.T) {
+	jb := NewJitterBuffer(time.Hour)
+	now := time.Now()
+	jb.Push(NewPacket(PacketTypeAVC, 0, 0, 1, false, nil), now)
+	jb.Pop(now)
+
+	// gap never filled, flushed once buffer is full regardless of latency
+	for sn := uint16(2); sn < 2+MaxJitterPackets; sn++ {
+		jb.Push(NewPacket(PacketTypeAVC, sn, 0, 1, false, nil), now)
+	}
+	if popped := jb.Pop(now); len(popped) != MaxJitterPackets || popped[0].SequenceNumber() != 2 {
+		t.Fatalf("popped %d packets, expected %d from 2", len(popped), MaxJitterPackets)
+	}
+	if stats := jb.Stats(); stats.Lost != 1 {
+		t.Fatalf("lost %d, expected 1", stats.Lost)
+	}
+}
@@ -0,0 +1,212 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+
+	"gosm/pkg/avformat"
+	"gosm/pkg/avformat/aac"
+	"gosm/pkg/avformat/avc"
+	"gosm/pkg/avformat/flv"
+)
+
+// MaxPayloadSize rtp payload size limit, leaves room for ip/udp/rtp header within MTU
+const MaxPayloadSize = 1400
+
+// Packetizer packetize av packets of one track into rtp packets
+type Packetizer struct {
+	pt        uint8
+	ssrc      uint32
+	sn        uint16 // next sequence number
+	clockRate uint32 // 90000 for video, sample rate for audio
+	baseTs    uint32 // random timestamp offset
+	sps       []byte
+	pps       []byte
+}
+
+// NewPacketizer .
+func NewPacketizer(pt uint8, clockRate uint32) *Packetizer {
+	return &Packetizer{
+		pt:        pt,
+		ssrc:      rand.Uint32(),
+		sn:        uint16(rand.Uint32()),
+		clockRate: clockRate,
+		baseTs:    rand.Uint32(),
+		sps:       nil,
+		pps:       nil,
+	}
+}
+
+// SSRC .
+func (packetizer *Packetizer) SSRC() uint32 {
+	return packetizer.ssrc
+}
+
+// Sequence next sequence number
+func (packetizer *Packetizer) Sequence() uint16 {
+	return packetizer.sn
+}
+
+// SetClockRate .
+func (packetizer *Packetizer) SetClockRate(clockRate uint32) {
+	packetizer.clockRate = clockRate
+}
+
+// ClockRate .
+func (packetizer *Packetizer) ClockRate() uint32 {
+	return packetizer.clockRate
+}
+
+// convert millisecond to rtp timestamp
+func (packetizer *Packetizer) rtpTimestamp(ms uint32) uint32 {
+	return packetizer.baseTs + uint32(uint64(ms)*uint64(packetizer.clockRate)/1000)
+}
+
+func (packetizer *Packetizer) newPacket(ts uint32, marker bool, payload []byte) *Packet {
+	packet := NewPacket(packetizer.pt, packetizer.sn, ts, packetizer.ssrc, marker, payload)
+	packetizer.sn++
+	return packet
+}
+
+// PacketizeAVC packetize flv avc video tag, see rfc6184
+//
+//   - sequence header: cache sps & pps, nothing outputs
+//   - keyframe: sps & pps aggregated as STAP-A ahead
+//   - nalu within MaxPayloadSize: single nal unit packet
+//   - nalu large than MaxPayloadSize: FU-A
+//
+// marker bit set on the last packet of the access unit
+func (packetizer *Packetizer) PacketizeAVC(packet *avformat.AVPacket) ([]*Packet, error) {
+	videoTag, err := flv.ParseAVCVideoPackage(packet.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// sequence header
+	if packet.IsAVCSeqHeader() {
+		parser := avc.NewAVCParser(nil)
+		if err := parser.ParseExtradata(videoTag.Data); err != nil {
+			return nil, err
+		}
+		packetizer.sps = parser.Extradata().Sps
+		packetizer.pps = parser.Extradata().Pps
+		return nil, nil
+	}
+	if videoTag.AVCPacketType != flv.AVCNALU {
+		return nil, nil
+	}
+
+	// avcC: nalu-size + nalu
+	nalus := make([][]byte, 0)
+	if packet.IsAVCKeyframe() && packetizer.sps != nil && packetizer.pps != nil {
+		nalus = append(nalus, packetizer.stapA(packetizer.sps, packetizer.pps))
+	}
+	for pos := 0; pos < len(videoTag.Data); {
+		if pos+4 > len(videoTag.Data) {
+			return nil, fmt.Errorf("RTP: packetize avc error, nalu size out of range")
+		}
+		size := int(binary.BigEndian.Uint32(videoTag.Data[pos:]))
+		pos += 4
+		if size == 0 || pos+size > len(videoTag.Data) {
+			return nil, fmt.Errorf("RTP: packetize avc error, invalid nalu size %d", size)
+		}
+		nalu := videoTag.Data[pos : pos+size]
+		pos += size
+
+		switch nalu[0] & 0x1F {
+		case avc.NALUAccessUnitDelimiter, avc.NALUFillerData:
+		default:
+			nalus = append(nalus, nalu)
+		}
+	}
+
+	// pts = dts + composition time
+	ts := packetizer.rtpTimestamp(packet.Timestamp + uint32(videoTag.CompositionTime))
+	packets := make([]*Packet, 0, len(nalus))
+	for idx, nalu := range nalus {
+		last := idx == len(nalus)-1
+
+		// single nal unit
+		if len(nalu) <= MaxPayloadSize {
+			packets = append(packets, packetizer.newPacket(ts, last, nalu))
+			continue
+		}
+
+		// FU-A
+		//   FU indicator: F | NRI | Type(28)
+		//   FU header:    S | E | R | Type
+		indicator := nalu[0]&0xE0 | NALUFUA
+		for pos := 1; pos < len(nalu); {
+			end := pos + MaxPayloadSize - 2
+			if end > len(nalu) {
+				end = len(nalu)
+			}
+			header := nalu[0] & 0x1F
+			if pos == 1 {
+				header |= 0x80
+			}
+			if end == len(nalu) {
+				header |= 0x40
+			}
+			payload := make([]byte, 0, end-pos+2)
+			payload = append(payload, indicator, header)
+			payload = append(payload, nalu[pos:end]...)
+			packets = append(packets, packetizer.newPacket(ts, last && end == len(nalu), payload))
+			pos = end
+		}
+	}
+	return packets, nil
+}
+
+// STAP-A: STAP-A NAL HDR | NALU 1 Size | NALU 1 HDR & Data | NALU 2 Size | ...
+func (packetizer *Packetizer) stapA(nalus ...[]byte) []byte {
+	var nri uint8
+	payload := []byte{0x00}
+	for _, nalu := range nalus {
+		if nalu[0]&0x60 > nri {
+			nri = nalu[0] & 0x60
+		}
+		payload = append(payload, byte(len(nalu)>>8), byte(len(nalu)))
+		payload = append(payload, nalu...)
+	}
+	payload[0] = nri | NALUSTAPA
+	return payload
+}
+
+// PacketizeAAC packetize flv aac audio tag, see rfc3640 section 3.3.6 High Bit-rate AAC
+//
+//   - sequence header: update clock rate with sampling frequency, nothing outputs
+//   - raw: one access unit per packet, AU-header = size(13b) + index(3b)
+func (packetizer *Packetizer) PacketizeAAC(packet *avformat.AVPacket) ([]*Packet, error) {
+	audioTag, err := flv.ParseAACAudioData(packet.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// sequence header
+	if packet.IsAACSeqHeader() {
+		parser := aac.NewAACParser(nil)
+		if err := parser.ParseAudioSpecificConfig(audioTag.Data); err != nil {
+			return nil, err
+		}
+		idx := int(parser.AudioSpecificConfig().SamplingFrequencyIndex)
+		if idx >= len(aac.AACSampleRate) {
+			return nil, fmt.Errorf("RTP: packetize aac error, invalid sampling frequency index %d", idx)
+		}
+		packetizer.clockRate = uint32(aac.AACSampleRate[idx])
+		return nil, nil
+	}
+
+	size := len(audioTag.Data)
+	if size == 0 || size >= 1<<13 {
+		return nil, fmt.Errorf("RTP: packetize aac error, invalid frame size %d", size)
+	}
+	payload := make([]byte, 0, size+4)
+	payload = append(payload, 0x00, 0x10)                   // AU-headers-length: 16 bits
+	payload = append(payload, byte(size>>5), byte(size<<3)) // AU-size + AU-Index
+	payload = append(payload, audioTag.Data...)
+
+	ts := packetizer.rtpTimestamp(packet.Timestamp)
+	return []*Packet{packetizer.newPacket(ts, true, payload)}, nil
+}
@@ -0,0 +1,213 @@
+package rtp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"gosm/pkg/avformat"
+	"gosm/pkg/avformat/avc"
+	"gosm/pkg/avformat/flv"
+)
+
+var (
+	testSPS = []byte{0x67, 0x64, 0x00, 0x1F, 0xAC}
+	testPPS = []byte{0x68, 0xEE, 0x3C, 0x80}
+)
+
+// avcPacket flv avc video tag of avcC nalus
+func avcPacket(timestamp uint32, cts int32, keyframe bool, nalus ...[]byte) *avformat.AVPacket {
+	frameType := flv.AVCInterFrame
+	if keyframe {
+		frameType = flv.AVCKeyFrame
+	}
+	body := []byte{frameType<<4 | flv.CodevIDAVC, flv.AVCNALU, byte(cts >> 16), byte(cts >> 8), byte(cts)}
+	for _, nalu := range nalus {
+		body = append(body, byte(len(nalu)>>24), byte(len(nalu)>>16), byte(len(nalu)>>8), byte(len(nalu)))
+		body = append(body, nalu...)
+	}
+	return &avformat.AVPacket{TypeID: avformat.TypeVideo, Timestamp: timestamp, Body: body}
+}
+
+// avcSeqHeader flv avc sequence header of test sps & pps
+func avcSeqHeader() *avformat.AVPacket {
+	cfg := &avc.AVCDecoderConfigurationRecord{ConfigurationVersion: 1, AvcProfileIndication: 0x64,
+		AvcLevelIndication: 0x1F, Sps: testSPS, Pps: testPPS}
+	body := append([]byte{flv.AVCKeyFrame<<4 | flv.CodevIDAVC, flv.AVCSeqHeader, 0x00, 0x00, 0x00}, cfg.Bytes()...)
+	return &avformat.AVPacket{TypeID: avformat.TypeVideo, Body: body}
+}
+
+// nalu of size with header
+func nalu(header byte, size int) []byte {
+	p := make([]byte, size)
+	p[0] = header
+	for idx := 1; idx < size; idx++ {
+		p[idx] = byte(idx)
+	}
+	return p
+}
+
+func TestPacketizeAVC(t *testing.T) {
+	idr := nalu(0x65, 3000)
+	tests := []struct {
+		name      string
+		seqHeader bool
+		packet    *avformat.AVPacket
+		ts        uint32
+		payloads  [][]byte // expected payloads, marker set on the last
+	}{
+		{
+			name:      "keyframe with sps & pps aggregated",
+			seqHeader: true,
+			packet:    avcPacket(1000, 80, true, []byte{0x09, 0xF0}, nalu(0x65, 100)),
+			ts:        1080 * 90,
+			payloads: [][]byte{
+				append(append([]byte{0x60 | NALUSTAPA, 0x00, 0x05}, testSPS...), append([]byte{0x00, 0x04}, testPPS...)...),
+				nalu(0x65, 100),
+			},
+		},
+		{
+			name:     "keyframe without sequence header",
+			packet:   avcPacket(40, 0, true, nalu(0x65, 100)),
+			ts:       40 * 90,
+			payloads: [][]byte{nalu(0x65, 100)},
+		},
+		{
+			name:     "sei & slice",
+			packet:   avcPacket(40, -40, false, nalu(0x06, 10), nalu(0x41, MaxPayloadSize)),
+			ts:       0,
+			payloads: [][]byte{nalu(0x06, 10), nalu(0x41, MaxPayloadSize)},
+		},
+		{
+			name:   "FU-A",
+			packet: avcPacket(0, 0, false, idr),
+			ts:     0,
+			payloads: [][]byte{
+				append([]byte{0x60 | NALUFUA, 0x80 | 0x05}, idr[1:1+MaxPayloadSize-2]...),
+				append([]byte{0x60 | NALUFUA, 0x05}, idr[1+MaxPayloadSize-2:1+2*(MaxPayloadSize-2)]...),
+				append([]byte{0x60 | NALUFUA, 0x40 | 0x05}, idr[1+2*(MaxPayloadSize-2):]...),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			packetizer := NewPacketizer(PacketTypeAVC, 90000)
+			packetizer.baseTs = 0
+			packetizer.sn = 65534
+			if test.seqHeader {
+				if packets, err := packetizer.PacketizeAVC(avcSeqHeader()); err != nil || len(packets) != 0 {
+					t.Fatalf("%d packets of sequence header, error %v", len(packets), err)
+				}
+			}
+			packets, err := packetizer.PacketizeAVC(test.packet)
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if len(packets) != len(test.payloads) {
+				t.Fatalf("%d packets, expected %d", len(packets), len(test.payloads))
+			}
+			for idx, packet := range packets {
+				last := idx == len(packets)-1
+				if packet.SequenceNumber() != uint16(65534+idx) || packet.Timestamp() != test.ts || (packet.header.m == 1) != last {
+					t.Fatalf("packet %d: sn %d, ts %d, marker %d, expected %d, %d, %v", idx, packet.SequenceNumber(),
+						packet.Timestamp(), packet.header.m, uint16(65534+idx), test.ts, last)
+				}
+				if packet.header.pt != PacketTypeAVC || packet.SSRC() != packetizer.SSRC() {
+					t.Fatalf("packet %d: pt %d, ssrc %d", idx, packet.header.pt, packet.SSRC())
+				}
+				if !bytes.Equal(packet.payload, test.payloads[idx]) {
+					t.Fatalf("packet %d: payload %x, expected %x", idx, packet.payload, test.payloads[idx])
+				}
+			}
+			if packetizer.Sequence() != uint16(65534+len(packets)) {
+				t.Fatalf("next sequence %d, expected %d", packetizer.Sequence(), uint16(65534+len(packets)))
+			}
+		})
+	}
+}
+
+func TestPacketizeAVCInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{name: "too short", body: []byte{0x27, 0x01, 0x00}},
+		{name: "truncated nalu size", body: []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}},
+		{name: "zero nalu size", body: []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x41}},
+		{name: "nalu size out of range", body: []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x08, 0x41}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			packetizer := NewPacketizer(PacketTypeAVC, 90000)
+			packet := &avformat.AVPacket{TypeID: avformat.TypeVideo, Body: test.body}
+			if packets, err := packetizer.PacketizeAVC(packet); err == nil {
+				t.Fatalf("%d packets, expected error", len(packets))
+			}
+		})
+	}
+}
+
+func TestPacketizeAAC(t *testing.T) {
+	frame := nalu(0x21, 300)
+	tests := []struct {
+		name      string
+		config    []byte // audio specific config
+		timestamp uint32
+		clockRate uint32
+		ts        uint32
+	}{
+		{name: "44100", config: []byte{0x12, 0x10}, timestamp: 1000, clockRate: 44100, ts: 44100},
+		{name: "48000", config: []byte{0x11, 0x90}, timestamp: 20, clockRate: 48000, ts: 960},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			packetizer := NewPacketizer(PacketTypeAAC, 8000)
+			packetizer.baseTs = 0
+			seqHeader := &avformat.AVPacket{TypeID: avformat.TypeAudio, Body: append([]byte{0xAF, flv.AACSeqHeader}, test.config...)}
+			if packets, err := packetizer.PacketizeAAC(seqHeader); err != nil || len(packets) != 0 {
+				t.Fatalf("%d packets of sequence header, error %v", len(packets), err)
+			}
+			if packetizer.clockRate != test.clockRate {
+				t.Fatalf("clock rate %d, expected %d", packetizer.clockRate, test.clockRate)
+			}
+
+			raw := &avformat.AVPacket{TypeID: avformat.TypeAudio, Timestamp: test.timestamp, Body: append([]byte{0xAF, flv.AACRaw}, frame...)}
+			packets, err := packetizer.PacketizeAAC(raw)
+			if err != nil || len(packets) != 1 {
+				t.Fatalf("%d packets, error %v, expected 1", len(packets), err)
+			}
+			packet := packets[0]
+			if packet.Timestamp() != test.ts || packet.header.m != 1 || packet.header.pt != PacketTypeAAC {
+				t.Fatalf("ts %d, marker %d, pt %d, expected %d with marker", packet.Timestamp(), packet.header.m, packet.header.pt, test.ts)
+			}
+			// AU-headers-length 16 bits, AU-size 300 & AU-Index 0
+			header := []byte{0x00, 0x10, 0x00, 0x00}
+			binary.BigEndian.PutUint16(header[2:], uint16(len(frame)<<3))
+			if !bytes.Equal(packet.payload, append(header, frame...)) {
+				t.Fatalf("payload %x, expected %x", packet.payload[:4], header)
+			}
+		})
+	}
+}
+
+func TestPacketizeAACInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{name: "too short", body: []byte{0xAF}},
+		{name: "not aac", body: []byte{0x2F, flv.AACRaw, 0x21}},
+		{name: "explicit sampling frequency", body: []byte{0xAF, flv.AACSeqHeader, 0x17, 0x90}},
+		{name: "empty frame", body: []byte{0xAF, flv.AACRaw}},
+		{name: "frame too large", body: append([]byte{0xAF, flv.AACRaw}, make([]byte, 1<<13)...)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			packetizer := NewPacketizer(PacketTypeAAC, 44100)
+			packet := &avformat.AVPacket{TypeID: avformat.TypeAudio, Body: test.body}
+			if packets, err := packetizer.PacketizeAAC(packet); err == nil {
+				t.Fatalf("%d packets, expected error", len(packets))
+			}
+		})
+	}
+}
@@ -5,13 +5,23 @@ import (
 	"gosm/pkg/avformat"
 	"gosm/pkg/avformat/avc"
 	"gosm/pkg/avformat/flv"
+	"gosm/pkg/avformat/hevc"
 	"time"
 )
 
-type RTMPPacker struct{}
+type RTMPPacker struct {
+	audioConfig []byte // AudioSpecificConfig
+}
 
 func NewRTMPRepacker() *RTMPPacker {
-	return &RTMPPacker{}
+	return &RTMPPacker{
+		audioConfig: []byte{0x11, 0x90, 0x56, 0xe5, 0x00},
+	}
+}
+
+// SetAudioSpecificConfig overrides default aac config, ex. sdp fmtp config
+func (packer *RTMPPacker) SetAudioSpecificConfig(cfg []byte) {
+	packer.audioConfig = cfg
 }
 
 func (packer *RTMPPacker) VideoSeqHdrPacket(sps, pps []byte) (*avformat.AVPacket, error) {
@@ -60,8 +70,7 @@ func (packer *RTMPPacker) PackVideo(ts uint32, pts, dts int32, payload []byte) (
 	}
 
 	// key frame
-	naluType := payload[4] & 0x1F
-	if naluType == avc.NALUIDRPicture {
+	if avc.IsKeyframe(payload) {
 		avcNalu.FrameType = flv.AVCKeyFrame
 	}
 
@@ -76,7 +85,63 @@ func (packer *RTMPPacker) PackVideo(ts uint32, pts, dts int32, payload []byte) (
 	return avPacket, nil
 }
 
-// copy from obs fixed {0x11, 0x90, 0x56, 0xe5, 0x00}
+// HEVCSeqHdrPacket hevc sequence header in enhanced rtmp format
+func (packer *RTMPPacker) HEVCSeqHdrPacket(vps, sps, pps []byte) (*avformat.AVPacket, error) {
+	if vps == nil || sps == nil || pps == nil {
+		return nil, fmt.Errorf("RTP: pack rtmp hevc sequence packet error, VPS or SPS or PPS is empty")
+	}
+
+	cfg := &hevc.HEVCDecoderConfigurationRecord{Vps: vps, Sps: sps, Pps: pps}
+	record, err := cfg.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("RTP: pack rtmp hevc sequence packet error, %v", err)
+	}
+	hevcSeqHdr := &flv.ExVideoTagData{
+		FrameType:  flv.AVCKeyFrame,
+		PacketType: flv.PacketTypeSequenceStart,
+		FourCC:     flv.FourCCHEVC,
+		Data:       record,
+	}
+	avPayload := hevcSeqHdr.Bytes()
+	avPacket := &avformat.AVPacket{
+		TypeID:    avformat.TypeVideo,
+		Length:    uint32(len(avPayload)),
+		Timestamp: 0,
+		StreamID:  1,
+		Body:      avPayload,
+	}
+	return avPacket, nil
+}
+
+// PackHEVC hevc frame in enhanced rtmp format
+// @ts				rtmp packet timestamp
+// @pts				presentation timestamp
+// @dts				decoding timestamp
+// @payload		nalus, hvcC format: nalu-size + nalu
+func (packer *RTMPPacker) PackHEVC(ts uint32, pts, dts int32, payload []byte) (*avformat.AVPacket, error) {
+	hevcNalu := &flv.ExVideoTagData{
+		FrameType:       flv.AVCInterFrame,
+		PacketType:      flv.PacketTypeCodedFrames,
+		FourCC:          flv.FourCCHEVC,
+		CompositionTime: pts - dts,
+		Data:            payload,
+	}
+	if hevc.IsKeyframe(payload) {
+		hevcNalu.FrameType = flv.AVCKeyFrame
+	}
+
+	avPayload := hevcNalu.Bytes()
+	avPacket := &avformat.AVPacket{
+		TypeID:    avformat.TypeVideo,
+		Length:    uint32(len(avPayload)),
+		Timestamp: ts,
+		StreamID:  1,
+		Body:      avPayload,
+	}
+	return avPacket, nil
+}
+
+// default copy from obs fixed {0x11, 0x90, 0x56, 0xe5, 0x00}
 // defines see https://wiki.multimedia.cx/index.php?title=MPEG-4_Audio
 //
 // ----------------------------------------------
@@ -98,7 +163,7 @@ func (packer *RTMPPacker) AudioSeqHdrPacket() *avformat.AVPacket {
 		SoundSize:      flv.SoundRate16Bit,
 		SoundType:      flv.SoundTypeStereo,
 		AACPackageType: flv.AACSeqHeader,
-		Data:           []byte{0x11, 0x90, 0x56, 0xe5, 0x00},
+		Data:           packer.audioConfig,
 	}
 	avPayload := audioSeqHdr.Bytes()
 	avPacket := &avformat.AVPacket{
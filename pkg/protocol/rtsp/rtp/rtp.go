@@ -83,6 +83,20 @@ func (header *Header) Parse(p []byte) (n int, err error) {
 	return pos, nil
 }
 
+// Bytes marshal header without header extension
+func (header *Header) Bytes() []byte {
+	p := make([]byte, RTPHeaderLength+4*len(header.csrc))
+	p[0] = header.v<<6 | header.p<<5 | uint8(len(header.csrc))
+	p[1] = header.m<<7 | header.pt
+	binary.BigEndian.PutUint16(p[2:], header.sn)
+	binary.BigEndian.PutUint32(p[4:], header.ts)
+	binary.BigEndian.PutUint32(p[8:], header.ssrc)
+	for idx, csrc := range header.csrc {
+		binary.BigEndian.PutUint32(p[RTPHeaderLength+4*idx:], csrc)
+	}
+	return p
+}
+
 type Packet struct {
 	header  *Header
 	payload []byte
@@ -103,6 +117,30 @@ func ParsePacket(p []byte) (*Packet, error) {
 	return packet, nil
 }
 
+// NewPacket .
+func NewPacket(pt uint8, sn uint16, ts uint32, ssrc uint32, marker bool, payload []byte) *Packet {
+	header := &Header{v: 2, pt: pt, sn: sn, ts: ts, ssrc: ssrc}
+	if marker {
+		header.m = 0x01
+	}
+	return &Packet{header: header, payload: payload}
+}
+
+// Bytes marshal rtp packet
+func (packet *Packet) Bytes() []byte {
+	return append(packet.header.Bytes(), packet.payload...)
+}
+
 func (packet *Packet) Timestamp() uint32 {
 	return packet.header.ts
 }
+
+// SSRC .
+func (packet *Packet) SSRC() uint32 {
+	return packet.header.ssrc
+}
+
+// SequenceNumber .
+func (packet *Packet) SequenceNumber() uint16 {
+	return packet.header.sn
+}
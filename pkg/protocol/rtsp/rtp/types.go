@@ -27,3 +27,24 @@ const (
 	NALUFUA    = uint8(28)
 	NALUFUB    = uint8(29)
 )
+
+// RFC7798 Section 4.4.
+//
+// Type   Packet    Type name                        Section
+// ---------------------------------------------------------
+// 0-47   NAL unit  Single NAL unit packet             4.4.1
+// 48     AP        Aggregation packet                 4.4.2
+// 49     FU        Fragmentation unit                 4.4.3
+// 50     PACI      PAyload Content Information        4.4.4
+
+const (
+	HEVCNALUAP   = uint8(48)
+	HEVCNALUFU   = uint8(49)
+	HEVCNALUPACI = uint8(50)
+)
+
+// video codec of depacketizer
+const (
+	CodecH264 = "H264"
+	CodecH265 = "H265"
+)
@@ -0,0 +1,266 @@
+package rtsp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gosm/pkg/avformat/aac"
+	"gosm/pkg/avformat/avc"
+)
+
+// SessionDescription sdp, see rfc4566
+//
+//	v=0
+//	o=- 0 0 IN IP4 127.0.0.1
+//	s=No Name
+//	c=IN IP4 0.0.0.0
+//	t=0 0
+//	m=video 0 RTP/AVP 96
+//	a=rtpmap:96 H264/90000
+//	a=fmtp:96 packetization-mode=1; sprop-parameter-sets=Z2QAH6zZ...,aOvjyyLA; profile-level-id=64001F
+//	a=control:streamid=0
+//	m=audio 0 RTP/AVP 97
+//	a=rtpmap:97 MPEG4-GENERIC/44100/2
+//	a=fmtp:97 profile-level-id=1;mode=AAC-hbr;sizelength=13;indexlength=3;indexdeltalength=3;config=121056E500
+//	a=control:streamid=1
+type SessionDescription struct {
+	Origin     string
+	Name       string
+	Connection string
+	Attributes []string
+	Medias     []*MediaDescription
+}
+
+// MediaDescription sdp media section, begins with 'm='
+type MediaDescription struct {
+	Type       string // video or audio
+	Port       int
+	Proto      string
+	Format     uint8 // rtp payload type
+	Attributes []string
+}
+
+// ParseSDP .
+func ParseSDP(p []byte) (*SessionDescription, error) {
+	sdp := &SessionDescription{}
+
+	var media *MediaDescription
+	for _, line := range strings.Split(string(p), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) < 2 || line[1] != '=' {
+			continue
+		}
+		key, value := line[0], line[2:]
+
+		switch key {
+		case 'o':
+			sdp.Origin = value
+		case 's':
+			sdp.Name = value
+		case 'c':
+			if media == nil {
+				sdp.Connection = value
+			}
+		case 'm':
+			fields := strings.Fields(value)
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("SDP: malformed media line '%s'", line)
+			}
+			port, err := strconv.Atoi(strings.SplitN(fields[1], "/", 2)[0])
+			if err != nil {
+				return nil, fmt.Errorf("SDP: malformed media port '%s'", fields[1])
+			}
+			format, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return nil, fmt.Errorf("SDP: malformed media format '%s'", fields[3])
+			}
+			media = &MediaDescription{
+				Type:   fields[0],
+				Port:   port,
+				Proto:  fields[2],
+				Format: uint8(format),
+			}
+			sdp.Medias = append(sdp.Medias, media)
+		case 'a':
+			if media == nil {
+				sdp.Attributes = append(sdp.Attributes, value)
+			} else {
+				media.Attributes = append(media.Attributes, value)
+			}
+		}
+	}
+	return sdp, nil
+}
+
+// Bytes marshal sdp to text
+func (sdp *SessionDescription) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("v=0\r\n")
+	fmt.Fprintf(buf, "o=%s\r\n", sdp.Origin)
+	fmt.Fprintf(buf, "s=%s\r\n", sdp.Name)
+	fmt.Fprintf(buf, "c=%s\r\n", sdp.Connection)
+	buf.WriteString("t=0 0\r\n")
+	for _, attribute := range sdp.Attributes {
+		fmt.Fprintf(buf, "a=%s\r\n", attribute)
+	}
+	for _, media := range sdp.Medias {
+		fmt.Fprintf(buf, "m=%s %d %s %d\r\n", media.Type, media.Port, media.Proto, media.Format)
+		for _, attribute := range media.Attributes {
+			fmt.Fprintf(buf, "a=%s\r\n", attribute)
+		}
+	}
+	return buf.Bytes()
+}
+
+// Attribute returns value of 'a=key:value', empty if not found
+func (media *MediaDescription) Attribute(key string) string {
+	for _, attribute := range media.Attributes {
+		if strings.HasPrefix(attribute, key+":") {
+			return strings.TrimSpace(attribute[len(key)+1:])
+		}
+	}
+	return ""
+}
+
+// Control .
+func (media *MediaDescription) Control() string {
+	return media.Attribute("control")
+}
+
+// RTPMap parse 'a=rtpmap:<payload type> <encoding name>/<clock rate>[/<encoding parameters>]'
+func (media *MediaDescription) RTPMap() (codec string, clockRate int, channels int) {
+	fields := strings.Fields(media.Attribute("rtpmap"))
+	if len(fields) != 2 {
+		return "", 0, 0
+	}
+	parts := strings.Split(fields[1], "/")
+	codec = strings.ToUpper(parts[0])
+	if len(parts) > 1 {
+		clockRate, _ = strconv.Atoi(parts[1])
+	}
+	channels = 1
+	if len(parts) > 2 {
+		channels, _ = strconv.Atoi(parts[2])
+	}
+	return codec, clockRate, channels
+}
+
+// FMTP parse 'a=fmtp:<format> <key>=<value>; ...' to map, keys in lower case
+func (media *MediaDescription) FMTP() map[string]string {
+	params := make(map[string]string)
+	fields := strings.SplitN(media.Attribute("fmtp"), " ", 2)
+	if len(fields) != 2 {
+		return params
+	}
+	for _, param := range strings.Split(fields[1], ";") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToLower(kv[0])] = kv[1]
+		}
+	}
+	return params
+}
+
+// ParameterSets parse sps & pps from fmtp 'sprop-parameter-sets'
+func (media *MediaDescription) ParameterSets() (sps, pps []byte) {
+	sets := strings.Split(media.FMTP()["sprop-parameter-sets"], ",")
+	for _, set := range sets {
+		nalu, err := base64.StdEncoding.DecodeString(set)
+		if err != nil || len(nalu) == 0 {
+			continue
+		}
+		switch nalu[0] & 0x1F {
+		case avc.NALUSPS:
+			sps = nalu
+		case avc.NALUPPS:
+			pps = nalu
+		}
+	}
+	return sps, pps
+}
+
+// HEVCParameterSets parse vps & sps & pps from fmtp 'sprop-vps', 'sprop-sps', 'sprop-pps', see rfc7798 section 7.1
+func (media *MediaDescription) HEVCParameterSets() (vps, sps, pps []byte) {
+	fmtp := media.FMTP()
+	decode := func(key string) []byte {
+		// the first one if more than one parameter set
+		set := strings.Split(fmtp[key], ",")[0]
+		nalu, err := base64.StdEncoding.DecodeString(set)
+		if err != nil || len(nalu) < 2 {
+			return nil
+		}
+		return nalu
+	}
+	return decode("sprop-vps"), decode("sprop-sps"), decode("sprop-pps")
+}
+
+// AudioSpecificConfig parse aac config from fmtp 'config'
+func (media *MediaDescription) AudioSpecificConfig() []byte {
+	config, err := hex.DecodeString(media.FMTP()["config"])
+	if err != nil {
+		return nil
+	}
+	return config
+}
+
+// NewSDP .
+func NewSDP(name string) *SessionDescription {
+	return &SessionDescription{
+		Origin:     "- 0 0 IN IP4 127.0.0.1",
+		Name:       name,
+		Connection: "IN IP4 0.0.0.0",
+		Attributes: []string{"tool:" + "gosm", "range:npt=0-"},
+		Medias:     make([]*MediaDescription, 0),
+	}
+}
+
+// AddVideo add H.264 media from AVCDecoderConfigurationRecord, see rfc6184 section 8.1
+func (sdp *SessionDescription) AddVideo(format uint8, cfg *avc.AVCDecoderConfigurationRecord) {
+	fmtp := fmt.Sprintf("fmtp:%d packetization-mode=1; sprop-parameter-sets=%s,%s; profile-level-id=%02X%02X%02X",
+		format,
+		base64.StdEncoding.EncodeToString(cfg.Sps),
+		base64.StdEncoding.EncodeToString(cfg.Pps),
+		cfg.AvcProfileIndication, cfg.ProfileCompatibility, cfg.AvcLevelIndication)
+	sdp.Medias = append(sdp.Medias, &MediaDescription{
+		Type:   "video",
+		Port:   0,
+		Proto:  "RTP/AVP",
+		Format: format,
+		Attributes: []string{
+			fmt.Sprintf("rtpmap:%d H264/90000", format),
+			fmtp,
+			fmt.Sprintf("control:streamid=%d", len(sdp.Medias)),
+		},
+	})
+}
+
+// AddAudio add AAC media from AudioSpecificConfig, see rfc3640 section 4.1
+func (sdp *SessionDescription) AddAudio(format uint8, config []byte) error {
+	parser := aac.NewAACParser(nil)
+	if err := parser.ParseAudioSpecificConfig(config); err != nil {
+		return err
+	}
+	cfg := parser.AudioSpecificConfig()
+	if int(cfg.SamplingFrequencyIndex) >= len(aac.AACSampleRate) {
+		return fmt.Errorf("SDP: invalid aac sampling frequency index %d", cfg.SamplingFrequencyIndex)
+	}
+
+	fmtp := fmt.Sprintf("fmtp:%d profile-level-id=1;mode=AAC-hbr;sizelength=13;indexlength=3;indexdeltalength=3;config=%s",
+		format, strings.ToUpper(hex.EncodeToString(config)))
+	sdp.Medias = append(sdp.Medias, &MediaDescription{
+		Type:   "audio",
+		Port:   0,
+		Proto:  "RTP/AVP",
+		Format: format,
+		Attributes: []string{
+			fmt.Sprintf("rtpmap:%d MPEG4-GENERIC/%d/%d", format, aac.AACSampleRate[cfg.SamplingFrequencyIndex], cfg.ChannelConfiguration),
+			fmtp,
+			fmt.Sprintf("control:streamid=%d", len(sdp.Medias)),
+		},
+	})
+	return nil
+}
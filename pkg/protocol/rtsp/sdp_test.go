@@ -0,0 +1,192 @@
+package rtsp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"gosm/pkg/avformat/avc"
+)
+
+func TestSDP(t *testing.T) {
+	cfg := &avc.AVCDecoderConfigurationRecord{
+		AvcProfileIndication: 0x64,
+		ProfileCompatibility: 0x00,
+		AvcLevelIndication:   0x1F,
+		Sps:                  []byte{0x67, 0x64, 0x00, 0x1F},
+		Pps:                  []byte{0x68, 0xEE, 0x3C, 0x80},
+	}
+	tests := []struct {
+		name     string
+		video    bool
+		audio    []byte // audio specific config, nil if none
+		expected string
+	}{
+		{
+			name:  "h264 & aac",
+			video: true,
+			audio: []byte{0x12, 0x10},
+			expected: "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=live/stream\r\nc=IN IP4 0.0.0.0\r\nt=0 0\r\n" +
+				"a=tool:gosm\r\na=range:npt=0-\r\n" +
+				"m=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\n" +
+				"a=fmtp:96 packetization-mode=1; sprop-parameter-sets=Z2QAHw==,aO48gA==; profile-level-id=64001F\r\n" +
+				"a=control:streamid=0\r\n" +
+				"m=audio 0 RTP/AVP 97\r\na=rtpmap:97 MPEG4-GENERIC/44100/2\r\n" +
+				"a=fmtp:97 profile-level-id=1;mode=AAC-hbr;sizelength=13;indexlength=3;indexdeltalength=3;config=1210\r\n" +
+				"a=control:streamid=1\r\n",
+		},
+		{
+			name:  "aac only",
+			audio: []byte{0x11, 0x88},
+			expected: "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=live/stream\r\nc=IN IP4 0.0.0.0\r\nt=0 0\r\n" +
+				"a=tool:gosm\r\na=range:npt=0-\r\n" +
+				"m=audio 0 RTP/AVP 97\r\na=rtpmap:97 MPEG4-GENERIC/48000/1\r\n" +
+				"a=fmtp:97 profile-level-id=1;mode=AAC-hbr;sizelength=13;indexlength=3;indexdeltalength=3;config=1188\r\n" +
+				"a=control:streamid=0\r\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sdp := NewSDP("live/stream")
+			if test.video {
+				sdp.AddVideo(96, cfg)
+			}
+			if test.audio != nil {
+				if err := sdp.AddAudio(97, test.audio); err != nil {
+					t.Fatalf("error: %v", err)
+				}
+			}
+			if string(sdp.Bytes()) != test.expected {
+				t.Fatalf("sdp %q, expected %q", sdp.Bytes(), test.expected)
+			}
+
+			// parsed back as announced
+			parsed, err := ParseSDP(sdp.Bytes())
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if !reflect.DeepEqual(parsed, sdp) {
+				t.Fatalf("parsed %+v, expected %+v", parsed, sdp)
+			}
+			for _, media := range parsed.Medias {
+				switch media.Type {
+				case "video":
+					if sps, pps := media.ParameterSets(); !bytes.Equal(sps, cfg.Sps) || !bytes.Equal(pps, cfg.Pps) {
+						t.Fatalf("sps %x pps %x, expected %x %x", sps, pps, cfg.Sps, cfg.Pps)
+					}
+				case "audio":
+					if config := media.AudioSpecificConfig(); !bytes.Equal(config, test.audio) {
+						t.Fatalf("config %x, expected %x", config, test.audio)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAddAudioInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config []byte
+	}{
+		{name: "too short", config: []byte{0x12}},
+		{name: "explicit sampling frequency", config: []byte{0x17, 0x90}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sdp := NewSDP("live/stream")
+			if err := sdp.AddAudio(97, test.config); err == nil || len(sdp.Medias) != 0 {
+				t.Fatalf("medias %d, error %v, expected error", len(sdp.Medias), err)
+			}
+		})
+	}
+}
+
+func TestParseSDP(t *testing.T) {
+	announced := "v=0\n" +
+		"o=- 0 0 IN IP4 192.168.1.2\n" +
+		"s=Session streamed by encoder\n" +
+		"c=IN IP4 192.168.1.2\n" +
+		"t=0 0\n" +
+		"a=control:*\n" +
+		"m=video 0 RTP/AVP 96\n" +
+		"c=IN IP4 0.0.0.0\n" +
+		"a=rtpmap:96 h264/90000\n" +
+		"a=fmtp:96 packetization-mode=1;sprop-parameter-sets=Z2QAHw==,aO48gA==;Profile-Level-ID=64001F\n" +
+		"a=control:trackID=1\n" +
+		"m=audio 0/2 RTP/AVP 97\n" +
+		"a=rtpmap:97 MPEG4-GENERIC/44100\n" +
+		"a=fmtp:97 streamtype=5; mode=AAC-hbr; config=1210\n" +
+		"a=control:trackID=2\n"
+
+	sdp, err := ParseSDP([]byte(announced))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if sdp.Connection != "IN IP4 192.168.1.2" || len(sdp.Attributes) != 1 || len(sdp.Medias) != 2 {
+		t.Fatalf("sdp %+v, expected session connection, 1 attribute & 2 medias", sdp)
+	}
+
+	tests := []struct {
+		name      string
+		media     *MediaDescription
+		format    uint8
+		control   string
+		codec     string
+		clockRate int
+		channels  int
+		fmtp      map[string]string
+	}{
+		{
+			name:      "video",
+			media:     sdp.Medias[0],
+			format:    96,
+			control:   "trackID=1",
+			codec:     "H264",
+			clockRate: 90000,
+			channels:  1,
+			fmtp:      map[string]string{"packetization-mode": "1", "sprop-parameter-sets": "Z2QAHw==,aO48gA==", "profile-level-id": "64001F"},
+		},
+		{
+			name:      "audio",
+			media:     sdp.Medias[1],
+			format:    97,
+			control:   "trackID=2",
+			codec:     "MPEG4-GENERIC",
+			clockRate: 44100,
+			channels:  1,
+			fmtp:      map[string]string{"streamtype": "5", "mode": "AAC-hbr", "config": "1210"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.media.Format != test.format || test.media.Control() != test.control {
+				t.Fatalf("format %d control %s, expected %d %s", test.media.Format, test.media.Control(), test.format, test.control)
+			}
+			if codec, clockRate, channels := test.media.RTPMap(); codec != test.codec || clockRate != test.clockRate || channels != test.channels {
+				t.Fatalf("rtpmap %s/%d/%d, expected %s/%d/%d", codec, clockRate, channels, test.codec, test.clockRate, test.channels)
+			}
+			if fmtp := test.media.FMTP(); !reflect.DeepEqual(fmtp, test.fmtp) {
+				t.Fatalf("fmtp %v, expected %v", fmtp, test.fmtp)
+			}
+		})
+	}
+}
+
+func TestParseSDPInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		sdp  string
+	}{
+		{name: "short media line", sdp: "v=0\r\nm=video 0 RTP/AVP\r\n"},
+		{name: "malformed port", sdp: "v=0\r\nm=video x RTP/AVP 96\r\n"},
+		{name: "malformed format", sdp: "v=0\r\nm=video 0 RTP/AVP h264\r\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if sdp, err := ParseSDP([]byte(test.sdp)); err == nil {
+				t.Fatalf("sdp %+v, expected error", sdp)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package rtsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"gosm/pkg/avformat"
+	"gosm/pkg/config"
+	"gosm/pkg/log"
+	"gosm/pkg/protocol/rtsp/udp"
+)
+
+type Observer interface {
+	OnRTSPDescribe(stream *NetStream) (video *avformat.AVPacket, audio *avformat.AVPacket, err error)
+	OnRTSPPublish(stream *NetStream) error
+	OnRTSPUnPublish(stream *NetStream) error
+	OnRTSPSubscribe(stream *NetStream) error
+	OnRTSPUnSubscribe(stream *NetStream) error
+}
+
+type Server struct {
+	ctx      context.Context
+	network  string
+	address  string
+	listener net.Listener
+	obs      Observer
+
+	mu       sync.Mutex
+	portMin  int // rtp port range for udp transport
+	portMax  int
+	nextPort int
+}
+
+// NewServer .
+func NewServer(network string, address string) (*Server, func(), error) {
+	portMin := config.Global.RTSP.RTPPortMin &^ 1 // even
+	portMax := config.Global.RTSP.RTPPortMax
+	if portMin <= 0 || portMax <= portMin {
+		return nil, nil, fmt.Errorf("RTSP: invalid rtp port range [%d, %d]", portMin, portMax)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &Server{
+		ctx:      ctx,
+		network:  network,
+		address:  address,
+		listener: nil,
+		obs:      nil,
+		portMin:  portMin,
+		portMax:  portMax,
+		nextPort: portMin,
+	}
+
+	closeFunc := func() {
+		defer cancel()
+		if err := server.listener.Close(); err != nil {
+			log.Error("%v", err)
+		}
+	}
+
+	return server, closeFunc, nil
+}
+
+// SetObserver .
+func (server *Server) SetObserver(obs Observer) {
+	server.obs = obs
+}
+
+// Serve .
+func (server *Server) Serve() {
+	if server.obs == nil {
+		log.Fatal("RTSP: observer is empty")
+	}
+
+	var err error
+	server.listener, err = net.Listen(server.network, server.address)
+	if err != nil {
+		log.Fatal("RTSP: server listen error, %v", err)
+	}
+	log.Info("RTSP: server listen on %s", server.listener.Addr())
+
+	go func() {
+		for {
+			goConn, err := server.listener.Accept()
+			if err != nil {
+				// close server actived
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+
+				log.Error("RTSP: server accept error, %v", err)
+				continue
+			}
+			log.Debug("RTSP: accept remote: %s, local: %s", goConn.RemoteAddr(), goConn.LocalAddr())
+			if err := server.handleConn(goConn); err != nil {
+				log.Error("%v", err)
+			}
+		}
+	}()
+}
+
+// handleConn .
+func (server *Server) handleConn(goConn net.Conn) error {
+	rtspConn := NewNetConn(server, goConn)
+	return rtspConn.Serve()
+}
+
+// newUDPSession listen rtp/rtcp on next available port pair for receiving
+func (server *Server) newUDPSession() (*udp.Session, error) {
+	var session *udp.Session
+	err := server.allocPort(func(port int) (err error) {
+		session, err = udp.NewSession(strconv.Itoa(port))
+		return err
+	})
+	return session, err
+}
+
+// newUDPConnPair listen rtp/rtcp on next available port pair for sending
+func (server *Server) newUDPConnPair() (*net.UDPConn, *net.UDPConn, error) {
+	var rtpConn, rtcpConn *net.UDPConn
+	err := server.allocPort(func(port int) (err error) {
+		if rtpConn, err = net.ListenUDP("udp", &net.UDPAddr{Port: port}); err != nil {
+			return err
+		}
+		if rtcpConn, err = net.ListenUDP("udp", &net.UDPAddr{Port: port + 1}); err != nil {
+			rtpConn.Close()
+			return err
+		}
+		return nil
+	})
+	return rtpConn, rtcpConn, err
+}
+
+// allocPort try listen on next even port within range until success
+func (server *Server) allocPort(listen func(port int) error) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	for tries := (server.portMax-server.portMin)/2 + 1; tries > 0; tries-- {
+		port := server.nextPort
+		server.nextPort += 2
+		if server.nextPort+1 > server.portMax {
+			server.nextPort = server.portMin
+		}
+
+		if err := listen(port); err != nil {
+			log.Debug("RTSP: rtp port %d unavailable, %v", port, err)
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("RTSP: no available rtp port within [%d, %d]", server.portMin, server.portMax)
+}
@@ -0,0 +1,115 @@
+package rtsp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lower transports
+const (
+	ProtocolUDP = "RTP/AVP/UDP"
+	ProtocolTCP = "RTP/AVP/TCP"
+)
+
+// Transport rtsp header 'Transport', see rfc2326 section 12.39
+//
+//	Transport: RTP/AVP;unicast;client_port=5000-5001;mode=record
+//	Transport: RTP/AVP/TCP;unicast;interleaved=0-1;mode=record
+type Transport struct {
+	Protocol    string // RTP/AVP, RTP/AVP/UDP or RTP/AVP/TCP
+	Unicast     bool
+	Mode        string
+	ClientPort  [2]int // rtp & rtcp port of client
+	ServerPort  [2]int // rtp & rtcp port of server
+	Interleaved [2]int // rtp & rtcp channel over rtsp connection, -1 if not specified
+}
+
+// ParseTransport parse first supported transport spec
+func ParseTransport(header string) (*Transport, error) {
+	for _, spec := range strings.Split(header, ",") {
+		params := strings.Split(strings.TrimSpace(spec), ";")
+
+		transport := &Transport{Protocol: params[0], Mode: ModePlay, Interleaved: [2]int{-1, -1}}
+		switch transport.Protocol {
+		case "RTP/AVP", ProtocolUDP:
+		case ProtocolTCP:
+			transport.Unicast = true
+		default:
+			continue
+		}
+
+		for _, param := range params[1:] {
+			kv := strings.SplitN(param, "=", 2)
+			switch strings.ToLower(kv[0]) {
+			case "unicast":
+				transport.Unicast = true
+			case "multicast":
+				transport.Unicast = false
+			case "mode":
+				if len(kv) == 2 {
+					transport.Mode = strings.ToLower(strings.Trim(kv[1], "\""))
+				}
+			case "client_port":
+				if len(kv) == 2 {
+					ports, err := parsePortRange(kv[1])
+					if err != nil {
+						return nil, err
+					}
+					transport.ClientPort = ports
+				}
+			case "interleaved":
+				if len(kv) == 2 {
+					channels, err := parsePortRange(kv[1])
+					if err != nil || channels[0] > 0xFF || channels[1] > 0xFF {
+						return nil, fmt.Errorf("RTSP: invalid interleaved channels '%s'", kv[1])
+					}
+					transport.Interleaved = channels
+				}
+			}
+		}
+
+		if !transport.Unicast {
+			continue
+		}
+		return transport, nil
+	}
+	return nil, fmt.Errorf("RTSP: no supported transport in '%s'", header)
+}
+
+// IsInterleaved whether rtp/rtcp over rtsp connection
+func (transport *Transport) IsInterleaved() bool {
+	return transport.Protocol == ProtocolTCP
+}
+
+// String marshal transport as response header
+func (transport *Transport) String() string {
+	s := transport.Protocol + ";unicast"
+	if transport.IsInterleaved() {
+		s += fmt.Sprintf(";interleaved=%d-%d", transport.Interleaved[0], transport.Interleaved[1])
+	}
+	if transport.ClientPort[0] != 0 {
+		s += fmt.Sprintf(";client_port=%d-%d", transport.ClientPort[0], transport.ClientPort[1])
+	}
+	if transport.ServerPort[0] != 0 {
+		s += fmt.Sprintf(";server_port=%d-%d", transport.ServerPort[0], transport.ServerPort[1])
+	}
+	return s + ";mode=" + transport.Mode
+}
+
+// port range: rtp-rtcp, rtcp = rtp + 1 if omitted
+func parsePortRange(s string) ([2]int, error) {
+	var ports [2]int
+	parts := strings.SplitN(s, "-", 2)
+	rtp, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return ports, fmt.Errorf("RTSP: invalid port range '%s'", s)
+	}
+	ports[0], ports[1] = rtp, rtp+1
+	if len(parts) == 2 {
+		if ports[1], err = strconv.Atoi(parts[1]); err != nil {
+			return ports, fmt.Errorf("RTSP: invalid port range '%s'", s)
+		}
+	}
+	return ports, nil
+}
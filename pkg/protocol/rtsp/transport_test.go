@@ -0,0 +1,82 @@
+package rtsp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		transport Transport
+		str       string // marshaled as response header, server port 6000 if udp
+	}{
+		{
+			name:      "udp",
+			header:    "RTP/AVP;unicast;client_port=5000-5001",
+			transport: Transport{Protocol: "RTP/AVP", Unicast: true, Mode: ModePlay, ClientPort: [2]int{5000, 5001}, Interleaved: [2]int{-1, -1}},
+			str:       "RTP/AVP;unicast;client_port=5000-5001;server_port=6000-6001;mode=play",
+		},
+		{
+			name:      "udp rtcp port omitted",
+			header:    "RTP/AVP/UDP;unicast;client_port=5000;mode=\"RECORD\"",
+			transport: Transport{Protocol: ProtocolUDP, Unicast: true, Mode: ModeRecord, ClientPort: [2]int{5000, 5001}, Interleaved: [2]int{-1, -1}},
+			str:       "RTP/AVP/UDP;unicast;client_port=5000-5001;server_port=6000-6001;mode=record",
+		},
+		{
+			name:      "interleaved",
+			header:    "RTP/AVP/TCP;unicast;interleaved=2-3;mode=record",
+			transport: Transport{Protocol: ProtocolTCP, Unicast: true, Mode: ModeRecord, Interleaved: [2]int{2, 3}},
+			str:       "RTP/AVP/TCP;unicast;interleaved=2-3;mode=record",
+		},
+		{
+			name:      "first supported spec",
+			header:    "RTP/SAVP;unicast;client_port=4000-4001, RTP/AVP;multicast;port=3456-3457, RTP/AVP/TCP;unicast;interleaved=0-1",
+			transport: Transport{Protocol: ProtocolTCP, Unicast: true, Mode: ModePlay, Interleaved: [2]int{0, 1}},
+			str:       "RTP/AVP/TCP;unicast;interleaved=0-1;mode=play",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport, err := ParseTransport(test.header)
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if !reflect.DeepEqual(*transport, test.transport) {
+				t.Fatalf("transport %+v, expected %+v", *transport, test.transport)
+			}
+			if transport.IsInterleaved() != (test.transport.Protocol == ProtocolTCP) {
+				t.Fatalf("interleaved %v of protocol %s", transport.IsInterleaved(), transport.Protocol)
+			}
+			if !transport.IsInterleaved() {
+				transport.ServerPort = [2]int{6000, 6001}
+			}
+			if s := transport.String(); s != test.str {
+				t.Fatalf("transport header %s, expected %s", s, test.str)
+			}
+		})
+	}
+}
+
+func TestParseTransportInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "empty", header: ""},
+		{name: "unsupported profile", header: "RTP/SAVP;unicast;client_port=5000-5001"},
+		{name: "multicast only", header: "RTP/AVP;multicast;destination=224.2.0.1;port=3456-3457"},
+		{name: "invalid client port", header: "RTP/AVP;unicast;client_port=x-5001"},
+		{name: "invalid rtcp port", header: "RTP/AVP;unicast;client_port=5000-x"},
+		{name: "invalid channel", header: "RTP/AVP/TCP;unicast;interleaved=a-b"},
+		{name: "channel out of range", header: "RTP/AVP/TCP;unicast;interleaved=255"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if transport, err := ParseTransport(test.header); err == nil {
+				t.Fatalf("transport %+v, expected error", transport)
+			}
+		})
+	}
+}
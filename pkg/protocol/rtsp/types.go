@@ -0,0 +1,67 @@
+package rtsp
+
+const Version = "RTSP/1.0"
+
+// RTSP Methods, see rfc2326 section 10
+const (
+	MethodOptions      = "OPTIONS"
+	MethodDescribe     = "DESCRIBE"
+	MethodAnnounce     = "ANNOUNCE"
+	MethodSetup        = "SETUP"
+	MethodPlay         = "PLAY"
+	MethodPause        = "PAUSE"
+	MethodRecord       = "RECORD"
+	MethodTeardown     = "TEARDOWN"
+	MethodGetParameter = "GET_PARAMETER"
+	MethodSetParameter = "SET_PARAMETER"
+)
+
+// RTSP Status Codes, see rfc2326 section 7.1.1
+const (
+	StatusOK                          = 200
+	StatusBadRequest                  = 400
+	StatusForbidden                   = 403
+	StatusNotFound                    = 404
+	StatusMethodNotAllowed            = 405
+	StatusUnsupportedMediaType        = 415
+	StatusSessionNotFound             = 454
+	StatusMethodNotValidInThisState   = 455
+	StatusUnsupportedTransport        = 461
+	StatusInternalServerError         = 500
+	StatusNotImplemented              = 501
+	StatusRTSPVersionNotSupported     = 505
+	StatusOptionNotSupported          = 551
+	StatusAggregateOperationNotAllowd = 459
+)
+
+// StatusText reason phrase of status code
+var StatusText = map[int]string{
+	StatusOK:                          "OK",
+	StatusBadRequest:                  "Bad Request",
+	StatusForbidden:                   "Forbidden",
+	StatusNotFound:                    "Not Found",
+	StatusMethodNotAllowed:            "Method Not Allowed",
+	StatusUnsupportedMediaType:        "Unsupported Media Type",
+	StatusSessionNotFound:             "Session Not Found",
+	StatusMethodNotValidInThisState:   "Method Not Valid in This State",
+	StatusUnsupportedTransport:        "Unsupported Transport",
+	StatusInternalServerError:         "Internal Server Error",
+	StatusNotImplemented:              "Not Implemented",
+	StatusRTSPVersionNotSupported:     "RTSP Version Not Supported",
+	StatusOptionNotSupported:          "Option not supported",
+	StatusAggregateOperationNotAllowd: "Aggregate Operation Not Allowed",
+}
+
+// Stream Mode
+const (
+	ModePlay   = "play"
+	ModeRecord = "record"
+)
+
+// Session State, see rfc2326 Appendix A.2
+const (
+	StateInit = iota + 1
+	StateReady
+	StatePlaying
+	StateRecording
+)
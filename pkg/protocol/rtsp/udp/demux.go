@@ -0,0 +1,98 @@
+package udp
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// demuxConn per-session packet conn fed by server's shared socket,
+// writing back to the session's source through the shared socket
+type demuxConn struct {
+	goConn    *net.UDPConn // shared socket
+	remote    net.Addr     // latest source address
+	mu        sync.Mutex
+	queue     chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newDemuxConn(goConn *net.UDPConn) *demuxConn {
+	return &demuxConn{
+		goConn: goConn,
+		remote: nil,
+		queue:  make(chan []byte, 512),
+		done:   make(chan struct{}),
+	}
+}
+
+// push packet from shared socket, drop if session is too slow
+func (conn *demuxConn) push(data []byte, addr net.Addr) bool {
+	conn.mu.Lock()
+	conn.remote = addr
+	conn.mu.Unlock()
+
+	select {
+	case <-conn.done:
+		return false
+	case conn.queue <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadFrom .
+func (conn *demuxConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case <-conn.done:
+		return 0, nil, net.ErrClosed
+	case data := <-conn.queue:
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		return copy(p, data), conn.remote, nil
+	}
+}
+
+// WriteTo write to addr, or the latest source address if addr is nil
+func (conn *demuxConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-conn.done:
+		return 0, net.ErrClosed
+	default:
+	}
+	if addr == nil {
+		conn.mu.Lock()
+		addr = conn.remote
+		conn.mu.Unlock()
+	}
+	return conn.goConn.WriteTo(p, addr)
+}
+
+// Close close session's conn only, the shared socket is owned by server
+func (conn *demuxConn) Close() error {
+	conn.closeOnce.Do(func() {
+		close(conn.done)
+	})
+	return nil
+}
+
+// LocalAddr .
+func (conn *demuxConn) LocalAddr() net.Addr {
+	return conn.goConn.LocalAddr()
+}
+
+// SetDeadline not supported
+func (conn *demuxConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// SetReadDeadline not supported
+func (conn *demuxConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline not supported
+func (conn *demuxConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,106 @@
+package udp
+
+import (
+	"time"
+
+	"gosm/pkg/protocol/rtsp/rtcp"
+	"gosm/pkg/protocol/rtsp/rtp"
+)
+
+// receiver reception statistics of one rtp source for report block, see rfc3550 appendix A.3 & A.8
+type receiver struct {
+	ssrc          uint32
+	clockRate     uint32
+	started       bool
+	start         time.Time // arrival reference of the first packet
+	baseSeq       uint32    // first sequence number
+	maxSeq        uint16    // highest sequence number
+	cycles        uint32    // sequence number wraparound count, shifted by 16
+	received      uint32
+	expectedPrior uint32 // expected packets at last report
+	receivedPrior uint32 // received packets at last report
+	transit       int32  // relative transit time of last packet
+	jitter        float64
+	lsr           uint32    // middle 32 bits of last SR ntp timestamp
+	lsrTime       time.Time // arrival time of last SR
+}
+
+func newReceiver(clockRate uint32) *receiver {
+	return &receiver{clockRate: clockRate}
+}
+
+// update statistics by packet in arrival order
+func (r *receiver) update(packet *rtp.Packet, now time.Time) {
+	sn := packet.SequenceNumber()
+	if !r.started {
+		r.started = true
+		r.ssrc = packet.SSRC()
+		r.start = now
+		r.baseSeq = uint32(sn)
+		r.maxSeq = sn
+	} else if delta := sn - r.maxSeq; delta != 0 && delta < 0x8000 {
+		if sn < r.maxSeq {
+			r.cycles += 1 << 16
+		}
+		r.maxSeq = sn
+	}
+	r.received++
+
+	// interarrival jitter in timestamp units
+	arrival := uint32(uint64(now.Sub(r.start)) * uint64(r.clockRate) / uint64(time.Second))
+	transit := int32(arrival - packet.Timestamp())
+	if r.received > 1 {
+		d := float64(transit - r.transit)
+		if d < 0 {
+			d = -d
+		}
+		r.jitter += (d - r.jitter) / 16
+	}
+	r.transit = transit
+}
+
+// onSR record last sender report for LSR & DLSR
+func (r *receiver) onSR(sr *rtcp.SenderReport, now time.Time) {
+	r.lsr = sr.MiddleNTP()
+	r.lsrTime = now
+}
+
+// report generate report block since last report
+func (r *receiver) report(now time.Time) *rtcp.ReportBlock {
+	extMax := r.cycles + uint32(r.maxSeq)
+	expected := extMax - r.baseSeq + 1
+
+	// cumulative lost, 24 bits
+	lost := int64(expected) - int64(r.received)
+	if lost < 0 {
+		lost = 0
+	}
+	if lost > 0x7FFFFF {
+		lost = 0x7FFFFF
+	}
+
+	// fraction lost since last report, fixed point with binary point at left edge
+	expectedInterval := expected - r.expectedPrior
+	receivedInterval := r.received - r.receivedPrior
+	r.expectedPrior, r.receivedPrior = expected, r.received
+	fraction := uint8(0)
+	if lostInterval := int64(expectedInterval) - int64(receivedInterval); expectedInterval != 0 && lostInterval > 0 {
+		fraction = uint8(lostInterval << 8 / int64(expectedInterval))
+	}
+
+	// delay since last SR, in units of 1/65536 seconds
+	dlsr := uint32(0)
+	if !r.lsrTime.IsZero() {
+		dlsr = uint32(now.Sub(r.lsrTime).Seconds() * 65536)
+	}
+
+	return &rtcp.ReportBlock{
+		SSRC:     r.ssrc,
+		Fraction: fraction,
+		Lost:     uint32(lost),
+		SN:       extMax,
+		Jitter:   uint32(r.jitter),
+		LSR:      r.lsr,
+		DLSR:     dlsr,
+	}
+}
@@ -0,0 +1,94 @@
+package udp
+
+import (
+	"testing"
+	"time"
+
+	"gosm/pkg/protocol/rtsp/rtp"
+)
+
+// seqs sequence numbers from first to last in order, skipped ones excluded
+func seqs(first uint16, last uint16, skipped ...uint16) []uint16 {
+	sns := make([]uint16, 0)
+	for sn := first; ; sn++ {
+		excluded := false
+		for _, skip := range skipped {
+			excluded = excluded || skip == sn
+		}
+		if !excluded {
+			sns = append(sns, sn)
+		}
+		if sn == last {
+			return sns
+		}
+	}
+}
+
+func TestReceiverReport(t *testing.T) {
+	type report struct {
+		received []uint16 // sequence numbers received since the last report
+		fraction uint8    // lost since the last report, in 1/256
+		lost     uint32   // cumulative lost
+		sn       uint32   // extended highest sequence number
+	}
+	tests := []struct {
+		name    string
+		reports []report
+	}{
+		{
+			name: "no loss",
+			reports: []report{
+				{received: seqs(1, 10), fraction: 0, lost: 0, sn: 10},
+			},
+		},
+		{
+			name: "loss",
+			reports: []report{
+				{received: seqs(1, 10, 3, 4), fraction: 2 * 256 / 10, lost: 2, sn: 10},
+			},
+		},
+		{
+			name: "loss across wrap",
+			reports: []report{
+				{received: seqs(65530, 3, 65533), fraction: 256 / 10, lost: 1, sn: 1<<16 | 3},
+			},
+		},
+		{
+			name: "fraction of interval, lost cumulative",
+			reports: []report{
+				{received: seqs(1, 10, 3, 4), fraction: 2 * 256 / 10, lost: 2, sn: 10},
+				{received: seqs(11, 20), fraction: 0, lost: 2, sn: 20},
+				{received: seqs(21, 30, 25), fraction: 256 / 10, lost: 3, sn: 30},
+			},
+		},
+		{
+			name: "duplicates never negative",
+			reports: []report{
+				{received: []uint16{1, 2, 2, 3, 3, 3}, fraction: 0, lost: 0, sn: 3},
+			},
+		},
+		{
+			name: "late packet recovers",
+			reports: []report{
+				{received: []uint16{1, 2, 4, 5}, fraction: 256 / 5, lost: 1, sn: 5},
+				{received: []uint16{3, 6}, fraction: 0, lost: 0, sn: 6},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recv := newReceiver(VideoClockRate)
+			now := time.Now()
+			for idx, expected := range test.reports {
+				for _, sn := range expected.received {
+					recv.update(rtp.NewPacket(rtp.PacketTypeAVC, sn, 0, 1111, false, nil), now)
+				}
+				block := recv.report(now)
+				if block.SSRC != 1111 || block.Fraction != expected.fraction || block.Lost != expected.lost || block.SN != expected.sn {
+					t.Fatalf("report %d: ssrc %d, fraction %d, lost %d, sn %d, expected fraction %d, lost %d, sn %d", idx,
+						block.SSRC, block.Fraction, block.Lost, block.SN, expected.fraction, expected.lost, expected.sn)
+				}
+			}
+		})
+	}
+}
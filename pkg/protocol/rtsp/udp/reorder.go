@@ -0,0 +1,82 @@
+package udp
+
+// MaxReorderFrames max frames reordered by b-frames, see max_num_reorder_frames of sps
+const MaxReorderFrames = 16
+
+// dtsReorder derive decoding timestamps from presentation timestamps in decoding order,
+// with at most depth frames reordered, the n-th smallest pts is the dts of frame n + depth
+type dtsReorder struct {
+	depth   int     // reorder frames
+	fixed   bool    // depth from sps, otherwise grown as reordering observed
+	window  []int64 // pts not taken as dts yet, in ascending order
+	recent  []int64 // pts of recent frames in decoding order
+	lastDTS int64
+	started bool
+}
+
+func newDTSReorder() *dtsReorder {
+	return &dtsReorder{
+		depth:   0,
+		fixed:   false,
+		window:  make([]int64, 0, MaxReorderFrames+1),
+		recent:  make([]int64, 0, MaxReorderFrames),
+		lastDTS: 0,
+		started: false,
+	}
+}
+
+// setDepth fix reorder depth, ex. parsed from sps
+func (r *dtsReorder) setDepth(depth int) {
+	if depth > MaxReorderFrames {
+		depth = MaxReorderFrames
+	}
+	r.depth = depth
+	r.fixed = true
+}
+
+// dts of frame in decoding order, strictly increasing
+func (r *dtsReorder) dts(pts int64, keyframe bool) int64 {
+	if keyframe {
+		r.window = r.window[:0]
+	}
+	if !r.fixed {
+		r.observe(pts)
+	}
+
+	// insert pts in ascending order, take the smallest once depth frames pending
+	idx := len(r.window)
+	for idx > 0 && r.window[idx-1] > pts {
+		idx--
+	}
+	r.window = append(r.window, 0)
+	copy(r.window[idx+1:], r.window[idx:])
+	r.window[idx] = pts
+	dts := r.window[0]
+	if len(r.window) > r.depth {
+		r.window = r.window[1:]
+	}
+
+	if r.started && dts <= r.lastDTS {
+		dts = r.lastDTS + 1
+	}
+	r.lastDTS = dts
+	r.started = true
+	return dts
+}
+
+// observe grow depth by frames decoded before but presented after pts
+func (r *dtsReorder) observe(pts int64) {
+	later := 0
+	for _, prev := range r.recent {
+		if prev > pts {
+			later++
+		}
+	}
+	if later > r.depth {
+		r.depth = later
+	}
+	if len(r.recent) == MaxReorderFrames {
+		r.recent = r.recent[1:]
+	}
+	r.recent = append(r.recent, pts)
+}
@@ -0,0 +1,84 @@
+package udp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDTSReorder(t *testing.T) {
+	tests := []struct {
+		name  string
+		depth int     // reorder frames of sps, -1 if unknown
+		pts   []int64 // presentation timestamps in decoding order, keyframe if multiple of 1000
+		dts   []int64
+		grown int // depth at last
+	}{
+		{
+			name:  "no b-frames",
+			depth: 0,
+			pts:   []int64{0, 40, 80, 120},
+			dts:   []int64{0, 40, 80, 120},
+			grown: 0,
+		},
+		{
+			// display I0 B1 B2 P3 B4 B5 P6, decoded I0 P3 B1 B2 P6 B4 B5
+			name:  "IBBP",
+			depth: 1,
+			pts:   []int64{0, 120, 40, 80, 240, 160, 200},
+			dts:   []int64{0, 1, 40, 80, 120, 160, 200},
+			grown: 1,
+		},
+		{
+			// reordering observed after the first b-frame
+			name:  "IBBP depth unknown",
+			depth: -1,
+			pts:   []int64{0, 120, 40, 80, 240, 160, 200},
+			dts:   []int64{0, 120, 121, 122, 123, 160, 200},
+			grown: 1,
+		},
+		{
+			// display I0 b1 B2 b3 P4, decoded I0 P4 B2 b1 b3
+			name:  "IbBbP pyramid",
+			depth: 2,
+			pts:   []int64{0, 160, 80, 40, 120, 320, 240, 200, 280},
+			dts:   []int64{0, 1, 2, 40, 80, 120, 160, 200, 240},
+			grown: 2,
+		},
+		{
+			name:  "keyframe flushes pending frames",
+			depth: 1,
+			pts:   []int64{0, 120, 40, 80, 1000, 1120, 1040, 1080},
+			dts:   []int64{0, 1, 40, 80, 1000, 1001, 1040, 1080},
+			grown: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reorder := newDTSReorder()
+			if test.depth >= 0 {
+				reorder.setDepth(test.depth)
+			}
+			dts := make([]int64, 0, len(test.pts))
+			for idx, pts := range test.pts {
+				dts = append(dts, reorder.dts(pts, pts%1000 == 0))
+				if idx > 0 && dts[idx] <= dts[idx-1] {
+					t.Fatalf("dts %v not strictly increasing", dts)
+				}
+			}
+			if !reflect.DeepEqual(dts, test.dts) {
+				t.Fatalf("dts %v, expected %v", dts, test.dts)
+			}
+			if reorder.depth != test.grown {
+				t.Fatalf("depth %d, expected %d", reorder.depth, test.grown)
+			}
+		})
+	}
+}
+
+func TestDTSReorderDepthLimited(t *testing.T) {
+	reorder := newDTSReorder()
+	reorder.setDepth(MaxReorderFrames + 10)
+	if reorder.depth != MaxReorderFrames {
+		t.Fatalf("depth %d, expected %d", reorder.depth, MaxReorderFrames)
+	}
+}
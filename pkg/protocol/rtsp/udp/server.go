@@ -2,15 +2,62 @@ package udp
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gosm/pkg/config"
 	"gosm/pkg/log"
+	"gosm/pkg/protocol/rtsp/rtp"
 )
 
-// Server .
+// DefaultStreamName default stream name rule of rtp sessions
+const DefaultStreamName = "rtp_{ssrc}"
+
+// BlockInterval duration packets of a source ignored after its publishing rejected or closed by observer,
+// ex. kicked or replaced, rather than republished by its next packet
+const BlockInterval = 10 * time.Second
+
+// errBlocked packets of source ignored for a while
+var errBlocked = errors.New("UDP: source is blocked")
+
+// Observer .
+type Observer interface {
+	OnUDPPublish(name string, session *Session) error
+	OnUDPUnPublish(name string, session *Session) error
+}
+
+// Server listen on rtp/rtcp port pairs, demultiplex packets into sessions by sender,
+// video & audio ssrc of one sender grouped into one session:
+//
+//	ssrc mapped by ssrc_map   grouped by stream name mapped
+//	others                    grouped by source ip:port & local rtp port
 type Server struct {
 	ctx       context.Context
 	network   string
-	addresses []string
-	sessions  []*Session
+	addresses []string // rtp ports, rtcp port = rtp port + 1
+	conns     []*net.UDPConn
+	obs       Observer
+
+	mu       sync.Mutex
+	sessions map[string]*serverSession // group key <=> session
+	sources  map[string]*serverSession // ip/ssrc <=> session, rtcp dispatched by sender ssrc
+	blocked  map[string]time.Time      // group key <=> until, packets ignored
+}
+
+// serverSession session demultiplexed from shared sockets
+type serverSession struct {
+	key     string
+	name    string
+	sources []string // ip/ssrc of the session
+	session *Session
+	rtp     *demuxConn
+	rtcp    *demuxConn
+	active  time.Time // last packet received
 }
 
 // NewServer .
@@ -20,15 +67,290 @@ func NewServer(network string, addresses ...string) (*Server, func(), error) {
 		ctx:       ctx,
 		network:   network,
 		addresses: addresses,
-		sessions:  make([]*Session, 0),
+		conns:     make([]*net.UDPConn, 0),
+		obs:       nil,
+		sessions:  make(map[string]*serverSession),
+		sources:   make(map[string]*serverSession),
+		blocked:   make(map[string]time.Time),
 	}
 	closeFunc := func() {
 		defer cancel()
-		for _, session := range server.sessions {
-			if err := session.Close(); err != nil {
+		for _, conn := range server.conns {
+			if err := conn.Close(); err != nil {
 				log.Error("%v", err)
 			}
 		}
+		server.mu.Lock()
+		sessions := make([]*serverSession, 0, len(server.sessions))
+		for _, ss := range server.sessions {
+			sessions = append(sessions, ss)
+		}
+		server.mu.Unlock()
+		for _, ss := range sessions {
+			server.remove(ss)
+		}
 	}
 	return server, closeFunc, nil
 }
+
+// SetObserver .
+func (server *Server) SetObserver(obs Observer) {
+	server.obs = obs
+}
+
+// Serve .
+func (server *Server) Serve() {
+	if server.obs == nil {
+		log.Fatal("UDP: observer is empty")
+	}
+
+	for _, address := range server.addresses {
+		port, err := strconv.Atoi(address)
+		if err != nil || port%2 == 1 {
+			log.Fatal("UDP: invalid rtp port '%s', only accept even number", address)
+		}
+		rtpConn, err := net.ListenUDP(server.network, &net.UDPAddr{Port: port})
+		if err != nil {
+			log.Fatal("UDP: listen rtp port error, %v", err)
+		}
+		rtcpConn, err := net.ListenUDP(server.network, &net.UDPAddr{Port: port + 1})
+		if err != nil {
+			log.Fatal("UDP: listen rtcp port error, %v", err)
+		}
+		server.conns = append(server.conns, rtpConn, rtcpConn)
+		log.Info("UDP: server listen rtp on %s, rtcp on %s", rtpConn.LocalAddr(), rtcpConn.LocalAddr())
+
+		go server.serveRTP(port, rtpConn, rtcpConn)
+		go server.serveRTCP(rtcpConn)
+	}
+
+	if timeout := config.Global.RTP.ReadTimeout; timeout > 0 {
+		go server.reap(time.Duration(timeout) * time.Second)
+	}
+}
+
+// loop to read rtp packets, create session for new source ip & ssrc
+func (server *Server) serveRTP(port int, rtpConn, rtcpConn *net.UDPConn) {
+	buf := make([]byte, rtp.MaxPacketSize)
+	for {
+		n, addr, err := rtpConn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Error("UDP: read rtp error, %v", err)
+			continue
+		}
+		if n < rtp.RTPHeaderLength {
+			continue
+		}
+		data := make([]byte, n)
+		copy(data, buf[:n])
+
+		ssrc := binary.BigEndian.Uint32(data[8:])
+		ss, err := server.loadOrCreate(addr.(*net.UDPAddr), port, ssrc, rtpConn, rtcpConn)
+		if err != nil {
+			if !errors.Is(err, errBlocked) {
+				log.Error("%v", err)
+			}
+			continue
+		}
+		if !ss.rtp.push(data, addr) {
+			log.Debug("UDP: session '%s' rtp buffer is full, packet dropped", ss.name)
+		}
+	}
+}
+
+// loop to read rtcp packets, dispatch to existing session only
+func (server *Server) serveRTCP(rtcpConn *net.UDPConn) {
+	buf := make([]byte, rtp.MaxPacketSize)
+	for {
+		n, addr, err := rtcpConn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Error("UDP: read rtcp error, %v", err)
+			continue
+		}
+		if n < 8 {
+			continue
+		}
+		data := make([]byte, n)
+		copy(data, buf[:n])
+
+		ssrc := binary.BigEndian.Uint32(data[4:]) // sender ssrc
+		server.mu.Lock()
+		ss, ok := server.sources[sourceKey(addr.(*net.UDPAddr).IP, ssrc)]
+		server.mu.Unlock()
+		if ok {
+			ss.rtcp.push(data, addr)
+		}
+	}
+}
+
+// find session by source ip & ssrc, or the session of its sender joined, create and publish if not exist
+func (server *Server) loadOrCreate(src *net.UDPAddr, port int, ssrc uint32, rtpConn, rtcpConn *net.UDPConn) (*serverSession, error) {
+	ip := src.IP
+	source := sourceKey(ip, ssrc)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if ss, ok := server.sources[source]; ok {
+		ss.active = time.Now()
+		return ss, nil
+	}
+
+	name, mapped := mappedName(ssrc)
+	key := groupKey(src, port, name, mapped)
+	if until, ok := server.blocked[key]; ok {
+		if time.Now().Before(until) {
+			return nil, errBlocked
+		}
+		delete(server.blocked, key)
+	}
+
+	// another ssrc of the sender, ex. audio joins video
+	if ss, ok := server.sessions[key]; ok {
+		ss.active = time.Now()
+		ss.sources = append(ss.sources, source)
+		server.sources[source] = ss
+		log.Info("UDP: session stream '%s' joined by ssrc: %d from %s", ss.name, ssrc, src)
+		return ss, nil
+	}
+
+	if !mapped {
+		name = streamName(ip, port, ssrc)
+	}
+	ss := &serverSession{
+		key:     key,
+		name:    name,
+		sources: []string{source},
+		rtp:     newDemuxConn(rtpConn),
+		rtcp:    newDemuxConn(rtcpConn),
+		active:  time.Now(),
+	}
+	// rtcp replies go to rtp port + 1 of the source until its rtcp arrives
+	ss.rtcp.remote = &net.UDPAddr{IP: src.IP, Port: src.Port + 1, Zone: src.Zone}
+	ss.session = NewSessionWithConn(ss.rtp, ss.rtcp)
+	ss.session.ssrc = ssrc
+	server.sessions[key] = ss
+	server.sources[source] = ss
+
+	log.Info("UDP: new session from %s, ssrc: %d, stream '%s'", src, ssrc, ss.name)
+	go server.serve(ss)
+	return ss, nil
+}
+
+// serve publishes session off the reading loop until closed,
+// sender blocked for a while if rejected or closed by observer rather than bye or timeout
+func (server *Server) serve(ss *serverSession) {
+	if err := server.obs.OnUDPPublish(ss.name, ss.session); err != nil {
+		log.Error("UDP: publish stream '%s' error, %v", ss.name, err)
+		server.block(ss)
+		server.remove(ss)
+		return
+	}
+	ss.session.Serve()
+	if !ss.session.bye {
+		server.block(ss)
+	}
+	server.remove(ss)
+}
+
+// block ignores packets of session's sender for BlockInterval, unless removed already
+func (server *Server) block(ss *serverSession) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.sessions[ss.key] == ss {
+		server.blocked[ss.key] = time.Now().Add(BlockInterval)
+		log.Info("UDP: session stream '%s' closed, sender blocked for %v", ss.name, BlockInterval)
+	}
+}
+
+// remove session and notify observer, only once
+func (server *Server) remove(ss *serverSession) {
+	server.mu.Lock()
+	if server.sessions[ss.key] != ss {
+		server.mu.Unlock()
+		return
+	}
+	delete(server.sessions, ss.key)
+	for _, source := range ss.sources {
+		delete(server.sources, source)
+	}
+	server.mu.Unlock()
+
+	log.Info("UDP: session stream '%s' closed", ss.name)
+	if err := server.obs.OnUDPUnPublish(ss.name, ss.session); err != nil {
+		log.Error("%v", err)
+	}
+	ss.session.Close()
+}
+
+// loop to close sessions without packets over timeout
+func (server *Server) reap(timeout time.Duration) {
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-server.ctx.Done():
+			return
+		case now := <-ticker.C:
+			idles := make([]*serverSession, 0)
+			server.mu.Lock()
+			for _, ss := range server.sessions {
+				if now.Sub(ss.active) > timeout {
+					idles = append(idles, ss)
+				}
+			}
+			for key, until := range server.blocked {
+				if now.After(until) {
+					delete(server.blocked, key)
+				}
+			}
+			server.mu.Unlock()
+			for _, ss := range idles {
+				log.Debug("UDP: session stream '%s' idle timeout", ss.name)
+				server.remove(ss)
+			}
+		}
+	}
+}
+
+// sourceKey ip/ssrc of one rtp source
+func sourceKey(ip net.IP, ssrc uint32) string {
+	return ip.String() + "/" + strconv.FormatUint(uint64(ssrc), 10)
+}
+
+// groupKey sessions key of sender, by stream name mapped or source ip:port & local rtp port
+func groupKey(src *net.UDPAddr, port int, name string, mapped bool) string {
+	if mapped {
+		return "name/" + name
+	}
+	return src.String() + "/" + strconv.Itoa(port)
+}
+
+// mappedName stream name of ssrc by explicit ssrc mapping
+func mappedName(ssrc uint32) (string, bool) {
+	name, ok := config.Global.RTP.SSRCMap[strconv.FormatUint(uint64(ssrc), 10)]
+	return name, ok
+}
+
+// streamName map session to stream name by naming rule, ssrc of the first source:
+//
+//	{ip}   source ip
+//	{port} local rtp port
+//	{ssrc} rtp ssrc in decimal
+func streamName(ip net.IP, port int, ssrc uint32) string {
+	cfg := config.Global.RTP
+	rule := cfg.StreamName
+	if rule == "" {
+		rule = DefaultStreamName
+	}
+	return strings.NewReplacer(
+		"{ip}", ip.String(),
+		"{port}", strconv.Itoa(port),
+		"{ssrc}", strconv.FormatUint(uint64(ssrc), 10),
+	).Replace(rule)
+}
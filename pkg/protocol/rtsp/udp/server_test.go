@@ -0,0 +1,161 @@
+package udp
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"gosm/pkg/config"
+	"gosm/pkg/protocol/rtsp/rtcp"
+	"gosm/pkg/protocol/rtsp/rtp"
+)
+
+// observer publishes sessions, blocked until released if any
+type observer struct {
+	published chan string
+	release   chan struct{}
+	err       error
+}
+
+func (obs *observer) OnUDPPublish(name string, session *Session) error {
+	obs.published <- name
+	if obs.release != nil {
+		<-obs.release
+	}
+	return obs.err
+}
+
+func (obs *observer) OnUDPUnPublish(name string, session *Session) error {
+	return nil
+}
+
+// newTestServer server reading rtp/rtcp of local ports, sessions named by ssrc
+func newTestServer(t *testing.T, obs Observer) (*Server, *net.UDPConn, *net.UDPConn, func()) {
+	config.Global.RTP = config.RTP{App: "live", StreamName: "rtp_{ssrc}"}
+	rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtcpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, closeFunc, _ := NewServer("udp")
+	server.SetObserver(obs)
+	server.conns = append(server.conns, rtpConn, rtcpConn)
+	go server.serveRTP(rtpConn.LocalAddr().(*net.UDPAddr).Port, rtpConn, rtcpConn)
+	go server.serveRTCP(rtcpConn)
+	return server, rtpConn, rtcpConn, closeFunc
+}
+
+// dial local sender socket
+func dial(t *testing.T, conn *net.UDPConn) *net.UDPConn {
+	sender, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender
+}
+
+// senderReport marshal sender report without report blocks
+func senderReport(ssrc uint32, msw uint32, ts uint32) []byte {
+	p := make([]byte, 28)
+	p[0] = 2 << 6
+	p[1] = rtcp.SR
+	binary.BigEndian.PutUint16(p[2:], 6)
+	binary.BigEndian.PutUint32(p[4:], ssrc)
+	binary.BigEndian.PutUint32(p[8:], msw)
+	binary.BigEndian.PutUint32(p[16:], ts)
+	return p
+}
+
+// eventually waits until condition met
+func eventually(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerGroupsSender(t *testing.T) {
+	obs := &observer{published: make(chan string, 4), release: make(chan struct{})}
+	server, rtpConn, rtcpConn, closeFunc := newTestServer(t, obs)
+	defer closeFunc()
+	defer close(obs.release)
+
+	// video & audio of one sender, publishing not finished
+	camera := dial(t, rtpConn)
+	defer camera.Close()
+	camera.Write(rtp.NewPacket(rtp.PacketTypeAVC, 1, 0, 1111, true, nil).Bytes())
+	camera.Write(rtp.NewPacket(rtp.PacketTypeAAC, 1, 0, 2222, true, nil).Bytes())
+	if name := <-obs.published; name != "rtp_1111" {
+		t.Fatalf("stream name: %s, expected rtp_1111", name)
+	}
+
+	// another sender published while the first one blocked
+	other := dial(t, rtpConn)
+	defer other.Close()
+	other.Write(rtp.NewPacket(rtp.PacketTypeAVC, 1, 0, 3333, true, nil).Bytes())
+	select {
+	case name := <-obs.published:
+		if name != "rtp_3333" {
+			t.Fatalf("stream name: %s, expected rtp_3333", name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("publishing blocked by the other sender")
+	}
+
+	var video, audio *serverSession
+	eventually(t, "audio joined", func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		video, audio = server.sources[sourceKey(net.IPv4(127, 0, 0, 1), 1111)], server.sources[sourceKey(net.IPv4(127, 0, 0, 1), 2222)]
+		return video != nil && audio != nil
+	})
+	if video != audio {
+		t.Fatal("video & audio of one sender are in different sessions")
+	}
+	server.mu.Lock()
+	sessions := len(server.sessions)
+	server.mu.Unlock()
+	if sessions != 2 {
+		t.Fatalf("sessions: %d, expected 2", sessions)
+	}
+
+	// sender reports of both ssrc reach the session
+	reporter := dial(t, rtcpConn)
+	defer reporter.Close()
+	reporter.Write(senderReport(1111, rtcp.FixedNTP+1, 0))
+	reporter.Write(senderReport(2222, rtcp.FixedNTP+1, 0))
+	eventually(t, "sender reports", func() bool { return len(video.rtcp.queue) == 2 })
+}
+
+func TestServerBlocksRejected(t *testing.T) {
+	obs := &observer{published: make(chan string, 4), err: errors.New("rejected")}
+	server, rtpConn, _, closeFunc := newTestServer(t, obs)
+	defer closeFunc()
+
+	sender := dial(t, rtpConn)
+	defer sender.Close()
+	sender.Write(rtp.NewPacket(rtp.PacketTypeAVC, 1, 0, 1111, true, nil).Bytes())
+	<-obs.published
+	eventually(t, "sender blocked", func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return len(server.blocked) == 1 && len(server.sessions) == 0
+	})
+
+	for sn := uint16(2); sn < 10; sn++ {
+		sender.Write(rtp.NewPacket(rtp.PacketTypeAVC, sn, 0, 1111, true, nil).Bytes())
+	}
+	select {
+	case <-obs.published:
+		t.Fatal("rejected sender published again")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -1,47 +1,67 @@
 package udp
 
 import (
+	"bytes"
 	"fmt"
 	"gosm/pkg/avformat"
+	"gosm/pkg/avformat/aac"
+	"gosm/pkg/avformat/avc"
+	"gosm/pkg/avformat/hevc"
+	"gosm/pkg/config"
 	"gosm/pkg/log"
 	"gosm/pkg/protocol/rtsp/rtcp"
 	"gosm/pkg/protocol/rtsp/rtp"
+	"io"
+	"math/rand"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 )
 
+const (
+	// JitterTick interval to flush jitter buffers
+	JitterTick = 10 * time.Millisecond
+	// ReportInterval interval to send rtcp receiver report
+	ReportInterval = 5 * time.Second
+	// KeyframeInterval min interval between keyframe requests
+	KeyframeInterval = time.Second
+	// VideoClockRate clock rate of h264 & h265 video
+	VideoClockRate = 90000
+	// DefaultAudioClockRate audio clock rate if unknown
+	DefaultAudioClockRate = 48000
+)
+
 type Session struct {
 	rtp  *rtp.Connection
 	rtcp *rtcp.Connection
 
 	ssrc      uint32
-	sysTs     int64  // local timestamp
-	rtpBaseTs uint32 // first rtp packet's timestamp
-	rtpLastTs uint32 // last rtp packet's timestamp
+	localSSRC uint32   // ssrc of rtcp sent by this receiver
+	rtcpAddr  net.Addr // rtcp destination, nil to reply the latest source
+	clock     *avClock // rtp timestamps to milliseconds
+	reorder   *dtsReorder
+	sps       []byte // sps parsed for reorder depth
 
 	depacketizer  *rtp.Depacketizer
+	videoJitter   *rtp.JitterBuffer
+	audioJitter   *rtp.JitterBuffer
+	videoRecv     *receiver
+	audioRecv     *receiver
+	nackEnabled   bool      // retransmission requested only if waiting for reordering
+	firSeq        uint8     // FIR command sequence number
+	lastKeyReq    time.Time // last PLI/FIR sent
 	packer        *rtp.RTMPPacker
 	avcSeqHdrSent bool
 	aacSeqHdrSent bool
 	avQueue       chan *avformat.AVPacket
+	done          chan struct{}
+	closeOnce     sync.Once
+	bye           bool // closed by rtcp bye of sender, set by serving loop
 }
 
+// NewSession listen rtp on even port, rtcp on port + 1
 func NewSession(port string) (*Session, error) {
-	session := &Session{
-		rtcp:          nil,
-		rtp:           nil,
-		ssrc:          0,
-		sysTs:         time.Now().UnixNano() / 1e6,
-		rtpBaseTs:     0,
-		rtpLastTs:     0,
-		depacketizer:  rtp.NewDepacketizer(),
-		packer:        rtp.NewRTMPRepacker(),
-		avcSeqHdrSent: false,
-		aacSeqHdrSent: false,
-		avQueue:       make(chan *avformat.AVPacket, 1024),
-	}
-
 	// rtp
 	rtpPort, err := strconv.Atoi(port)
 	if err != nil {
@@ -58,25 +78,89 @@ func NewSession(port string) (*Session, error) {
 	if err != nil {
 		return nil, fmt.Errorf("UDP: listen rtp port error, %v", err)
 	}
-	session.rtp = rtp.NewConn(rtpConn)
 
 	// rtcp
-	rtcpPort, err := strconv.Atoi(port)
-	if err != nil {
-		return nil, err
-	}
-	rtcpAddr, err := net.ResolveUDPAddr("udp", ":"+strconv.Itoa(rtcpPort+1))
+	rtcpAddr, err := net.ResolveUDPAddr("udp", ":"+strconv.Itoa(rtpPort+1))
 	if err != nil {
+		rtpConn.Close()
 		return nil, fmt.Errorf("UDP: address resolve error, %v", err)
 	}
 	rtcpConn, err := net.ListenUDP("udp", rtcpAddr)
 	if err != nil {
+		rtpConn.Close()
 		return nil, fmt.Errorf("UDP: listen rtp port error, %v", err)
 	}
-	session.rtcp = rtcp.NewConn(rtcpConn)
 
 	log.Info("UDP: session listen rtp on %s, rtcp on %s", rtpConn.LocalAddr(), rtcpConn.LocalAddr())
-	return session, nil
+	return NewSessionWithConn(rtpConn, rtcpConn), nil
+}
+
+// NewSessionWithConn session reading rtp/rtcp from given packet conns, ex. rtsp interleaved channels
+func NewSessionWithConn(rtpConn net.PacketConn, rtcpConn net.PacketConn) *Session {
+	latency := time.Duration(config.Global.RTP.JitterLatency) * time.Millisecond
+	return &Session{
+		rtp:           rtp.NewConn(rtpConn),
+		rtcp:          rtcp.NewConn(rtcpConn),
+		ssrc:          0,
+		localSSRC:     rand.Uint32(),
+		rtcpAddr:      nil,
+		clock:         newAVClock(VideoClockRate, DefaultAudioClockRate),
+		reorder:       newDTSReorder(),
+		sps:           nil,
+		depacketizer:  rtp.NewDepacketizer(),
+		videoJitter:   rtp.NewJitterBuffer(latency),
+		audioJitter:   rtp.NewJitterBuffer(latency),
+		videoRecv:     newReceiver(VideoClockRate),
+		audioRecv:     newReceiver(DefaultAudioClockRate),
+		nackEnabled:   latency > 0,
+		packer:        rtp.NewRTMPRepacker(),
+		avcSeqHdrSent: false,
+		aacSeqHdrSent: false,
+		avQueue:       make(chan *avformat.AVPacket, 1024),
+		done:          make(chan struct{}),
+	}
+}
+
+// SetVideoTrack sets video payload type and out-of-band sps & pps
+func (session *Session) SetVideoTrack(pt uint8, sps, pps []byte) {
+	session.rtp.SetPayloadType(pt, session.rtp.AudioPT())
+	if sps != nil && pps != nil {
+		session.depacketizer.SetParameterSets(sps, pps)
+	}
+}
+
+// SetHEVCTrack sets h.265 video payload type and out-of-band vps & sps & pps
+func (session *Session) SetHEVCTrack(pt uint8, vps, sps, pps []byte) {
+	session.rtp.SetPayloadType(pt, session.rtp.AudioPT())
+	session.depacketizer.SetVideoCodec(rtp.CodecH265)
+	if vps != nil && sps != nil && pps != nil {
+		session.depacketizer.SetHEVCParameterSets(vps, sps, pps)
+	}
+}
+
+// SetAudioTrack sets audio payload type and AudioSpecificConfig
+func (session *Session) SetAudioTrack(pt uint8, config []byte) {
+	session.rtp.SetPayloadType(session.rtp.VideoPT(), pt)
+	if config != nil {
+		session.packer.SetAudioSpecificConfig(config)
+		parser := aac.NewAACParser(nil)
+		if err := parser.ParseAudioSpecificConfig(config); err == nil {
+			if idx := int(parser.AudioSpecificConfig().SamplingFrequencyIndex); idx < len(aac.AACSampleRate) {
+				session.audioRecv.clockRate = uint32(aac.AACSampleRate[idx])
+				session.clock.audio.clockRate = uint32(aac.AACSampleRate[idx])
+			}
+		}
+	}
+}
+
+// SetRTCPAddr sets rtcp destination of receiver reports & feedbacks
+func (session *Session) SetRTCPAddr(addr net.Addr) {
+	session.rtcpAddr = addr
+}
+
+// LocalPort returns local rtp port, rtcp port = rtp port + 1
+func (session *Session) LocalPort() int {
+	return session.rtp.LocalAddr().(*net.UDPAddr).Port
 }
 
 // Serve
@@ -84,15 +168,35 @@ func (session *Session) Serve() {
 	go session.rtcp.Serve()
 	go session.rtp.Serve()
 
+	ticker := time.NewTicker(JitterTick)
+	reportTicker := time.NewTicker(ReportInterval)
+	defer func() {
+		ticker.Stop()
+		reportTicker.Stop()
+		video, audio := session.Stats()
+		log.Debug("RTP: session ssrc: %d exit, video %+v, audio %+v", session.ssrc, video, audio)
+	}()
+
 	for {
 		select {
+		case <-session.done:
+			return
 		case rtcpPacket := <-session.rtcp.Queue():
 			switch rtcpPacket.PT {
 			case rtcp.SR:
-				// sr := rtcpPacket.ParseSR()
-			case rtcp.RR:
+				sr, err := rtcpPacket.ParseSR()
+				if err != nil {
+					log.Error("RTCP: session ssrc: %d, %v", session.ssrc, err)
+					break
+				}
+				session.onSR(sr, time.Now())
+			case rtcp.RR, rtcp.RTPFB, rtcp.PSFB:
 			case rtcp.SDES:
 			case rtcp.BYE:
+				log.Debug("RTCP: session ssrc: %d, bye", session.ssrc)
+				session.bye = true
+				session.Close()
+				return
 			case rtcp.APP:
 			default:
 				fmt.Printf("%+v\n", rtcpPacket)
@@ -100,67 +204,228 @@ func (session *Session) Serve() {
 			}
 
 		case video := <-session.rtp.VideoQueue():
-			if session.rtpBaseTs == 0 {
-				session.rtpBaseTs = video.Timestamp()
+			now := time.Now()
+			session.videoRecv.update(video, now)
+			session.nack(video.SSRC(), session.videoJitter.Push(video, now))
+			for _, packet := range session.videoJitter.Pop(now) {
+				session.onVideo(packet)
 			}
-			session.rtpLastTs = video.Timestamp()
-
-			marker, err := session.depacketizer.DepacketizeVideo(video)
-			if err != nil {
-				log.Error("RTP: depacketize video error, %v", err)
+		case audio := <-session.rtp.AudioQueue():
+			now := time.Now()
+			session.audioRecv.update(audio, now)
+			session.nack(audio.SSRC(), session.audioJitter.Push(audio, now))
+			for _, packet := range session.audioJitter.Pop(now) {
+				session.onAudio(packet)
 			}
-
-			if marker {
-				// video sequence header tag should come first
-				if !session.avcSeqHdrSent {
-					sps := session.depacketizer.SPS()
-					pps := session.depacketizer.PPS()
-					packet, err := session.packer.VideoSeqHdrPacket(sps, pps)
-					if err != nil {
-						log.Error("RTP: repack video sequence packet error, %v", err)
-					}
-					if packet != nil {
-						session.avQueue <- packet
-						session.avcSeqHdrSent = true
-					}
-				}
-
-				// video full frame
-				// NOTE: due to h264 with B frame, rtp timestamp increases not monotonic,
-				// 			 not support to sort video frame for now, ensure pulling without B frame
-				// TODO: fix it
-				payload := session.depacketizer.Nalus()
-				ts := uint32(time.Now().UnixNano()/1e6 - session.sysTs)
-				pts := int32(session.rtpLastTs - session.rtpBaseTs)
-				dts := pts
-				avPacket, err := session.packer.PackVideo(ts, pts, dts, payload)
-				if err != nil {
-					log.Error("RTP: repack video nalu packet error, %v", err)
-				}
-				session.avQueue <- avPacket
+		case now := <-ticker.C:
+			// flush packets waited over latency
+			for _, packet := range session.videoJitter.Pop(now) {
+				session.onVideo(packet)
 			}
-		case audio := <-session.rtp.AudioQueue():
-			if session.rtpBaseTs == 0 {
-				session.rtpBaseTs = audio.Timestamp()
+			for _, packet := range session.audioJitter.Pop(now) {
+				session.onAudio(packet)
 			}
-			session.rtpLastTs = audio.Timestamp()
+		case now := <-reportTicker.C:
+			session.report(now)
+		}
+	}
+}
 
-			// audio sequence header tag should come first
-			if !session.aacSeqHdrSent {
-				session.avQueue <- session.packer.AudioSeqHdrPacket()
-				session.aacSeqHdrSent = true
-			}
+// onSR match sender report to its source for LSR & DLSR and a/v sync,
+// rtp timestamp of the report is ambiguous if video and audio share one ssrc, not synced then
+func (session *Session) onSR(sr *rtcp.SenderReport, now time.Time) {
+	video, audio := session.videoRecv, session.audioRecv
+	shared := video.started && audio.started && video.ssrc == audio.ssrc
+	if video.started && video.ssrc == sr.SSRC {
+		video.onSR(sr, now)
+		if !shared {
+			session.clock.onSR(session.clock.video, sr)
+		}
+	}
+	if audio.started && audio.ssrc == sr.SSRC {
+		audio.onSR(sr, now)
+		if !shared {
+			session.clock.onSR(session.clock.audio, sr)
+		}
+	}
+}
 
-			// NOTE: few format supported
-			audioFrames, err := session.depacketizer.DepacketizeAudio(audio)
-			if err != nil {
-				log.Error("RTP: depacketize audio error, %v", err)
-			}
-			for _, frame := range audioFrames {
-				session.avQueue <- session.packer.PackAudio(frame.Timestamp, frame.Raw)
-			}
+// report send receiver report of each source
+func (session *Session) report(now time.Time) {
+	blocks := make([]*rtcp.ReportBlock, 0, 2)
+	for _, recv := range []*receiver{session.videoRecv, session.audioRecv} {
+		if recv.started {
+			blocks = append(blocks, recv.report(now))
 		}
 	}
+	if len(blocks) == 0 {
+		return
+	}
+	session.sendRTCP(rtcp.NewReceiverReport(session.localSSRC, blocks))
+}
+
+// nack request retransmission of missing packets
+func (session *Session) nack(mediaSSRC uint32, lost []uint16) {
+	if !session.nackEnabled || len(lost) == 0 {
+		return
+	}
+	session.sendRTCP(rtcp.NewReceiverReport(session.localSSRC, nil), &rtcp.NACK{
+		SenderSSRC: session.localSSRC,
+		MediaSSRC:  mediaSSRC,
+		Lost:       lost,
+	})
+}
+
+// requestKeyframe send PLI & FIR, at most once per KeyframeInterval
+func (session *Session) requestKeyframe(now time.Time) {
+	if !session.videoRecv.started || now.Sub(session.lastKeyReq) < KeyframeInterval {
+		return
+	}
+	session.lastKeyReq = now
+	session.firSeq++
+	mediaSSRC := session.videoRecv.ssrc
+	session.sendRTCP(rtcp.NewReceiverReport(session.localSSRC, nil),
+		&rtcp.PLI{SenderSSRC: session.localSSRC, MediaSSRC: mediaSSRC},
+		&rtcp.FIR{SenderSSRC: session.localSSRC, MediaSSRC: mediaSSRC, SeqNr: session.firSeq},
+	)
+}
+
+// sendRTCP send compound packet led by receiver report and SDES, see rfc3550 section 6.1
+func (session *Session) sendRTCP(rr *rtcp.ReceiverReport, packets ...io.WriterTo) {
+	compound := []io.WriterTo{rr, &rtcp.SourceDescription{
+		SSRC:  session.localSSRC,
+		CNAME: fmt.Sprintf("gosm-%08x", session.localSSRC),
+	}}
+	compound = append(compound, packets...)
+	if err := session.rtcp.WritePackets(session.rtcpAddr, compound...); err != nil {
+		log.Debug("RTCP: session ssrc: %d, send error, %v", session.ssrc, err)
+	}
+}
+
+// depacketize video packet in sequence, repack to av packet if access unit completed
+func (session *Session) onVideo(video *rtp.Packet) {
+	marker, err := session.depacketizer.DepacketizeVideo(video)
+	if err != nil {
+		log.Error("RTP: depacketize video error, %v", err)
+	}
+	if session.depacketizer.NeedKeyframe() {
+		session.requestKeyframe(time.Now())
+	}
+	if !marker {
+		return
+	}
+
+	// video sequence header tag should come first
+	hevcCodec := session.depacketizer.VideoCodec() == rtp.CodecH265
+	if !session.avcSeqHdrSent {
+		sps := session.depacketizer.SPS()
+		pps := session.depacketizer.PPS()
+		var packet *avformat.AVPacket
+		var err error
+		if hevcCodec {
+			packet, err = session.packer.HEVCSeqHdrPacket(session.depacketizer.VPS(), sps, pps)
+		} else {
+			packet, err = session.packer.VideoSeqHdrPacket(sps, pps)
+		}
+		if err != nil {
+			log.Error("RTP: repack video sequence packet error, %v", err)
+		}
+		if packet != nil {
+			session.push(packet)
+			session.avcSeqHdrSent = true
+		}
+	}
+
+	// video full frame, rtp timestamp is pts and out of order with b-frames,
+	// dts derived from pts by reorder depth of sps
+	payload := session.depacketizer.Nalus()
+	if len(payload) == 0 {
+		return
+	}
+	session.updateReorderDepth()
+	pts := int64(session.clock.millis(session.clock.video, video.Timestamp(), time.Now()))
+	keyframe := avc.IsKeyframe(payload)
+	if hevcCodec {
+		keyframe = hevc.IsKeyframe(payload)
+	}
+	dts := session.reorder.dts(pts, keyframe)
+	if dts < 0 {
+		dts = 0
+	}
+	var avPacket *avformat.AVPacket
+	if hevcCodec {
+		avPacket, err = session.packer.PackHEVC(uint32(dts), int32(pts), int32(dts), payload)
+	} else {
+		avPacket, err = session.packer.PackVideo(uint32(dts), int32(pts), int32(dts), payload)
+	}
+	if err != nil {
+		log.Error("RTP: repack video nalu packet error, %v", err)
+		return
+	}
+	session.push(avPacket)
+}
+
+// updateReorderDepth fix reorder depth if sps updated and tells
+func (session *Session) updateReorderDepth() {
+	sps := session.depacketizer.SPS()
+	if sps == nil || bytes.Equal(sps, session.sps) {
+		return
+	}
+	session.sps = sps
+	if session.depacketizer.VideoCodec() == rtp.CodecH265 {
+		info, err := hevc.ParseSPS(sps)
+		if err != nil {
+			log.Warn("RTP: session ssrc: %d, %v", session.ssrc, err)
+			return
+		}
+		session.reorder.setDepth(info.MaxNumReorderPics)
+		log.Debug("RTP: session ssrc: %d, hevc video %dx%d, reorder pics %d",
+			session.ssrc, info.Width, info.Height, info.MaxNumReorderPics)
+		return
+	}
+	info, err := avc.ParseSPS(sps)
+	if err != nil {
+		log.Warn("RTP: session ssrc: %d, %v", session.ssrc, err)
+		return
+	}
+	if depth, ok := info.ReorderFrames(); ok {
+		session.reorder.setDepth(depth)
+	}
+	log.Debug("RTP: session ssrc: %d, video %dx%d, profile %d, reorder frames %d",
+		session.ssrc, info.Width, info.Height, info.ProfileIdc, info.MaxNumReorderFrames)
+}
+
+// depacketize audio packet in sequence, repack to av packets
+func (session *Session) onAudio(audio *rtp.Packet) {
+	// audio sequence header tag should come first
+	if !session.aacSeqHdrSent {
+		session.push(session.packer.AudioSeqHdrPacket())
+		session.aacSeqHdrSent = true
+	}
+
+	// NOTE: few format supported
+	audioFrames, err := session.depacketizer.DepacketizeAudio(audio)
+	if err != nil {
+		log.Error("RTP: depacketize audio error, %v", err)
+	}
+	now := time.Now()
+	for _, frame := range audioFrames {
+		ts := session.clock.audio.monotonic(session.clock.millis(session.clock.audio, frame.Timestamp, now))
+		session.push(session.packer.PackAudio(ts, frame.Raw))
+	}
+}
+
+// Stats loss & late counters of video and audio
+func (session *Session) Stats() (video rtp.JitterStats, audio rtp.JitterStats) {
+	return session.videoJitter.Stats(), session.audioJitter.Stats()
+}
+
+// push av packet to reader, give up if session closed
+func (session *Session) push(packet *avformat.AVPacket) {
+	select {
+	case <-session.done:
+	case session.avQueue <- packet:
+	}
 }
 
 /************************************/
@@ -169,20 +434,26 @@ func (session *Session) Serve() {
 
 // ReadAVPacket .
 func (session *Session) ReadAVPacket() (*avformat.AVPacket, error) {
-	avPacket, ok := <-session.avQueue
-	if !ok {
-		return nil, fmt.Errorf("RTP: stream '%d' media buffer closed", session.ssrc)
+	select {
+	case <-session.done:
+		return nil, fmt.Errorf("RTP: stream '%d' is closed", session.ssrc)
+	case avPacket, ok := <-session.avQueue:
+		if !ok {
+			return nil, fmt.Errorf("RTP: stream '%d' media buffer closed", session.ssrc)
+		}
+		return avPacket, nil
 	}
-	return avPacket, nil
 }
 
 // Close .
 func (session *Session) Close() error {
-	if err := session.rtp.Close(); err != nil {
-		return err
-	}
-	if err := session.rtcp.Close(); err != nil {
-		return err
-	}
-	return nil
+	var err error
+	session.closeOnce.Do(func() {
+		close(session.done)
+		if err = session.rtp.Close(); err != nil {
+			return
+		}
+		err = session.rtcp.Close()
+	})
+	return err
 }
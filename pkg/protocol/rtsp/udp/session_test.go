@@ -0,0 +1,181 @@
+package udp
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"gosm/pkg/config"
+	"gosm/pkg/protocol/rtsp/rtcp"
+	"gosm/pkg/protocol/rtsp/rtp"
+)
+
+// packetConn records packets written, reading blocked until closed
+type packetConn struct {
+	mu      sync.Mutex
+	written [][]byte
+	done    chan struct{}
+}
+
+func newPacketConn() *packetConn {
+	return &packetConn{done: make(chan struct{})}
+}
+
+func (conn *packetConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	<-conn.done
+	return 0, nil, net.ErrClosed
+}
+
+func (conn *packetConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.written = append(conn.written, append([]byte{}, p...))
+	return len(p), nil
+}
+
+func (conn *packetConn) Close() error {
+	close(conn.done)
+	return nil
+}
+
+func (conn *packetConn) LocalAddr() net.Addr                { return &net.UDPAddr{} }
+func (conn *packetConn) SetDeadline(t time.Time) error      { return nil }
+func (conn *packetConn) SetReadDeadline(t time.Time) error  { return nil }
+func (conn *packetConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// compounds rtcp compound packets written since the last call
+func (conn *packetConn) compounds(t *testing.T) [][]*rtcp.Packet {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	compounds := make([][]*rtcp.Packet, 0, len(conn.written))
+	for _, p := range conn.written {
+		packets, err := rtcp.ParseCompound(p)
+		if err != nil {
+			t.Fatalf("compound %x, error %v", p, err)
+		}
+		compounds = append(compounds, packets)
+	}
+	conn.written = nil
+	return compounds
+}
+
+// newFeedbackSession session writing rtcp to recorded conn, video of ssrc 1111 received
+func newFeedbackSession(latency int64) (*Session, *packetConn) {
+	config.Global.RTP.JitterLatency = latency
+	rtcpConn := newPacketConn()
+	session := NewSessionWithConn(newPacketConn(), rtcpConn)
+	session.videoRecv.update(rtp.NewPacket(rtp.PacketTypeAVC, 1, 0, 1111, false, nil), time.Now())
+	return session, rtcpConn
+}
+
+// feedbacks type, fmt, media ssrc & fci of feedbacks within compound led by empty RR and SDES
+func feedbacks(t *testing.T, session *Session, compound []*rtcp.Packet) [][]byte {
+	if len(compound) < 3 || compound[0].PT != rtcp.RR || compound[0].RC != 0 || compound[1].PT != rtcp.SDES {
+		t.Fatalf("compound %v, expected led by empty RR & SDES", compound)
+	}
+	fcis := make([][]byte, 0, len(compound)-2)
+	for _, packet := range compound[2:] {
+		if packet.SSRC != session.localSSRC {
+			t.Fatalf("sender ssrc %d, expected %d", packet.SSRC, session.localSSRC)
+		}
+		fcis = append(fcis, append([]byte{packet.PT, packet.RC}, packet.Payload[4:]...))
+	}
+	return fcis
+}
+
+func TestSessionNACK(t *testing.T) {
+	tests := []struct {
+		name     string
+		latency  int64
+		lost     []uint16
+		expected [][]byte // NACK feedbacks
+	}{
+		{
+			name:    "wrap",
+			latency: 100,
+			lost:    []uint16{65534, 65535, 1},
+			expected: [][]byte{
+				{rtcp.RTPFB, rtcp.FMTNACK, 0x00, 0x00, 0x04, 0x57, 0xFF, 0xFE, 0x00, 0x05},
+			},
+		},
+		{
+			name:    "nothing lost",
+			latency: 100,
+		},
+		{
+			name:    "disabled without jitter latency",
+			latency: 0,
+			lost:    []uint16{1, 2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session, conn := newFeedbackSession(test.latency)
+			defer session.Close()
+			session.nack(1111, test.lost)
+
+			compounds := conn.compounds(t)
+			if test.expected == nil {
+				if len(compounds) != 0 {
+					t.Fatalf("%d compounds sent, expected none", len(compounds))
+				}
+				return
+			}
+			if len(compounds) != 1 {
+				t.Fatalf("%d compounds sent, expected 1", len(compounds))
+			}
+			if fcis := feedbacks(t, session, compounds[0]); !reflect.DeepEqual(fcis, test.expected) {
+				t.Fatalf("feedbacks %x, expected %x", fcis, test.expected)
+			}
+		})
+	}
+}
+
+func TestSessionRequestKeyframe(t *testing.T) {
+	session, conn := newFeedbackSession(0)
+	defer session.Close()
+	now := time.Now()
+	pli := []byte{rtcp.PSFB, rtcp.FMTPLI, 0x00, 0x00, 0x04, 0x57}
+	fir := func(seq byte) []byte {
+		// media ssrc of common header unused, ssrc of FCI instead
+		return []byte{rtcp.PSFB, rtcp.FMTFIR, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0x57, seq, 0x00, 0x00, 0x00}
+	}
+
+	steps := []struct {
+		at       time.Duration
+		expected [][]byte // PLI & FIR, nil if throttled
+	}{
+		{at: 0, expected: [][]byte{pli, fir(1)}},
+		{at: KeyframeInterval / 2, expected: nil},
+		{at: KeyframeInterval, expected: [][]byte{pli, fir(2)}},
+	}
+	for idx, step := range steps {
+		session.requestKeyframe(now.Add(step.at))
+		compounds := conn.compounds(t)
+		if step.expected == nil {
+			if len(compounds) != 0 {
+				t.Fatalf("step %d: %d compounds sent, expected throttled", idx, len(compounds))
+			}
+			continue
+		}
+		if len(compounds) != 1 {
+			t.Fatalf("step %d: %d compounds sent, expected 1", idx, len(compounds))
+		}
+		if fcis := feedbacks(t, session, compounds[0]); !reflect.DeepEqual(fcis, step.expected) {
+			t.Fatalf("step %d: feedbacks %x, expected %x", idx, fcis, step.expected)
+		}
+	}
+}
+
+func TestSessionRequestKeyframeNotStarted(t *testing.T) {
+	config.Global.RTP.JitterLatency = 0
+	conn := newPacketConn()
+	session := NewSessionWithConn(newPacketConn(), conn)
+	defer session.Close()
+	session.requestKeyframe(time.Now())
+	if compounds := conn.compounds(t); len(compounds) != 0 {
+		t.Fatalf("%d compounds sent, expected none before video received", len(compounds))
+	}
+}
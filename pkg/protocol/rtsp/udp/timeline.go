@@ -0,0 +1,108 @@
+package udp
+
+import (
+	"time"
+
+	"gosm/pkg/protocol/rtsp/rtcp"
+)
+
+// avClock milliseconds timeline shared by video & audio of one session,
+// tracks are aligned by ntp of sender reports, or by arrival before any report
+type avClock struct {
+	start   time.Time // arrival of 0 ms
+	ntpBase int64     // ntp nanoseconds of 0 ms, valid if synced
+	synced  bool      // ntp base set by the first sender report
+	video   *timeline
+	audio   *timeline
+}
+
+func newAVClock(videoClockRate, audioClockRate uint32) *avClock {
+	return &avClock{
+		start:   time.Now(),
+		ntpBase: 0,
+		synced:  false,
+		video:   newTimeline(videoClockRate),
+		audio:   newTimeline(audioClockRate),
+	}
+}
+
+// onSR update ntp/rtp pair of the track, the first report anchors ntp to current timeline
+func (clock *avClock) onSR(t *timeline, sr *rtcp.SenderReport) {
+	if !t.started {
+		return
+	}
+	t.srExt = t.peek(sr.TS)
+	t.srNTP = int64(sr.NTP())
+	if !clock.synced {
+		clock.ntpBase = t.srNTP - t.arrivalMillis(t.srExt)*int64(time.Millisecond)
+		clock.synced = true
+	}
+	t.synced = true
+}
+
+// millis map rtp timestamp of the track to session milliseconds
+func (clock *avClock) millis(t *timeline, ts uint32, now time.Time) uint32 {
+	ext := t.extend(ts)
+	if !t.started {
+		t.started = true
+		t.baseExt = ext
+		t.baseMs = int64(now.Sub(clock.start) / time.Millisecond)
+	}
+
+	ms := t.arrivalMillis(ext)
+	if t.synced && clock.synced {
+		ntp := t.srNTP + (ext-t.srExt)*int64(time.Second)/int64(t.clockRate)
+		ms = (ntp - clock.ntpBase) / int64(time.Millisecond)
+	}
+	if ms < 0 {
+		ms = 0
+	}
+	return uint32(ms)
+}
+
+// timeline rtp timestamps of one track, wraparound unrolled
+type timeline struct {
+	clockRate uint32
+	started   bool
+	lastTs    uint32 // last rtp timestamp
+	extTs     int64  // extended timestamp of lastTs
+	baseExt   int64  // extended timestamp of the first packet
+	baseMs    int64  // arrival milliseconds of the first packet
+	synced    bool   // sender report received
+	srExt     int64  // extended rtp timestamp of last sender report
+	srNTP     int64  // ntp nanoseconds of last sender report
+	lastMs    uint32 // last decoding milliseconds output
+}
+
+func newTimeline(clockRate uint32) *timeline {
+	return &timeline{clockRate: clockRate}
+}
+
+// extend unroll rtp timestamp, out of order timestamp allowed, ex. b-frames
+func (t *timeline) extend(ts uint32) int64 {
+	t.extTs = t.peek(ts)
+	t.lastTs = ts
+	return t.extTs
+}
+
+// peek extended timestamp without updating
+func (t *timeline) peek(ts uint32) int64 {
+	if !t.started {
+		return int64(ts)
+	}
+	return t.extTs + int64(int32(ts-t.lastTs))
+}
+
+// monotonic keep decoding timestamps non-decreasing, ex. jump back when synced by sender report
+func (t *timeline) monotonic(ms uint32) uint32 {
+	if ms < t.lastMs {
+		return t.lastMs
+	}
+	t.lastMs = ms
+	return ms
+}
+
+// arrivalMillis milliseconds from the first packet's arrival
+func (t *timeline) arrivalMillis(ext int64) int64 {
+	return t.baseMs + (ext-t.baseExt)*1000/int64(t.clockRate)
+}
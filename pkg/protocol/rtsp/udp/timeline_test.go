@@ -0,0 +1,58 @@
+package udp
+
+import (
+	"testing"
+	"time"
+
+	"gosm/pkg/protocol/rtsp/rtcp"
+	"gosm/pkg/protocol/rtsp/rtp"
+)
+
+func TestSessionSyncBySenderReports(t *testing.T) {
+	tests := []struct {
+		name       string
+		videoSSRC  uint32
+		audioSSRC  uint32
+		synced     bool
+		audioDelta int64 // audio ms minus video ms of the same instant
+	}{
+		// audio sent 500 ms later than video, aligned by ntp
+		{name: "distinct ssrc", videoSSRC: 1111, audioSSRC: 2222, synced: true, audioDelta: 0},
+		// reports ambiguous, aligned by arrival
+		{name: "shared ssrc", videoSSRC: 1111, audioSSRC: 1111, synced: false, audioDelta: 500},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session := NewSessionWithConn(nil, nil)
+			clock := session.clock
+			now := time.Now()
+
+			// the first packets arrive together, audio timestamped 500 ms earlier
+			video := rtp.NewPacket(rtp.PacketTypeAVC, 1, 90000, test.videoSSRC, true, nil)
+			audio := rtp.NewPacket(rtp.PacketTypeAAC, 1, 48000, test.audioSSRC, true, nil)
+			session.videoRecv.update(video, now)
+			session.audioRecv.update(audio, now)
+			clock.millis(clock.video, video.Timestamp(), now)
+			clock.millis(clock.audio, audio.Timestamp(), now)
+
+			// sender reports of the same ntp instant
+			for _, sr := range []*rtcp.SenderReport{
+				{Header: &rtcp.Header{SSRC: test.videoSSRC}, MSW: rtcp.FixedNTP + 10, TS: 90000},
+				{Header: &rtcp.Header{SSRC: test.audioSSRC}, MSW: rtcp.FixedNTP + 10, TS: 48000 + 24000},
+			} {
+				session.onSR(sr, now)
+			}
+			if clock.synced != test.synced || clock.video.synced != test.synced || clock.audio.synced != test.synced {
+				t.Fatalf("synced: %v, video: %v, audio: %v, expected %v",
+					clock.synced, clock.video.synced, clock.audio.synced, test.synced)
+			}
+
+			// 100 ms after the reports
+			v := clock.millis(clock.video, 90000+9000, now)
+			a := clock.millis(clock.audio, 48000+24000+4800, now)
+			if delta := int64(a) - int64(v); delta != test.audioDelta {
+				t.Fatalf("audio %d ms, video %d ms, delta %d, expected %d", a, v, delta, test.audioDelta)
+			}
+		})
+	}
+}